@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"net/http"
 	"os"
 
 	"github.com/golang/glog"
@@ -37,6 +38,10 @@ func main() {
 		os.Exit(0)
 	}
 
+	if err := o.Validate(); err != nil {
+		glog.Exitf("Invalid options: %v", err)
+	}
+
 	glog.V(2).Infof("Connect to containerd endpoint %q with timeout %v", o.ContainerdEndpoint, o.ContainerdConnectionTimeout)
 	conn, err := server.ConnectToContainerd(o.ContainerdEndpoint, o.ContainerdConnectionTimeout)
 	if err != nil {
@@ -44,7 +49,22 @@ func main() {
 	}
 
 	glog.V(2).Infof("Run cri-containerd grpc server on socket %q", o.SocketPath)
-	service := server.NewCRIContainerdService(conn, o.RootDir)
+	service, err := server.NewCRIContainerdService(conn, o)
+	if err != nil {
+		glog.Exitf("Failed to create CRI containerd service: %v", err)
+	}
+	if err := service.Start(); err != nil {
+		glog.Exitf("Failed to start CRI containerd service: %v", err)
+	}
+	if o.DebugAddress != "" {
+		glog.V(2).Infof("Serve debug information on %q", o.DebugAddress)
+		go func() {
+			// The expvar package registers /debug/vars in the default mux.
+			if err := http.ListenAndServe(o.DebugAddress, nil); err != nil {
+				glog.Errorf("Failed to serve debug information on %q: %v", o.DebugAddress, err)
+			}
+		}()
+	}
 	s := server.NewCRIContainerdServer(o.SocketPath, service, service)
 	if err := s.Run(); err != nil {
 		glog.Exitf("Failed to run cri-containerd grpc server: %v", err)
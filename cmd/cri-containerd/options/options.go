@@ -18,6 +18,10 @@ package options
 
 import (
 	"flag"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -36,8 +40,58 @@ type CRIContainerdOptions struct {
 	ContainerdEndpoint string
 	// ContainerdConnectionTimeout is the connection timeout for containerd client.
 	ContainerdConnectionTimeout time.Duration
+	// SeccompProfileRoot is the directory path for local seccomp profiles.
+	SeccompProfileRoot string
+	// NoNewPrivileges indicates whether to set no_new_privs for container
+	// processes by default.
+	NoNewPrivileges bool
+	// CgroupDriver is the cgroup driver used to manage container cgroups,
+	// either "cgroupfs" or "systemd".
+	CgroupDriver string
+	// DefaultCgroupParent is the cgroup parent of sandboxes and containers
+	// when cgroup parent is not specified by kubelet.
+	DefaultCgroupParent string
+	// MetadataStoreBackend is the backend used to store sandbox, container
+	// and image metadata, either "file" or "bolt".
+	MetadataStoreBackend string
+	// InstanceID identifies the cri-containerd instance when multiple
+	// instances share the same containerd. Sandboxes, containers and images
+	// of different instances are isolated from each other.
+	InstanceID string
+	// DebugAddress is the tcp address cri-containerd serves debug information
+	// on, e.g. the orphan counters at /debug/vars. It is disabled if empty.
+	DebugAddress string
 }
 
+const (
+	// CgroupDriverCgroupfs is the cgroupfs cgroup driver.
+	CgroupDriverCgroupfs = "cgroupfs"
+	// CgroupDriverSystemd is the systemd cgroup driver.
+	CgroupDriverSystemd = "systemd"
+	// defaultCgroupfsCgroupParent is the default cgroup parent with cgroupfs
+	// cgroup driver.
+	defaultCgroupfsCgroupParent = "/cri-containerd"
+	// defaultSystemdCgroupParent is the default cgroup parent with systemd
+	// cgroup driver. A dedicated slice is used to isolate sandboxes and
+	// containers from system daemons in "system.slice".
+	defaultSystemdCgroupParent = "cri-containerd.slice"
+	// systemdSliceSuffix is the suffix of systemd slice name.
+	systemdSliceSuffix = ".slice"
+	// MetadataStoreBackendFile is the metadata store backend which stores
+	// each metadata in a file.
+	MetadataStoreBackendFile = "file"
+	// MetadataStoreBackendBolt is the metadata store backend which stores
+	// all metadata in a bolt database.
+	MetadataStoreBackendBolt = "bolt"
+	// instancesDir is the directory under the root directory which contains
+	// the root directories of all named instances.
+	instancesDir = "instances"
+)
+
+// instanceIDRegexp matches valid instance ids, which are used as directory
+// names.
+var instanceIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
 // NewCRIContainerdOptions returns a reference to CRIContainerdOptions
 func NewCRIContainerdOptions() *CRIContainerdOptions {
 	return &CRIContainerdOptions{}
@@ -53,10 +107,67 @@ func (c *CRIContainerdOptions) AddFlags(fs *pflag.FlagSet) {
 		"/run/containerd/containerd.sock", "Path to the containerd endpoint.")
 	fs.DurationVar(&c.ContainerdConnectionTimeout, "containerd-connection-timeout",
 		2*time.Minute, "Connection timeout for containerd client.")
+	fs.StringVar(&c.SeccompProfileRoot, "seccomp-profile-root",
+		"/var/lib/kubelet/seccomp", "Directory path for local seccomp profiles.")
+	fs.BoolVar(&c.NoNewPrivileges, "no-new-privileges",
+		false, "Set no_new_privs for container processes, so that they can't gain new privileges.")
+	fs.StringVar(&c.CgroupDriver, "cgroup-driver",
+		CgroupDriverCgroupfs, "Cgroup driver used to manage container cgroups, either \"cgroupfs\" or \"systemd\".")
+	fs.StringVar(&c.DefaultCgroupParent, "default-cgroup-parent",
+		"", "Cgroup parent of sandboxes and containers when it is not specified by kubelet. "+
+			"Defaults to \"/cri-containerd\" with cgroupfs driver and \"cri-containerd.slice\" with systemd driver.")
+	fs.StringVar(&c.MetadataStoreBackend, "metadata-store-backend",
+		MetadataStoreBackendFile, "Backend used to store metadata under the root directory, either \"file\" or \"bolt\".")
+	fs.StringVar(&c.InstanceID, "instance-id",
+		"", "Identifier of the cri-containerd instance, required when multiple instances share the same containerd. "+
+			"Each instance should also serve on a different socket path.")
+	fs.StringVar(&c.DebugAddress, "debug-address",
+		"", "TCP address to serve debug information on, e.g. \"127.0.0.1:10011\". "+
+			"Counters are served at /debug/vars. Disabled if empty.")
 	fs.BoolVar(&c.PrintVersion, "version",
 		false, "Print cri-containerd version information and quit.")
 }
 
+// Validate validates cri-containerd command line options.
+func (c *CRIContainerdOptions) Validate() error {
+	if c.CgroupDriver != CgroupDriverCgroupfs && c.CgroupDriver != CgroupDriverSystemd {
+		return fmt.Errorf("unsupported cgroup driver %q", c.CgroupDriver)
+	}
+	if c.CgroupDriver == CgroupDriverSystemd && c.DefaultCgroupParent != "" &&
+		(!strings.HasSuffix(c.DefaultCgroupParent, systemdSliceSuffix) || strings.Contains(c.DefaultCgroupParent, "/")) {
+		return fmt.Errorf("default cgroup parent %q should be a systemd slice name, e.g. %q, with systemd cgroup driver",
+			c.DefaultCgroupParent, defaultSystemdCgroupParent)
+	}
+	if c.MetadataStoreBackend != MetadataStoreBackendFile && c.MetadataStoreBackend != MetadataStoreBackendBolt {
+		return fmt.Errorf("unsupported metadata store backend %q", c.MetadataStoreBackend)
+	}
+	if c.InstanceID != "" && !instanceIDRegexp.MatchString(c.InstanceID) {
+		return fmt.Errorf("invalid instance id %q", c.InstanceID)
+	}
+	return nil
+}
+
+// GetRootDir returns the root directory of the cri-containerd instance. The
+// root directory of a named instance is under the configured root directory.
+func (c *CRIContainerdOptions) GetRootDir() string {
+	if c.InstanceID == "" {
+		return c.RootDir
+	}
+	return filepath.Join(c.RootDir, instancesDir, c.InstanceID)
+}
+
+// GetDefaultCgroupParent returns the default cgroup parent, or the default
+// value of the cgroup driver if it is not set.
+func (c *CRIContainerdOptions) GetDefaultCgroupParent() string {
+	if c.DefaultCgroupParent != "" {
+		return c.DefaultCgroupParent
+	}
+	if c.CgroupDriver == CgroupDriverSystemd {
+		return defaultSystemdCgroupParent
+	}
+	return defaultCgroupfsCgroupParent
+}
+
 // InitFlags must be called after adding all cli options flags are defined and
 // before flags are accessed by the program. Ths fuction adds flag.CommandLine
 // (the default set of command-line flags, parsed from os.Args) and then calls
@@ -0,0 +1,73 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDefaultCgroupParent(t *testing.T) {
+	for desc, test := range map[string]struct {
+		cgroupDriver        string
+		defaultCgroupParent string
+		expectErr           bool
+	}{
+		"should accept empty cgroup parent with systemd driver": {
+			cgroupDriver: CgroupDriverSystemd,
+		},
+		"should accept slice name with systemd driver": {
+			cgroupDriver:        CgroupDriverSystemd,
+			defaultCgroupParent: "test.slice",
+		},
+		"should reject path with systemd driver": {
+			cgroupDriver:        CgroupDriverSystemd,
+			defaultCgroupParent: "/test",
+			expectErr:           true,
+		},
+		"should reject slice path with systemd driver": {
+			cgroupDriver:        CgroupDriverSystemd,
+			defaultCgroupParent: "/test.slice/sub.slice",
+			expectErr:           true,
+		},
+		"should accept path with cgroupfs driver": {
+			cgroupDriver:        CgroupDriverCgroupfs,
+			defaultCgroupParent: "/test",
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		o := &CRIContainerdOptions{
+			CgroupDriver:         test.cgroupDriver,
+			DefaultCgroupParent:  test.defaultCgroupParent,
+			MetadataStoreBackend: MetadataStoreBackendFile,
+		}
+		err := o.Validate()
+		if test.expectErr {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestGetDefaultCgroupParent(t *testing.T) {
+	o := &CRIContainerdOptions{CgroupDriver: CgroupDriverSystemd}
+	assert.Equal(t, "cri-containerd.slice", o.GetDefaultCgroupParent())
+	o = &CRIContainerdOptions{CgroupDriver: CgroupDriverCgroupfs}
+	assert.Equal(t, "/cri-containerd", o.GetDefaultCgroupParent())
+}
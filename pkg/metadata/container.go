@@ -0,0 +1,225 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata/store"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// The code is very similar to sandbox.go, but there is no template support
+// in golang, thus similar files for different types. The type agnostic
+// part is shared in object_store.go.
+
+// containerMetadataVersion is current version of container metadata.
+const containerMetadataVersion = "v1"
+
+// containerMetadataMigrations are the functions migrating serialized
+// container metadata from a version to the next version, keyed by the old
+// version.
+var containerMetadataMigrations = map[string]migrateFunc{}
+
+// versionedContainerMetadata is the internal versioned container metadata.
+type versionedContainerMetadata struct {
+	// Version indicates the version of the versioned container metadata.
+	Version string
+	ContainerMetadata
+}
+
+// ContainerMetadata is the unversioned container metadata.
+type ContainerMetadata struct {
+	// ID is the container id.
+	ID string
+	// Name is the container name.
+	Name string
+	// SandboxID is the sandbox id the container belongs to.
+	SandboxID string
+	// Config is the CRI container config.
+	Config *runtime.ContainerConfig
+	// ImageRef is the reference of image used by the container.
+	ImageRef string
+	// Pid is the init process id of the container.
+	Pid uint32
+	// CreatedAt is the created timestamp.
+	CreatedAt int64
+	// StartedAt is the started timestamp.
+	StartedAt int64
+	// FinishedAt is the finished timestamp.
+	FinishedAt int64
+	// ExitCode is the container exit code.
+	ExitCode int32
+	// CamelCase string explaining why container is in its current state.
+	Reason string
+	// Human-readable message indicating details about why container is in its
+	// current state.
+	Message string
+	// StopSignal is the signal used to stop the container gracefully, which
+	// comes from the image config. SIGTERM is used if it is empty.
+	StopSignal string
+	// SecurityRelaxations are the security relaxations applied to the
+	// container, e.g. in privileged mode.
+	SecurityRelaxations []string
+	// Removing indicates that the container is in removing state.
+	// It is only kept in memory, and is not checkpointed.
+	Removing bool `json:"-"`
+}
+
+// State returns current state of the container based on the metadata.
+func (c *ContainerMetadata) State() runtime.ContainerState {
+	if c.FinishedAt != 0 {
+		return runtime.ContainerState_CONTAINER_EXITED
+	}
+	if c.StartedAt != 0 {
+		return runtime.ContainerState_CONTAINER_RUNNING
+	}
+	if c.CreatedAt != 0 {
+		return runtime.ContainerState_CONTAINER_CREATED
+	}
+	return runtime.ContainerState_CONTAINER_UNKNOWN
+}
+
+// encodeContainer serializes the container metadata with current version.
+func encodeContainer(meta ContainerMetadata) ([]byte, error) {
+	return json.Marshal(&versionedContainerMetadata{
+		Version:           containerMetadataVersion,
+		ContainerMetadata: meta,
+	})
+}
+
+// decodeContainer deserializes the container metadata, and migrates it to
+// current version if needed.
+func decodeContainer(data []byte) (*ContainerMetadata, error) {
+	data, err := upgradeMetadata(data, containerMetadataVersion, containerMetadataMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade container metadata: %v", err)
+	}
+	versioned := &versionedContainerMetadata{}
+	if err := json.Unmarshal(data, versioned); err != nil {
+		return nil, err
+	}
+	return &versioned.ContainerMetadata, nil
+}
+
+// copyContainer returns a deep copy of the container metadata.
+func copyContainer(meta *ContainerMetadata) *ContainerMetadata {
+	c := *meta
+	if meta.Config != nil {
+		c.Config = proto.Clone(meta.Config).(*runtime.ContainerConfig)
+	}
+	c.SecurityRelaxations = copyStrings(meta.SecurityRelaxations)
+	return &c
+}
+
+// ContainerUpdateFunc is the function used to update ContainerMetadata. It gets
+// a copy of current metadata, which could be modified freely. The returned
+// metadata is kept by the store, and MUST NOT be modified afterwards.
+type ContainerUpdateFunc func(ContainerMetadata) (ContainerMetadata, error)
+
+// ContainerStore is the store for metadata of all containers. ContainerMetadata
+// returned by the store is shared and MUST NOT be modified, use Update
+// instead.
+type ContainerStore interface {
+	// Create creates a container from ContainerMetadata in the store.
+	Create(ContainerMetadata) error
+	// Get gets the specified container.
+	Get(string) (*ContainerMetadata, error)
+	// Update updates a specified container.
+	Update(string, ContainerUpdateFunc) error
+	// List lists all containers.
+	List() ([]*ContainerMetadata, error)
+	// Delete deletes the container from the store.
+	Delete(string) error
+}
+
+// containerStore is an implmentation of ContainerStore.
+type containerStore struct {
+	objects *objectStore
+}
+
+// NewContainerStore creates a ContainerStore from a basic MetadataStore,
+// and loads all existing container metadata from it.
+func NewContainerStore(store store.MetadataStore) (ContainerStore, error) {
+	objects, err := newObjectStore(store,
+		func(v interface{}) ([]byte, error) {
+			return encodeContainer(*v.(*ContainerMetadata))
+		},
+		func(data []byte) (string, interface{}, error) {
+			meta, err := decodeContainer(data)
+			if err != nil {
+				return "", nil, err
+			}
+			return meta.ID, meta, nil
+		},
+		func(v interface{}) interface{} {
+			return copyContainer(v.(*ContainerMetadata))
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &containerStore{objects: objects}, nil
+}
+
+// Create creates a container from ContainerMetadata in the store.
+func (c *containerStore) Create(metadata ContainerMetadata) error {
+	return c.objects.create(metadata.ID, &metadata)
+}
+
+// Get gets the specified container.
+func (c *containerStore) Get(containerID string) (*ContainerMetadata, error) {
+	v := c.objects.get(containerID)
+	// Return nil without error if the corresponding metadata
+	// does not exist.
+	if v == nil {
+		return nil, nil
+	}
+	return v.(*ContainerMetadata), nil
+}
+
+// Update updates a specified container. Updates of the same container are
+// serialized. Update will not be applied when the update function
+// returns error.
+func (c *containerStore) Update(containerID string, u ContainerUpdateFunc) error {
+	return c.objects.update(containerID, func(v interface{}) (interface{}, error) {
+		newMeta, err := u(*v.(*ContainerMetadata))
+		if err != nil {
+			return nil, err
+		}
+		return &newMeta, nil
+	})
+}
+
+// List lists all containers.
+func (c *containerStore) List() ([]*ContainerMetadata, error) {
+	values := c.objects.list()
+	metas := make([]*ContainerMetadata, 0, len(values))
+	for _, v := range values {
+		metas = append(metas, v.(*ContainerMetadata))
+	}
+	return metas, nil
+}
+
+// Delete deletes the container from the store.
+func (c *containerStore) Delete(containerID string) error {
+	return c.objects.delete(containerID)
+}
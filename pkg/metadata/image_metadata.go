@@ -18,21 +18,26 @@ package metadata
 
 import (
 	"encoding/json"
+	"fmt"
+
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 
 	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata/store"
 )
 
 // The code is very similar to sandbox.go, but there is no template support
-// in golang, thus similar files for different types.
-// TODO(random-liu): Figure out a way to simplify this.
-// TODO(random-liu): Handle versioning
+// in golang, thus similar files for different types. The type agnostic
+// part is shared in object_store.go.
 
 // imageMetadataVersion is current version of image metadata.
-const imageMetadataVersion = "v1" // nolint
+const imageMetadataVersion = "v1"
+
+// imageMetadataMigrations are the functions migrating serialized image
+// metadata from a version to the next version, keyed by the old version.
+var imageMetadataMigrations = map[string]migrateFunc{}
 
 // versionedImageMetadata is the internal struct representing the versioned
 // image metadata
-// nolint
 type versionedImageMetadata struct {
 	// Version indicates the version of the versioned image metadata.
 	Version string `json:"version,omitempty"`
@@ -49,27 +54,86 @@ type ImageMetadata struct {
 	RepoDigests []string `json:"repo_digests,omitempty"`
 	// Size of the image in bytes. Must be > 0.
 	Size uint64 `json:"size,omitempty"`
+	// ChainID is the chainID of the image, which is used to prepare the
+	// rootfs snapshot of containers created from the image.
+	ChainID string `json:"chain_id,omitempty"`
+	// Config is the oci image config of the image.
+	Config *imagespec.ImageConfig `json:"config,omitempty"`
+	// StopSignal is the stop signal in the image config, which is not
+	// defined in the oci image config yet.
+	StopSignal string `json:"stop_signal,omitempty"`
 }
 
-// ImageMetadataUpdateFunc is the function used to update ImageMetadata.
-type ImageMetadataUpdateFunc func(ImageMetadata) (ImageMetadata, error)
+// encodeImageMetadata serializes the image metadata with current version.
+func encodeImageMetadata(meta ImageMetadata) ([]byte, error) {
+	return json.Marshal(&versionedImageMetadata{
+		Version:       imageMetadataVersion,
+		ImageMetadata: meta,
+	})
+}
 
-// imageMetadataToStoreUpdateFunc generates a metadata store UpdateFunc from ImageMetadataUpdateFunc.
-func imageMetadataToStoreUpdateFunc(u ImageMetadataUpdateFunc) store.UpdateFunc {
-	return func(data []byte) ([]byte, error) {
-		meta := &ImageMetadata{}
-		if err := json.Unmarshal(data, meta); err != nil {
-			return nil, err
-		}
-		newMeta, err := u(*meta)
-		if err != nil {
-			return nil, err
+// decodeImageMetadata deserializes the image metadata, and migrates it to
+// current version if needed.
+func decodeImageMetadata(data []byte) (*ImageMetadata, error) {
+	data, err := upgradeMetadata(data, imageMetadataVersion, imageMetadataMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade image metadata: %v", err)
+	}
+	versioned := &versionedImageMetadata{}
+	if err := json.Unmarshal(data, versioned); err != nil {
+		return nil, err
+	}
+	return &versioned.ImageMetadata, nil
+}
+
+// copyImageMetadata returns a deep copy of the image metadata.
+func copyImageMetadata(meta *ImageMetadata) *ImageMetadata {
+	c := *meta
+	c.RepoTags = copyStrings(meta.RepoTags)
+	c.RepoDigests = copyStrings(meta.RepoDigests)
+	if meta.Config != nil {
+		c.Config = copyImageConfig(meta.Config)
+	}
+	return &c
+}
+
+// copyImageConfig returns a deep copy of the image config.
+func copyImageConfig(config *imagespec.ImageConfig) *imagespec.ImageConfig {
+	c := *config
+	c.Env = copyStrings(config.Env)
+	c.Entrypoint = copyStrings(config.Entrypoint)
+	c.Cmd = copyStrings(config.Cmd)
+	c.ExposedPorts = copySet(config.ExposedPorts)
+	c.Volumes = copySet(config.Volumes)
+	if config.Labels != nil {
+		c.Labels = make(map[string]string, len(config.Labels))
+		for k, v := range config.Labels {
+			c.Labels[k] = v
 		}
-		return json.Marshal(newMeta)
 	}
+	return &c
+}
+
+// copySet returns a copy of the set, nil is kept as nil.
+func copySet(s map[string]struct{}) map[string]struct{} {
+	if s == nil {
+		return nil
+	}
+	c := make(map[string]struct{}, len(s))
+	for k := range s {
+		c[k] = struct{}{}
+	}
+	return c
 }
 
-// ImageMetadataStore is the store for metadata of all images.
+// ImageMetadataUpdateFunc is the function used to update ImageMetadata. It
+// gets a copy of current metadata, which could be modified freely. The
+// returned metadata is kept by the store, and MUST NOT be modified afterwards.
+type ImageMetadataUpdateFunc func(ImageMetadata) (ImageMetadata, error)
+
+// ImageMetadataStore is the store for metadata of all images. ImageMetadata
+// returned by the store is shared and MUST NOT be modified, use Update
+// instead.
 type ImageMetadataStore interface {
 	// Create creates an image's metadata from ImageMetadata in the store.
 	Create(ImageMetadata) error
@@ -85,66 +149,73 @@ type ImageMetadataStore interface {
 
 // imageMetadataStore is an implmentation of ImageMetadataStore.
 type imageMetadataStore struct {
-	store store.MetadataStore
+	objects *objectStore
 }
 
-// NewImageMetadataStore creates an ImageMetadataStore from a basic MetadataStore.
-func NewImageMetadataStore(store store.MetadataStore) ImageMetadataStore {
-	return &imageMetadataStore{store: store}
+// NewImageMetadataStore creates an ImageMetadataStore from a basic
+// MetadataStore, and loads all existing image metadata from it.
+func NewImageMetadataStore(store store.MetadataStore) (ImageMetadataStore, error) {
+	objects, err := newObjectStore(store,
+		func(v interface{}) ([]byte, error) {
+			return encodeImageMetadata(*v.(*ImageMetadata))
+		},
+		func(data []byte) (string, interface{}, error) {
+			meta, err := decodeImageMetadata(data)
+			if err != nil {
+				return "", nil, err
+			}
+			return meta.ID, meta, nil
+		},
+		func(v interface{}) interface{} {
+			return copyImageMetadata(v.(*ImageMetadata))
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &imageMetadataStore{objects: objects}, nil
 }
 
 // Create creates a image's metadata from ImageMetadata in the store.
 func (s *imageMetadataStore) Create(metadata ImageMetadata) error {
-	data, err := json.Marshal(&metadata)
-	if err != nil {
-		return err
-	}
-	return s.store.Create(metadata.ID, data)
+	return s.objects.create(metadata.ID, &metadata)
 }
 
 // Get gets the specified image metadata.
 func (s *imageMetadataStore) Get(digest string) (*ImageMetadata, error) {
-	data, err := s.store.Get(digest)
-	if err != nil {
-		return nil, err
-	}
+	v := s.objects.get(digest)
 	// Return nil without error if the corresponding metadata
 	// does not exist.
-	if data == nil {
+	if v == nil {
 		return nil, nil
 	}
-	imageMetadata := &ImageMetadata{}
-	if err := json.Unmarshal(data, imageMetadata); err != nil {
-		return nil, err
-	}
-	return imageMetadata, nil
+	return v.(*ImageMetadata), nil
 }
 
-// Update updates a specified image's metadata. The function is running in a
-// transaction. Update will not be applied when the update function
+// Update updates a specified image's metadata. Updates of the same image
+// are serialized. Update will not be applied when the update function
 // returns error.
 func (s *imageMetadataStore) Update(digest string, u ImageMetadataUpdateFunc) error {
-	return s.store.Update(digest, imageMetadataToStoreUpdateFunc(u))
+	return s.objects.update(digest, func(v interface{}) (interface{}, error) {
+		newMeta, err := u(*v.(*ImageMetadata))
+		if err != nil {
+			return nil, err
+		}
+		return &newMeta, nil
+	})
 }
 
 // List lists all image metadata.
 func (s *imageMetadataStore) List() ([]*ImageMetadata, error) {
-	allData, err := s.store.List()
-	if err != nil {
-		return nil, err
-	}
-	var imageMetadataA []*ImageMetadata
-	for _, data := range allData {
-		imageMetadata := &ImageMetadata{}
-		if err := json.Unmarshal(data, imageMetadata); err != nil {
-			return nil, err
-		}
-		imageMetadataA = append(imageMetadataA, imageMetadata)
+	values := s.objects.list()
+	imageMetadataA := make([]*ImageMetadata, 0, len(values))
+	for _, v := range values {
+		imageMetadataA = append(imageMetadataA, v.(*ImageMetadata))
 	}
 	return imageMetadataA, nil
 }
 
 // Delete deletes the image metadata from the store.
 func (s *imageMetadataStore) Delete(digest string) error {
-	return s.store.Delete(digest)
+	return s.objects.delete(digest)
 }
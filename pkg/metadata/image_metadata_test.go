@@ -19,6 +19,7 @@ package metadata
 import (
 	"testing"
 
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 	assertlib "github.com/stretchr/testify/assert"
 
 	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata/store"
@@ -41,7 +42,8 @@ func TestImageMetadataStore(t *testing.T) {
 	}
 	assert := assertlib.New(t)
 
-	s := NewImageMetadataStore(store.NewMetadataStore())
+	s, err := NewImageMetadataStore(store.NewMetadataStore())
+	assert.NoError(err)
 
 	t.Logf("should be able to create image metadata")
 	for _, meta := range imageMetadataMap {
@@ -85,3 +87,40 @@ func TestImageMetadataStore(t *testing.T) {
 	assert.NoError(err)
 	assert.Nil(meta)
 }
+
+func TestCopyImageMetadata(t *testing.T) {
+	assert := assertlib.New(t)
+	meta := &ImageMetadata{
+		ID:          "1",
+		RepoTags:    []string{"tag"},
+		RepoDigests: []string{"digest"},
+		Config: &imagespec.ImageConfig{
+			Env:          []string{"a=b"},
+			Entrypoint:   []string{"/bin/sh"},
+			Cmd:          []string{"-c"},
+			ExposedPorts: map[string]struct{}{"80/tcp": {}},
+			Volumes:      map[string]struct{}{"/data": {}},
+			Labels:       map[string]string{"a": "b"},
+		},
+	}
+	c := copyImageMetadata(meta)
+	assert.Equal(meta, c)
+
+	t.Logf("changing the copy should not affect the original")
+	c.RepoTags[0] = "changed"
+	c.RepoDigests[0] = "changed"
+	c.Config.Env[0] = "changed"
+	c.Config.Entrypoint[0] = "changed"
+	c.Config.Cmd[0] = "changed"
+	c.Config.ExposedPorts["changed"] = struct{}{}
+	c.Config.Volumes["changed"] = struct{}{}
+	c.Config.Labels["a"] = "changed"
+	assert.Equal([]string{"tag"}, meta.RepoTags)
+	assert.Equal([]string{"digest"}, meta.RepoDigests)
+	assert.Equal([]string{"a=b"}, meta.Config.Env)
+	assert.Equal([]string{"/bin/sh"}, meta.Config.Entrypoint)
+	assert.Equal([]string{"-c"}, meta.Config.Cmd)
+	assert.Len(meta.Config.ExposedPorts, 1)
+	assert.Len(meta.Config.Volumes, 1)
+	assert.Equal("b", meta.Config.Labels["a"])
+}
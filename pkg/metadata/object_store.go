@@ -0,0 +1,188 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata/store"
+)
+
+// objectStore keeps typed metadata objects in memory, and only serializes
+// them when they are persisted into the backing metadata store. Objects
+// in the store are immutable, so that they could be returned to callers
+// without copying, and callers MUST NOT modify them. Objects are copied on
+// write instead: a created value is copied before it is kept, and an update
+// is applied on a copy of the current value, which then replaces the object.
+// objectStore is type agnostic, the typed stores wrap it with the type
+// specific encode and copy functions and type assertions.
+type objectStore struct {
+	// lock protects objects, and the value of each object.
+	lock    sync.RWMutex
+	objects map[string]*object
+	// store is the backing store objects are persisted into.
+	store store.MetadataStore
+	// encode serializes an object for the backing store.
+	encode encodeFunc
+	// copy deep copies an object before it is written.
+	copy copyFunc
+}
+
+// object is an object in the objectStore.
+type object struct {
+	// updateLock serializes updates of the object, so that an update
+	// is always applied on top of the previous one.
+	updateLock sync.Mutex
+	// value is the current value of the object. It is immutable, and is
+	// replaced as a whole on update.
+	value interface{}
+}
+
+// encodeFunc serializes an object for the backing store.
+type encodeFunc func(interface{}) ([]byte, error)
+
+// copyFunc returns a deep copy of an object.
+type copyFunc func(interface{}) interface{}
+
+// decodeFunc deserializes an object read from the backing store, and
+// returns the id and the value of the object.
+type decodeFunc func([]byte) (string, interface{}, error)
+
+// objectUpdateFunc is the function used to update an object. It gets a
+// copy of the current value, and returns the new value. The new value is
+// kept in the store, and MUST NOT be modified after it is returned.
+type objectUpdateFunc func(interface{}) (interface{}, error)
+
+// newObjectStore creates an objectStore, and loads all existing objects
+// from the backing store.
+func newObjectStore(s store.MetadataStore, encode encodeFunc, decode decodeFunc, copy copyFunc) (*objectStore, error) {
+	allData, err := s.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metadata: %v", err)
+	}
+	objects := make(map[string]*object, len(allData))
+	for _, data := range allData {
+		id, value, err := decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode metadata: %v", err)
+		}
+		objects[id] = &object{value: value}
+	}
+	return &objectStore{
+		objects: objects,
+		store:   s,
+		encode:  encode,
+		copy:    copy,
+	}, nil
+}
+
+// create persists a new object, and adds it into the store.
+func (s *objectStore) create(id string, value interface{}) error {
+	value = s.copy(value)
+	data, err := s.encode(value)
+	if err != nil {
+		return err
+	}
+	// The backing store guarantees that the id doesn't exist.
+	if err := s.store.Create(id, data); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.objects[id] = &object{value: value}
+	return nil
+}
+
+// get returns the current value of the object, or nil if the object doesn't
+// exist. The value is shared and MUST NOT be modified.
+func (s *objectStore) get(id string) interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	obj, ok := s.objects[id]
+	if !ok {
+		return nil
+	}
+	return obj.value
+}
+
+// update applies the update function on the current value of the object,
+// persists the new value and replaces the object with it. Nothing is
+// changed if the update function or persisting fails.
+func (s *objectStore) update(id string, u objectUpdateFunc) error {
+	s.lock.RLock()
+	obj, ok := s.objects[id]
+	s.lock.RUnlock()
+	if !ok {
+		return fmt.Errorf("id %q doesn't exist", id)
+	}
+	obj.updateLock.Lock()
+	defer obj.updateLock.Unlock()
+	s.lock.RLock()
+	value := obj.value
+	s.lock.RUnlock()
+	newValue, err := u(s.copy(value))
+	if err != nil {
+		return err
+	}
+	data, err := s.encode(newValue)
+	if err != nil {
+		return err
+	}
+	// The backing store returns error if the object has been deleted
+	// concurrently.
+	if err := s.store.Update(id, func([]byte) ([]byte, error) {
+		return data, nil
+	}); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	obj.value = newValue
+	return nil
+}
+
+// list returns current values of all objects. The values are shared and
+// MUST NOT be modified.
+func (s *objectStore) list() []interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	values := make([]interface{}, 0, len(s.objects))
+	for _, obj := range s.objects {
+		values = append(values, obj.value)
+	}
+	return values
+}
+
+// delete deletes the object from the backing store and the store.
+func (s *objectStore) delete(id string) error {
+	if err := s.store.Delete(id); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.objects, id)
+	return nil
+}
+
+// copyStrings returns a copy of the string slice, nil is kept as nil.
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
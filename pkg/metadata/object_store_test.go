@@ -0,0 +1,186 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata/store"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+func TestObjectStoreUpdateIsolation(t *testing.T) {
+	s, err := NewContainerStore(store.NewMetadataStore())
+	require.NoError(t, err)
+	require.NoError(t, s.Create(ContainerMetadata{
+		ID:     "1",
+		Config: &runtime.ContainerConfig{Command: []string{"sleep"}},
+	}))
+	old, err := s.Get("1")
+	require.NoError(t, err)
+
+	t.Logf("update should not affect holders of old metadata")
+	require.NoError(t, s.Update("1", func(m ContainerMetadata) (ContainerMetadata, error) {
+		m.Pid = 1234
+		m.Config = &runtime.ContainerConfig{Command: []string{"top"}}
+		return m, nil
+	}))
+	assert.EqualValues(t, 0, old.Pid)
+	assert.Equal(t, []string{"sleep"}, old.Config.Command)
+	meta, err := s.Get("1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1234, meta.Pid)
+	assert.Equal(t, []string{"top"}, meta.Config.Command)
+
+	t.Logf("failed update should not be applied")
+	updateErr := errors.New("update error")
+	assert.Equal(t, updateErr, s.Update("1", func(m ContainerMetadata) (ContainerMetadata, error) {
+		m.Pid = 5678
+		return m, updateErr
+	}))
+	meta, err = s.Get("1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1234, meta.Pid)
+
+	t.Logf("update should return error for nonexistent metadata")
+	assert.Error(t, s.Update("2", func(m ContainerMetadata) (ContainerMetadata, error) {
+		return m, nil
+	}))
+}
+
+func TestObjectStoreCopyOnWrite(t *testing.T) {
+	s, err := NewContainerStore(store.NewMetadataStore())
+	require.NoError(t, err)
+	relaxations := []string{"all-capabilities"}
+	meta := ContainerMetadata{
+		ID:                  "1",
+		Config:              &runtime.ContainerConfig{Command: []string{"sleep"}},
+		SecurityRelaxations: relaxations,
+	}
+	require.NoError(t, s.Create(meta))
+
+	t.Logf("changing created metadata should not affect the store")
+	relaxations[0] = "changed"
+	meta.Config.Command[0] = "changed"
+	got, err := s.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"all-capabilities"}, got.SecurityRelaxations)
+	assert.Equal(t, []string{"sleep"}, got.Config.Command)
+
+	t.Logf("metadata should be shared by get and list without copying")
+	again, err := s.Get("1")
+	require.NoError(t, err)
+	assert.True(t, got == again, "get should return the stored metadata")
+	metas, err := s.List()
+	require.NoError(t, err)
+	require.Len(t, metas, 1)
+	assert.True(t, got == metas[0], "list should return the stored metadata")
+	allocs := testing.AllocsPerRun(100, func() {
+		s.Get("1") // nolint: errcheck
+	})
+	assert.Zero(t, allocs, "get should not allocate")
+
+	t.Logf("changing metadata in place in update should not affect old metadata")
+	require.NoError(t, s.Update("1", func(m ContainerMetadata) (ContainerMetadata, error) {
+		m.SecurityRelaxations[0] = "updated"
+		m.Config.Command[0] = "updated"
+		return m, nil
+	}))
+	assert.Equal(t, []string{"all-capabilities"}, got.SecurityRelaxations)
+	assert.Equal(t, []string{"sleep"}, got.Config.Command)
+	updated, err := s.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"updated"}, updated.SecurityRelaxations)
+	assert.Equal(t, []string{"updated"}, updated.Config.Command)
+}
+
+func TestObjectStoreConcurrentUpdate(t *testing.T) {
+	s, err := NewContainerStore(store.NewMetadataStore())
+	require.NoError(t, err)
+	require.NoError(t, s.Create(ContainerMetadata{ID: "1"}))
+	const updates = 100
+	var wg sync.WaitGroup
+	for i := 0; i < updates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.Update("1", func(m ContainerMetadata) (ContainerMetadata, error) {
+				m.Pid++
+				return m, nil
+			}))
+		}()
+	}
+	wg.Wait()
+	meta, err := s.Get("1")
+	require.NoError(t, err)
+	assert.EqualValues(t, updates, meta.Pid)
+}
+
+func TestObjectStoreLoad(t *testing.T) {
+	backing := store.NewMetadataStore()
+	s, err := NewContainerStore(backing)
+	require.NoError(t, err)
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, s.Create(ContainerMetadata{ID: id, Name: "name-" + id}))
+	}
+	require.NoError(t, s.Update("2", func(m ContainerMetadata) (ContainerMetadata, error) {
+		m.Pid = 1234
+		m.Removing = true
+		return m, nil
+	}))
+	require.NoError(t, s.Delete("3"))
+
+	t.Logf("should load persisted metadata from the backing store")
+	reloaded, err := NewContainerStore(backing)
+	require.NoError(t, err)
+	metas, err := reloaded.List()
+	require.NoError(t, err)
+	assert.Len(t, metas, 2)
+	meta, err := reloaded.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, &ContainerMetadata{ID: "1", Name: "name-1"}, meta)
+
+	t.Logf("should not persist in-memory only fields")
+	meta, err = reloaded.Get("2")
+	require.NoError(t, err)
+	assert.Equal(t, &ContainerMetadata{ID: "2", Name: "name-2", Pid: 1234}, meta)
+
+	meta, err = reloaded.Get("3")
+	require.NoError(t, err)
+	assert.Nil(t, meta)
+}
+
+func BenchmarkSandboxStoreGet(b *testing.B) {
+	s, err := NewSandboxStore(store.NewMetadataStore())
+	require.NoError(b, err)
+	require.NoError(b, s.Create(SandboxMetadata{
+		ID:     "1",
+		Config: &runtime.PodSandboxConfig{Metadata: &runtime.PodSandboxMetadata{Name: "test"}},
+	}))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Get("1"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -18,26 +18,29 @@ package metadata
 
 import (
 	"encoding/json"
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
 
 	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata/store"
 
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
 )
 
-// TODO(random-liu): Handle versioning around all marshal/unmarshal.
-// version and versionedSandboxMetadata is not used now, but should be used
-// in the future:
-// 1) Only versioned metadata should be written into the store;
-// 2) Only unversioned metadata should be returned to the user;
-// 3) A conversion function is needed to convert any supported versioned
-// metadata into unversioned metadata.
+// Only versioned metadata is written into the store, and only unversioned
+// metadata is returned to the user. Metadata of older versions is migrated
+// to the current version when it is read, and rewritten in the current
+// version on the next update.
 
 // sandboxMetadataVersion is current version of sandbox metadata.
-const sandboxMetadataVersion = "v1" // nolint
+const sandboxMetadataVersion = "v1"
+
+// sandboxMetadataMigrations are the functions migrating serialized sandbox
+// metadata from a version to the next version, keyed by the old version.
+var sandboxMetadataMigrations = map[string]migrateFunc{}
 
 // versionedSandboxMetadata is the internal struct representing the versioned
 // sandbox metadata
-// nolint
 type versionedSandboxMetadata struct {
 	// Version indicates the version of the versioned sandbox metadata.
 	Version string
@@ -56,27 +59,52 @@ type SandboxMetadata struct {
 	CreatedAt int64
 	// NetNS is the network namespace used by the sandbox.
 	NetNS string
+	// ProcessLabel is the selinux process label of the sandbox. All containers
+	// in the sandbox share the same selinux level.
+	ProcessLabel string
+	// MountLabel is the selinux mount label of the sandbox.
+	MountLabel string
 }
 
-// SandboxUpdateFunc is the function used to update SandboxMetadata.
-type SandboxUpdateFunc func(SandboxMetadata) (SandboxMetadata, error)
+// encodeSandbox serializes the sandbox metadata with current version.
+func encodeSandbox(meta SandboxMetadata) ([]byte, error) {
+	return json.Marshal(&versionedSandboxMetadata{
+		Version:         sandboxMetadataVersion,
+		SandboxMetadata: meta,
+	})
+}
 
-// sandboxToStoreUpdateFunc generates a metadata store UpdateFunc from SandboxUpdateFunc.
-func sandboxToStoreUpdateFunc(u SandboxUpdateFunc) store.UpdateFunc {
-	return func(data []byte) ([]byte, error) {
-		meta := &SandboxMetadata{}
-		if err := json.Unmarshal(data, meta); err != nil {
-			return nil, err
-		}
-		newMeta, err := u(*meta)
-		if err != nil {
-			return nil, err
-		}
-		return json.Marshal(newMeta)
+// decodeSandbox deserializes the sandbox metadata, and migrates it to
+// current version if needed.
+func decodeSandbox(data []byte) (*SandboxMetadata, error) {
+	data, err := upgradeMetadata(data, sandboxMetadataVersion, sandboxMetadataMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade sandbox metadata: %v", err)
+	}
+	versioned := &versionedSandboxMetadata{}
+	if err := json.Unmarshal(data, versioned); err != nil {
+		return nil, err
 	}
+	return &versioned.SandboxMetadata, nil
 }
 
-// SandboxStore is the store for metadata of all sandboxes.
+// copySandbox returns a deep copy of the sandbox metadata.
+func copySandbox(meta *SandboxMetadata) *SandboxMetadata {
+	c := *meta
+	if meta.Config != nil {
+		c.Config = proto.Clone(meta.Config).(*runtime.PodSandboxConfig)
+	}
+	return &c
+}
+
+// SandboxUpdateFunc is the function used to update SandboxMetadata. It gets
+// a copy of current metadata, which could be modified freely. The returned
+// metadata is kept by the store, and MUST NOT be modified afterwards.
+type SandboxUpdateFunc func(SandboxMetadata) (SandboxMetadata, error)
+
+// SandboxStore is the store for metadata of all sandboxes. SandboxMetadata
+// returned by the store is shared and MUST NOT be modified, use Update
+// instead.
 type SandboxStore interface {
 	// Create creates a sandbox from SandboxMetadata in the store.
 	Create(SandboxMetadata) error
@@ -92,66 +120,73 @@ type SandboxStore interface {
 
 // sandboxStore is an implmentation of SandboxStore.
 type sandboxStore struct {
-	store store.MetadataStore
+	objects *objectStore
 }
 
-// NewSandboxStore creates a SandboxStore from a basic MetadataStore.
-func NewSandboxStore(store store.MetadataStore) SandboxStore {
-	return &sandboxStore{store: store}
+// NewSandboxStore creates a SandboxStore from a basic MetadataStore, and loads
+// all existing sandbox metadata from it.
+func NewSandboxStore(store store.MetadataStore) (SandboxStore, error) {
+	objects, err := newObjectStore(store,
+		func(v interface{}) ([]byte, error) {
+			return encodeSandbox(*v.(*SandboxMetadata))
+		},
+		func(data []byte) (string, interface{}, error) {
+			meta, err := decodeSandbox(data)
+			if err != nil {
+				return "", nil, err
+			}
+			return meta.ID, meta, nil
+		},
+		func(v interface{}) interface{} {
+			return copySandbox(v.(*SandboxMetadata))
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &sandboxStore{objects: objects}, nil
 }
 
 // Create creates a sandbox from SandboxMetadata in the store.
 func (s *sandboxStore) Create(metadata SandboxMetadata) error {
-	data, err := json.Marshal(&metadata)
-	if err != nil {
-		return err
-	}
-	return s.store.Create(metadata.ID, data)
+	return s.objects.create(metadata.ID, &metadata)
 }
 
 // Get gets the specified sandbox.
 func (s *sandboxStore) Get(sandboxID string) (*SandboxMetadata, error) {
-	data, err := s.store.Get(sandboxID)
-	if err != nil {
-		return nil, err
-	}
+	v := s.objects.get(sandboxID)
 	// Return nil without error if the corresponding metadata
 	// does not exist.
-	if data == nil {
+	if v == nil {
 		return nil, nil
 	}
-	sandbox := &SandboxMetadata{}
-	if err := json.Unmarshal(data, sandbox); err != nil {
-		return nil, err
-	}
-	return sandbox, nil
+	return v.(*SandboxMetadata), nil
 }
 
-// Update updates a specified sandbox. The function is running in a
-// transaction. Update will not be applied when the update function
+// Update updates a specified sandbox. Updates of the same sandbox are
+// serialized. Update will not be applied when the update function
 // returns error.
 func (s *sandboxStore) Update(sandboxID string, u SandboxUpdateFunc) error {
-	return s.store.Update(sandboxID, sandboxToStoreUpdateFunc(u))
+	return s.objects.update(sandboxID, func(v interface{}) (interface{}, error) {
+		newMeta, err := u(*v.(*SandboxMetadata))
+		if err != nil {
+			return nil, err
+		}
+		return &newMeta, nil
+	})
 }
 
 // List lists all sandboxes.
 func (s *sandboxStore) List() ([]*SandboxMetadata, error) {
-	allData, err := s.store.List()
-	if err != nil {
-		return nil, err
-	}
-	var sandboxes []*SandboxMetadata
-	for _, data := range allData {
-		sandbox := &SandboxMetadata{}
-		if err := json.Unmarshal(data, sandbox); err != nil {
-			return nil, err
-		}
-		sandboxes = append(sandboxes, sandbox)
+	values := s.objects.list()
+	metas := make([]*SandboxMetadata, 0, len(values))
+	for _, v := range values {
+		metas = append(metas, v.(*SandboxMetadata))
 	}
-	return sandboxes, nil
+	return metas, nil
 }
 
 // Delete deletes the sandbox from the store.
 func (s *sandboxStore) Delete(sandboxID string) error {
-	return s.store.Delete(sandboxID)
+	return s.objects.delete(sandboxID)
 }
@@ -74,7 +74,8 @@ func TestSandboxStore(t *testing.T) {
 	}
 	assert := assertlib.New(t)
 
-	s := NewSandboxStore(store.NewMetadataStore())
+	s, err := NewSandboxStore(store.NewMetadataStore())
+	assert.NoError(err)
 
 	t.Logf("should be able to create sandbox metadata")
 	for _, meta := range sandboxes {
@@ -0,0 +1,114 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// boltMetadataStore is an implementation of MetadataStore backed by a bucket
+// in a bolt database. Each operation is applied in one bolt transaction.
+type boltMetadataStore struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+// NewBoltMetadataStore creates a MetadataStore which stores metadata in the
+// bucket of the bolt database. The bucket is created if it doesn't exist.
+// Different kinds of metadata should use different buckets in the same
+// database.
+func NewBoltMetadataStore(db *bolt.DB, bucket string) (MetadataStore, error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create bucket %q: %v", bucket, err)
+	}
+	return &boltMetadataStore{db: db, bucket: []byte(bucket)}, nil
+}
+
+// Create the metadata with a specific id.
+func (m *boltMetadataStore) Create(id string, data []byte) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(m.bucket)
+		if b.Get([]byte(id)) != nil {
+			return fmt.Errorf("id %q already exists", id)
+		}
+		return b.Put([]byte(id), data)
+	})
+}
+
+// Get data by id.
+func (m *boltMetadataStore) Get(id string) ([]byte, error) {
+	var data []byte
+	if err := m.db.View(func(tx *bolt.Tx) error {
+		// The value is only valid during the transaction, make a copy.
+		data = copyBytes(tx.Bucket(m.bucket).Get([]byte(id)))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Update data by id.
+func (m *boltMetadataStore) Update(id string, u UpdateFunc) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(m.bucket)
+		data := b.Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("id %q doesn't exist", id)
+		}
+		newData, err := u(copyBytes(data))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), newData)
+	})
+}
+
+// List all data.
+func (m *boltMetadataStore) List() ([][]byte, error) {
+	var data [][]byte
+	if err := m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(m.bucket).ForEach(func(_, v []byte) error {
+			data = append(data, copyBytes(v))
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Delete the data by id.
+func (m *boltMetadataStore) Delete(id string) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		// Delete returns nil if the key doesn't exist.
+		return tx.Bucket(m.bucket).Delete([]byte(id))
+	})
+}
+
+// copyBytes returns a copy of the byte slice, nil is returned for nil.
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// tempFilePrefix is the prefix of temporary files created during atomic
+	// write.
+	tempFilePrefix = ".tmp-"
+	// deletedFilePrefix is the prefix of files renamed during atomic delete.
+	deletedFilePrefix = ".deleted-"
+)
+
+// isTempFile returns whether the file name is a temporary file name
+// generated by atomic file operations.
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, tempFilePrefix) || strings.HasPrefix(name, deletedFilePrefix)
+}
+
+// deletedPath returns the path a file is renamed to during atomic delete.
+func deletedPath(path string) string {
+	return filepath.Join(filepath.Dir(path), deletedFilePrefix+filepath.Base(path))
+}
+
+// writeFileAtomic writes data into a temporary file in the same directory,
+// fsyncs it and renames it to the path. If exclusive is true, error is
+// returned if the path already exists.
+func writeFileAtomic(path string, data []byte, exclusive bool) (retErr error) {
+	dir := filepath.Dir(path)
+	f, err := ioutil.TempFile(dir, tempFilePrefix+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() {
+		if retErr != nil {
+			f.Close()      // nolint: errcheck
+			os.Remove(tmp) // nolint: errcheck
+		}
+	}()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if exclusive {
+		// Link fails if the path already exists, which makes the creation
+		// exclusive. The temporary file is removed after link, and it will
+		// be cleaned up on the next start if the removal fails.
+		if err := os.Link(tmp, path); err != nil {
+			return err
+		}
+		os.Remove(tmp) // nolint: errcheck
+	} else if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir fsyncs the directory to make sure renames in it are persisted.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
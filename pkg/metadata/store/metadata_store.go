@@ -17,7 +17,12 @@ limitations under the License.
 package store
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/golang/glog"
@@ -34,10 +39,8 @@ import (
 type UpdateFunc func([]byte) ([]byte, error)
 
 // MetadataStore is the interface for storing metadata. All methods should
-// be thread-safe.
-// TODO(random-liu): Initialize the metadata store with a type, and replace
-// []byte with interface{}, so as to avoid extra marshal/unmarshal on the
-// user side.
+// be thread-safe. It only persists serialized metadata, the typed stores
+// in the metadata package keep the deserialized metadata in memory.
 type MetadataStore interface {
 	// Create the metadata containing the passed in data with the
 	// specified id.
@@ -62,22 +65,32 @@ type MetadataStore interface {
 	Delete(string) error
 }
 
-// TODO(random-liu) Add checkpoint. When checkpoint is enabled, it should cache data
-// in memory and checkpoint metadata into files during update. Metadata should serve
-// from memory, but any modification should be checkpointed, so that memory could be
-// recovered after restart. It should be possible to disable the checkpoint for testing.
-// Note that checkpoint update may fail, so the recovery logic should tolerate that.
-
-// metadata is the internal type for storing data in metadataStore.
+// metadata is the internal type for storing data in metadataStore. The data
+// is served from memory, and checkpointed into a file if the checkpoint path
+// is not empty, so that it could be recovered after restart.
 type metadata struct {
 	sync.RWMutex
 	data []byte
+	// path is the checkpoint file path, empty means checkpoint is disabled.
+	path string
+	// deleted is set once the metadata is deleted. No update should be
+	// applied after that, or the checkpoint file would be written back.
+	deleted bool
 }
 
-// newMetadata creates a new metadata.
-func newMetadata(data []byte) (*metadata, error) {
-	return &metadata{data: data}, nil
-	// TODO(random-liu): Create the data on disk atomically.
+// errDeleted is returned by update if the metadata has been deleted.
+var errDeleted = errors.New("metadata has been deleted")
+
+// newMetadata creates a new metadata. The data is created on disk atomically
+// if checkpoint is enabled, and error is returned if the checkpoint file
+// already exists.
+func newMetadata(path string, data []byte) (*metadata, error) {
+	if path != "" {
+		if err := writeFileAtomic(path, data, true); err != nil {
+			return nil, err
+		}
+	}
+	return &metadata{data: data, path: path}, nil
 }
 
 // get a snapshot of the metadata.
@@ -91,29 +104,57 @@ func (m *metadata) get() []byte {
 func (m *metadata) update(u UpdateFunc) error {
 	m.Lock()
 	defer m.Unlock()
+	if m.deleted {
+		return errDeleted
+	}
 	newData, err := u(m.data)
 	if err != nil {
 		return err
 	}
+	// Update existing data on disk atomically, the in memory data is not
+	// changed if checkpoint fails.
+	if m.path != "" {
+		if err := writeFileAtomic(m.path, newData, false); err != nil {
+			return fmt.Errorf("failed to checkpoint %q: %v", m.path, err)
+		}
+	}
 	// Replace with newData, user holding the old data will not
 	// be affected.
-	// TODO(random-liu) *Update* existing data on disk atomically,
-	// return error if checkpoint failed.
 	m.data = newData
 	return nil
 }
 
-// delete deletes the data on disk atomically.
+// delete deletes the data on disk atomically by renaming the checkpoint
+// file to a deleted file, which is removed in cleanup.
 func (m *metadata) delete() error {
-	// TODO(random-liu): Hold write lock, rename the data on the disk.
+	m.Lock()
+	defer m.Unlock()
+	if m.deleted {
+		return nil
+	}
+	if m.path != "" {
+		if err := os.Rename(m.path, deletedPath(m.path)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := syncDir(filepath.Dir(m.path)); err != nil {
+			return err
+		}
+	}
+	m.deleted = true
 	return nil
 }
 
 // cleanup cleans up all temporary files left-over.
 func (m *metadata) cleanup() error {
-	// TODO(random-liu): Hold write lock, Cleanup temporary files generated
-	// in atomic file operations. The write lock makes sure there is no on-going
-	// update, so any temporary files could be removed.
+	// Hold write lock to make sure there is no on-going update.
+	m.Lock()
+	defer m.Unlock()
+	if m.path == "" {
+		return nil
+	}
+	if err := os.Remove(deletedPath(m.path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
 
@@ -121,43 +162,104 @@ func (m *metadata) cleanup() error {
 type metadataStore struct {
 	sync.RWMutex
 	metas map[string]*metadata
+	// creating is the set of ids being created. An id is reserved here
+	// before its checkpoint file is written, so that the checkpoint file
+	// is always owned by the creator.
+	creating map[string]struct{}
+	// dir is the checkpoint directory, empty means checkpoint is disabled.
+	dir string
 }
 
-// NewMetadataStore creates a MetadataStore.
+// NewMetadataStore creates an in memory MetadataStore without checkpoint,
+// which is mainly used for testing.
 func NewMetadataStore() MetadataStore {
-	// TODO(random-liu): Recover state from disk checkpoint.
-	// TODO(random-liu): Cleanup temporary files left over.
-	return &metadataStore{metas: map[string]*metadata{}}
+	return &metadataStore{metas: map[string]*metadata{}, creating: map[string]struct{}{}}
+}
+
+// NewFileMetadataStore creates a MetadataStore which checkpoints each
+// metadata into a file under the directory. All metadata is recovered from
+// the directory, and temporary files left over are cleaned up.
+func NewFileMetadataStore(dir string) (MetadataStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory %q: %v", dir, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint directory %q: %v", dir, err)
+	}
+	m := &metadataStore{metas: map[string]*metadata{}, creating: map[string]struct{}{}, dir: dir}
+	for _, f := range files {
+		path := filepath.Join(dir, f.Name())
+		if isTempFile(f.Name()) {
+			// Temporary files are left over by atomic file operations
+			// interrupted by a crash.
+			glog.V(4).Infof("Cleanup temporary checkpoint file %q", path)
+			if err := os.Remove(path); err != nil {
+				return nil, fmt.Errorf("failed to cleanup temporary file %q: %v", path, err)
+			}
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read checkpoint file %q: %v", path, err)
+		}
+		m.metas[f.Name()] = &metadata{data: data, path: path}
+	}
+	return m, nil
+}
+
+// checkpointPath returns the checkpoint file path of the id, empty is
+// returned if checkpoint is disabled.
+func (m *metadataStore) checkpointPath(id string) (string, error) {
+	if m.dir == "" {
+		return "", nil
+	}
+	if id == "" || strings.ContainsRune(id, filepath.Separator) || isTempFile(id) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid id %q", id)
+	}
+	return filepath.Join(m.dir, id), nil
 }
 
-// createMetadata creates metadata with a read-write lock
-func (m *metadataStore) createMetadata(id string, meta *metadata) error {
+// reserveID reserves the id for creation with a read-write lock.
+func (m *metadataStore) reserveID(id string) error {
 	m.Lock()
 	defer m.Unlock()
 	if _, found := m.metas[id]; found {
 		return fmt.Errorf("id %q already exists", id)
 	}
-	m.metas[id] = meta
+	if _, found := m.creating[id]; found {
+		return fmt.Errorf("id %q is being created", id)
+	}
+	m.creating[id] = struct{}{}
 	return nil
 }
 
+// releaseID releases the reserved id with a read-write lock, and adds the
+// metadata into the store if it is not nil.
+func (m *metadataStore) releaseID(id string, meta *metadata) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.creating, id)
+	if meta != nil {
+		m.metas[id] = meta
+	}
+}
+
 // Create the metadata with a specific id.
-func (m *metadataStore) Create(id string, data []byte) (retErr error) {
-	// newMetadata takes time, we may not want to lock around it.
-	meta, err := newMetadata(data)
+func (m *metadataStore) Create(id string, data []byte) error {
+	path, err := m.checkpointPath(id)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		// This should not happen, because if id already exists,
-		// newMetadata should fail to checkpoint. Add this just
-		// in case.
-		if retErr != nil {
-			meta.delete()  // nolint: errcheck
-			meta.cleanup() // nolint: errcheck
-		}
-	}()
-	return m.createMetadata(id, meta)
+	// Reserve the id first, so that nothing needs to be cleaned up after
+	// the checkpoint file is created.
+	if err := m.reserveID(id); err != nil {
+		return err
+	}
+	// newMetadata takes time, we may not want to lock around it.
+	meta, err := newMetadata(path, data)
+	m.releaseID(id, meta)
+	return err
 }
 
 // getMetadata gets metadata by id with a read lock.
@@ -183,7 +285,13 @@ func (m *metadataStore) Update(id string, u UpdateFunc) error {
 	if !found {
 		return fmt.Errorf("id %q doesn't exist", id)
 	}
-	return meta.update(u)
+	if err := meta.update(u); err != nil {
+		if err == errDeleted {
+			return fmt.Errorf("id %q doesn't exist", id)
+		}
+		return err
+	}
+	return nil
 }
 
 // listMetadata lists all metadata with a read lock.
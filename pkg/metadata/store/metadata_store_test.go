@@ -20,10 +20,15 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
+	"github.com/boltdb/bolt"
 	assertlib "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMetadata(t *testing.T) {
@@ -35,7 +40,7 @@ func TestMetadata(t *testing.T) {
 	assert := assertlib.New(t)
 
 	t.Logf("simple create and get")
-	meta, err := newMetadata(testData[0])
+	meta, err := newMetadata("", testData[0])
 	assert.NoError(err)
 	old := meta.get()
 	assert.Equal(testData[0], old)
@@ -56,70 +61,188 @@ func TestMetadata(t *testing.T) {
 
 	t.Logf("successful update should not affect existing snapshot")
 	assert.Equal(testData[0], old)
-
-	// TODO(random-liu): Test deleteCheckpoint and cleanupCheckpoint after
-	// disk based implementation is added.
 }
 
-func TestMetadataStore(t *testing.T) {
-	testIds := []string{"id-0", "id-1"}
-	testMeta := map[string][]byte{
-		testIds[0]: []byte("metadata-0"),
-		testIds[1]: []byte("metadata-1"),
-	}
+func TestMetadataCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-metadata")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test-id")
 	assert := assertlib.New(t)
 
-	m := NewMetadataStore()
-
-	t.Logf("should be empty initially")
-	metas, err := m.List()
+	t.Logf("create should checkpoint the data")
+	meta, err := newMetadata(path, []byte("test-data-1"))
 	assert.NoError(err)
-	assert.Empty(metas)
-
-	t.Logf("should be able to create metadata")
-	err = m.Create(testIds[0], testMeta[testIds[0]])
+	data, err := ioutil.ReadFile(path)
 	assert.NoError(err)
+	assert.Equal([]byte("test-data-1"), data)
 
-	t.Logf("should not be able to create metadata with the same id")
-	err = m.Create(testIds[0], testMeta[testIds[0]])
+	t.Logf("create should fail if the checkpoint already exists")
+	_, err = newMetadata(path, []byte("test-data-2"))
 	assert.Error(err)
 
-	t.Logf("should be able to list metadata")
-	err = m.Create(testIds[1], testMeta[testIds[1]])
+	t.Logf("update should checkpoint the data")
+	assert.NoError(meta.update(func([]byte) ([]byte, error) {
+		return []byte("test-data-2"), nil
+	}))
+	data, err = ioutil.ReadFile(path)
 	assert.NoError(err)
-	metas, err = m.List()
+	assert.Equal([]byte("test-data-2"), data)
+
+	t.Logf("delete should rename the checkpoint, and cleanup should remove it")
+	assert.NoError(meta.delete())
+	_, err = os.Stat(path)
+	assert.True(os.IsNotExist(err))
+	_, err = os.Stat(deletedPath(path))
 	assert.NoError(err)
-	assert.True(sliceContainsMap(metas, testMeta))
 
-	t.Logf("should be able to get metadata by id")
-	meta, err := m.Get(testIds[1])
+	t.Logf("update after delete should fail without writing the checkpoint back")
+	assert.Equal(errDeleted, meta.update(func([]byte) ([]byte, error) {
+		return []byte("test-data-3"), nil
+	}))
+	_, err = os.Stat(path)
+	assert.True(os.IsNotExist(err))
+	assert.Equal([]byte("test-data-2"), meta.get())
+
+	t.Logf("delete should be idempotent")
+	assert.NoError(meta.delete())
+	assert.NoError(meta.cleanup())
+	_, err = os.Stat(deletedPath(path))
+	assert.True(os.IsNotExist(err))
+
+	t.Logf("no temporary file should be left")
+	files, err := ioutil.ReadDir(dir)
 	assert.NoError(err)
-	assert.Equal(testMeta[testIds[1]], meta)
+	assert.Empty(files)
+}
 
-	t.Logf("update should take effect")
-	m.Update(testIds[1], func(in []byte) ([]byte, error) {
-		return []byte("updated-metadata-1"), nil
-	})
-	newMeta, err := m.Get(testIds[1])
+// newTestMetadataStores creates metadata stores of all backends for test,
+// the returned function should be called to cleanup.
+func newTestMetadataStores(t *testing.T) (map[string]MetadataStore, func()) {
+	dir, err := ioutil.TempDir("", "test-metadata-store")
+	require.NoError(t, err)
+	fileStore, err := NewFileMetadataStore(filepath.Join(dir, "file"))
+	require.NoError(t, err)
+	db, err := bolt.Open(filepath.Join(dir, "bolt.db"), 0600, nil)
+	require.NoError(t, err)
+	boltStore, err := NewBoltMetadataStore(db, "test")
+	require.NoError(t, err)
+	return map[string]MetadataStore{
+		"memory": NewMetadataStore(),
+		"file":   fileStore,
+		"bolt":   boltStore,
+	}, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBoltMetadataStoreBuckets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-metadata-store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert := assertlib.New(t)
+	path := filepath.Join(dir, "bolt.db")
+
+	db, err := bolt.Open(path, 0600, nil)
+	require.NoError(t, err)
+	m1, err := NewBoltMetadataStore(db, "bucket-1")
+	require.NoError(t, err)
+	m2, err := NewBoltMetadataStore(db, "bucket-2")
+	require.NoError(t, err)
+
+	t.Logf("different buckets should not affect each other")
+	assert.NoError(m1.Create("id", []byte("metadata-1")))
+	assert.NoError(m2.Create("id", []byte("metadata-2")))
+	assert.NoError(m2.Delete("id"))
+	meta, err := m1.Get("id")
 	assert.NoError(err)
-	assert.Equal([]byte("updated-metadata-1"), newMeta)
+	assert.Equal([]byte("metadata-1"), meta)
 
-	t.Logf("should be able to delete metadata")
-	assert.NoError(m.Delete(testIds[1]))
-	metas, err = m.List()
+	t.Logf("failed update should not take effect")
+	updateErr := errors.New("update error")
+	assert.Equal(updateErr, m1.Update("id", func([]byte) ([]byte, error) {
+		return []byte("updated"), updateErr
+	}))
+	meta, err = m1.Get("id")
 	assert.NoError(err)
-	assert.Len(metas, 1)
-	assert.Equal(testMeta[testIds[0]], metas[0])
-	meta, err = m.Get(testIds[1])
+	assert.Equal([]byte("metadata-1"), meta)
+
+	t.Logf("metadata should be persisted")
+	require.NoError(t, db.Close())
+	db, err = bolt.Open(path, 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	m1, err = NewBoltMetadataStore(db, "bucket-1")
+	require.NoError(t, err)
+	metas, err := m1.List()
 	assert.NoError(err)
-	assert.Nil(meta)
+	assert.Equal([][]byte{[]byte("metadata-1")}, metas)
+}
 
-	t.Logf("existing reference should not be affected by delete")
-	assert.Equal([]byte("updated-metadata-1"), newMeta)
+func TestMetadataStore(t *testing.T) {
+	testIds := []string{"id-0", "id-1"}
+	testMeta := map[string][]byte{
+		testIds[0]: []byte("metadata-0"),
+		testIds[1]: []byte("metadata-1"),
+	}
+	assert := assertlib.New(t)
 
-	t.Logf("should be able to reuse the same id after deletion")
-	err = m.Create(testIds[1], testMeta[testIds[1]])
-	assert.NoError(err)
+	stores, cleanup := newTestMetadataStores(t)
+	defer cleanup()
+	for backend, m := range stores {
+		t.Logf("TestCase %q", backend)
+
+		t.Logf("should be empty initially")
+		metas, err := m.List()
+		assert.NoError(err)
+		assert.Empty(metas)
+
+		t.Logf("should be able to create metadata")
+		err = m.Create(testIds[0], testMeta[testIds[0]])
+		assert.NoError(err)
+
+		t.Logf("should not be able to create metadata with the same id")
+		err = m.Create(testIds[0], testMeta[testIds[0]])
+		assert.Error(err)
+
+		t.Logf("should be able to list metadata")
+		err = m.Create(testIds[1], testMeta[testIds[1]])
+		assert.NoError(err)
+		metas, err = m.List()
+		assert.NoError(err)
+		assert.True(sliceContainsMap(metas, testMeta))
+
+		t.Logf("should be able to get metadata by id")
+		meta, err := m.Get(testIds[1])
+		assert.NoError(err)
+		assert.Equal(testMeta[testIds[1]], meta)
+
+		t.Logf("update should take effect")
+		m.Update(testIds[1], func(in []byte) ([]byte, error) {
+			return []byte("updated-metadata-1"), nil
+		})
+		newMeta, err := m.Get(testIds[1])
+		assert.NoError(err)
+		assert.Equal([]byte("updated-metadata-1"), newMeta)
+
+		t.Logf("should be able to delete metadata")
+		assert.NoError(m.Delete(testIds[1]))
+		metas, err = m.List()
+		assert.NoError(err)
+		assert.Len(metas, 1)
+		assert.Equal(testMeta[testIds[0]], metas[0])
+		meta, err = m.Get(testIds[1])
+		assert.NoError(err)
+		assert.Nil(meta)
+
+		t.Logf("existing reference should not be affected by delete")
+		assert.Equal([]byte("updated-metadata-1"), newMeta)
+
+		t.Logf("should be able to reuse the same id after deletion")
+		err = m.Create(testIds[1], testMeta[testIds[1]])
+		assert.NoError(err)
+	}
 }
 
 // sliceMatchMap checks the same elements with a map.
@@ -143,55 +266,146 @@ func sliceContainsMap(s [][]byte, m map[string][]byte) bool {
 }
 
 func TestMultithreadAccess(t *testing.T) {
-	m := NewMetadataStore()
 	assert := assertlib.New(t)
-	routineNum := 10
-	var wg sync.WaitGroup
-	for i := 0; i < routineNum; i++ {
-		wg.Add(1)
-		go func(i int) {
-			id := fmt.Sprintf("%d", i)
-
-			t.Logf("should be able to create id %q", id)
-			expect := []byte(id)
-			err := m.Create(id, expect)
-			assert.NoError(err)
-
-			got, err := m.Get(id)
-			assert.NoError(err)
-			assert.Equal(expect, got)
-
-			gotList, err := m.List()
-			assert.NoError(err)
-			assert.Contains(gotList, expect)
-
-			t.Logf("should be able to update id %q", id)
-			expect = []byte("update-" + id)
-			err = m.Update(id, func([]byte) ([]byte, error) {
-				return expect, nil
-			})
-			assert.NoError(err)
-
-			got, err = m.Get(id)
-			assert.NoError(err)
-			assert.Equal(expect, got)
-
-			t.Logf("should be able to delete id %q", id)
-			err = m.Delete(id)
-			assert.NoError(err)
-
-			got, err = m.Get(id)
-			assert.NoError(err)
-			assert.Nil(got)
-
-			gotList, err = m.List()
-			assert.NoError(err)
-			assert.NotContains(gotList, expect)
-
-			wg.Done()
-		}(i)
+	stores, cleanup := newTestMetadataStores(t)
+	defer cleanup()
+	for backend, m := range stores {
+		t.Logf("TestCase %q", backend)
+		routineNum := 10
+		var wg sync.WaitGroup
+		for i := 0; i < routineNum; i++ {
+			wg.Add(1)
+			go func(i int) {
+				id := fmt.Sprintf("%d", i)
+
+				t.Logf("should be able to create id %q", id)
+				expect := []byte(id)
+				err := m.Create(id, expect)
+				assert.NoError(err)
+
+				got, err := m.Get(id)
+				assert.NoError(err)
+				assert.Equal(expect, got)
+
+				gotList, err := m.List()
+				assert.NoError(err)
+				assert.Contains(gotList, expect)
+
+				t.Logf("should be able to update id %q", id)
+				expect = []byte("update-" + id)
+				err = m.Update(id, func([]byte) ([]byte, error) {
+					return expect, nil
+				})
+				assert.NoError(err)
+
+				got, err = m.Get(id)
+				assert.NoError(err)
+				assert.Equal(expect, got)
+
+				t.Logf("should be able to delete id %q", id)
+				err = m.Delete(id)
+				assert.NoError(err)
+
+				got, err = m.Get(id)
+				assert.NoError(err)
+				assert.Nil(got)
+
+				gotList, err = m.List()
+				assert.NoError(err)
+				assert.NotContains(gotList, expect)
+
+				wg.Done()
+			}(i)
+		}
+		wg.Wait()
 	}
-	wg.Wait()
 }
 
-// TODO(random-liu): Test recover logic once checkpoint recovery is added.
+func TestFileMetadataStoreRecover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-metadata-store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert := assertlib.New(t)
+
+	m, err := NewFileMetadataStore(dir)
+	require.NoError(t, err)
+	assert.NoError(m.Create("id-0", []byte("metadata-0")))
+	assert.NoError(m.Create("id-1", []byte("metadata-1")))
+	assert.NoError(m.Create("id-2", []byte("metadata-2")))
+	assert.NoError(m.Update("id-1", func([]byte) ([]byte, error) {
+		return []byte("updated-metadata-1"), nil
+	}))
+	assert.NoError(m.Delete("id-2"))
+
+	t.Logf("should not be able to create metadata with invalid id")
+	assert.Error(m.Create("a/b", []byte("invalid")))
+	assert.Error(m.Create(tempFilePrefix+"id", []byte("invalid")))
+
+	t.Logf("temporary files left over should be cleaned up during recovery")
+	leftovers := []string{
+		filepath.Join(dir, tempFilePrefix+"id-3-123"),
+		deletedPath(filepath.Join(dir, "id-4")),
+	}
+	for _, f := range leftovers {
+		require.NoError(t, ioutil.WriteFile(f, []byte("leftover"), 0600))
+	}
+
+	t.Logf("should recover all metadata")
+	m, err = NewFileMetadataStore(dir)
+	require.NoError(t, err)
+	metas, err := m.List()
+	assert.NoError(err)
+	assert.True(sliceContainsMap(metas, map[string][]byte{
+		"id-0": []byte("metadata-0"),
+		"id-1": []byte("updated-metadata-1"),
+	}))
+	for _, f := range leftovers {
+		_, err := os.Stat(f)
+		assert.True(os.IsNotExist(err), "%q should be removed", f)
+	}
+
+	t.Logf("recovered metadata should be updatable")
+	assert.NoError(m.Update("id-0", func([]byte) ([]byte, error) {
+		return []byte("updated-metadata-0"), nil
+	}))
+	m, err = NewFileMetadataStore(dir)
+	require.NoError(t, err)
+	meta, err := m.Get("id-0")
+	assert.NoError(err)
+	assert.Equal([]byte("updated-metadata-0"), meta)
+}
+
+func TestFileMetadataStoreCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-metadata-store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert := assertlib.New(t)
+
+	s, err := NewFileMetadataStore(dir)
+	require.NoError(t, err)
+	m := s.(*metadataStore)
+
+	t.Logf("should not be able to create metadata with an id being created")
+	require.NoError(t, m.reserveID("id-0"))
+	assert.Error(m.Create("id-0", []byte("metadata-0")))
+	m.releaseID("id-0", nil)
+	assert.NoError(m.Create("id-0", []byte("metadata-0")))
+
+	t.Logf("failed create should not remove the checkpoint file owned by others")
+	path := filepath.Join(dir, "id-1")
+	require.NoError(t, ioutil.WriteFile(path, []byte("others"), 0600))
+	assert.Error(m.Create("id-1", []byte("metadata-1")))
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal([]byte("others"), data)
+
+	t.Logf("update through a stale reference should not bring deleted metadata back")
+	meta, found := m.getMetadata("id-0")
+	require.True(t, found)
+	assert.NoError(m.Delete("id-0"))
+	assert.Error(meta.update(func([]byte) ([]byte, error) {
+		return []byte("updated-metadata-0"), nil
+	}))
+	_, err = os.Stat(filepath.Join(dir, "id-0"))
+	assert.True(os.IsNotExist(err))
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// initialVersion is the first metadata version. Metadata checkpointed
+// without version is treated as the initial version.
+const initialVersion = "v1"
+
+// migrateFunc migrates serialized metadata from one version to the next
+// version.
+type migrateFunc func([]byte) ([]byte, error)
+
+// metadataVersion is used to decode the version of serialized metadata.
+type metadataVersion struct {
+	Version string
+}
+
+// parseVersion parses a version "vN" into N.
+func parseVersion(version string) (int, error) {
+	if !strings.HasPrefix(version, "v") {
+		return 0, fmt.Errorf("invalid version %q", version)
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid version %q", version)
+	}
+	return n, nil
+}
+
+// upgradeMetadata upgrades serialized metadata to the current version. The
+// migrations map each version to the function migrating it to the next
+// version. Metadata of a newer version is refused, because it may contain
+// information which can't be handled by the current version, e.g. after a
+// downgrade.
+func upgradeMetadata(data []byte, current string, migrations map[string]migrateFunc) ([]byte, error) {
+	var v metadataVersion
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if v.Version == "" {
+		v.Version = initialVersion
+	}
+	from, err := parseVersion(v.Version)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseVersion(current)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, fmt.Errorf("unsupported version %q newer than current version %q", v.Version, current)
+	}
+	for n := from; n < to; n++ {
+		version := fmt.Sprintf("v%d", n)
+		migrate, ok := migrations[version]
+		if !ok {
+			return nil, fmt.Errorf("no migration from version %q", version)
+		}
+		if data, err = migrate(data); err != nil {
+			return nil, fmt.Errorf("failed to migrate from version %q: %v", version, err)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata/store"
+)
+
+func TestUpgradeMetadata(t *testing.T) {
+	// testMetadata is a metadata whose "Name" field is renamed to "FullName"
+	// in v2, and prefixed with "test-" in v3.
+	migrations := map[string]migrateFunc{
+		"v1": func(data []byte) ([]byte, error) {
+			var m map[string]interface{}
+			if err := json.Unmarshal(data, &m); err != nil {
+				return nil, err
+			}
+			m["FullName"] = m["Name"]
+			delete(m, "Name")
+			return json.Marshal(m)
+		},
+		"v2": func(data []byte) ([]byte, error) {
+			var m map[string]interface{}
+			if err := json.Unmarshal(data, &m); err != nil {
+				return nil, err
+			}
+			m["FullName"] = "test-" + m["FullName"].(string)
+			return json.Marshal(m)
+		},
+	}
+	for desc, test := range map[string]struct {
+		data      string
+		current   string
+		expected  string
+		expectErr bool
+	}{
+		"should not change metadata of current version": {
+			data:     `{"Version":"v3","FullName":"test-name"}`,
+			current:  "v3",
+			expected: `{"Version":"v3","FullName":"test-name"}`,
+		},
+		"should migrate metadata of older version": {
+			data:     `{"Version":"v2","FullName":"name"}`,
+			current:  "v3",
+			expected: `{"Version":"v2","FullName":"test-name"}`,
+		},
+		"should treat metadata without version as initial version": {
+			data:     `{"Name":"name"}`,
+			current:  "v3",
+			expected: `{"FullName":"test-name"}`,
+		},
+		"should return error for newer version": {
+			data:      `{"Version":"v4","FullName":"name"}`,
+			current:   "v3",
+			expectErr: true,
+		},
+		"should return error for invalid version": {
+			data:      `{"Version":"unknown","FullName":"name"}`,
+			current:   "v3",
+			expectErr: true,
+		},
+		"should return error if migration is missing": {
+			data:      `{"Version":"v3","FullName":"name"}`,
+			current:   "v4",
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		data, err := upgradeMetadata([]byte(test.data), test.current, migrations)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.JSONEq(t, test.expected, string(data))
+	}
+}
+
+func TestMetadataVersioning(t *testing.T) {
+	t.Logf("should write metadata with version")
+	s := store.NewMetadataStore()
+	require.NoError(t, s.Create("2", []byte(`{"ID":"2","Name":"Sandbox-2"}`)))
+	sandboxStore, err := NewSandboxStore(s)
+	require.NoError(t, err)
+	require.NoError(t, sandboxStore.Create(SandboxMetadata{ID: "1", Name: "Sandbox-1"}))
+	data, err := s.Get("1")
+	require.NoError(t, err)
+	var v metadataVersion
+	require.NoError(t, json.Unmarshal(data, &v))
+	assert.Equal(t, sandboxMetadataVersion, v.Version)
+
+	t.Logf("should read metadata without version")
+	meta, err := sandboxStore.Get("2")
+	require.NoError(t, err)
+	assert.Equal(t, &SandboxMetadata{ID: "2", Name: "Sandbox-2"}, meta)
+
+	t.Logf("should rewrite metadata with current version on update")
+	require.NoError(t, sandboxStore.Update("2", func(m SandboxMetadata) (SandboxMetadata, error) {
+		return m, nil
+	}))
+	data, err = s.Get("2")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &v))
+	assert.Equal(t, sandboxMetadataVersion, v.Version)
+
+	t.Logf("should refuse metadata of newer version")
+	require.NoError(t, s.Create("3", []byte(`{"Version":"v100","ID":"3"}`)))
+	_, err = NewSandboxStore(s)
+	assert.Error(t, err)
+	_, err = NewContainerStore(s)
+	assert.Error(t, err)
+	_, err = NewImageMetadataStore(s)
+	assert.Error(t, err)
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package os
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// apparmorParser is the binary used to load apparmor profiles.
+const apparmorParser = "apparmor_parser"
+
+// LoadApparmorProfile will call apparmor_parser to load the apparmor
+// profile into the kernel, or replace it if it is already loaded.
+func (RealOS) LoadApparmorProfile(profile string) error {
+	if _, err := exec.LookPath(apparmorParser); err != nil {
+		return fmt.Errorf("%s is not installed, apparmor is not available: %v", apparmorParser, err)
+	}
+	// -K skips the profile cache, -r replaces the profile if it exists.
+	cmd := exec.Command(apparmorParser, "-Kr")
+	cmd.Stdin = strings.NewReader(profile)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %v, output: %q", apparmorParser, err, out)
+	}
+	return nil
+}
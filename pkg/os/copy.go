@@ -0,0 +1,124 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package os
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// CopyDir will copy the content of the src directory into the dst
+// directory, which is created if it doesn't exist. File mode and ownership
+// are preserved, and symlinks are copied as is.
+func (RealOS) CopyDir(src, dst string) error {
+	return copyDir(src, dst)
+}
+
+// copyDir recursively copies the src directory into the dst directory.
+func copyDir(src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%q is not a directory", src)
+	}
+	if err := os.MkdirAll(dst, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := copyMetadata(dst, fi); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		s, d := filepath.Join(src, f.Name()), filepath.Join(dst, f.Name())
+		switch mode := f.Mode(); {
+		case mode.IsDir():
+			err = copyDir(s, d)
+		case mode.IsRegular():
+			err = copyFile(s, d, f)
+		case mode&os.ModeSymlink != 0:
+			err = copySymlink(s, d, f)
+		default:
+			err = copySpecialFile(d, f)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy %q: %v", s, err)
+		}
+	}
+	return nil
+}
+
+// copyFile copies a regular file.
+func copyFile(src, dst string, fi os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return copyMetadata(dst, fi)
+}
+
+// copySymlink copies a symlink without following it.
+func copySymlink(src, dst string, fi os.FileInfo) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(target, dst); err != nil {
+		return err
+	}
+	stat := fi.Sys().(*syscall.Stat_t)
+	return os.Lchown(dst, int(stat.Uid), int(stat.Gid))
+}
+
+// copySpecialFile recreates a device node, named pipe or socket.
+func copySpecialFile(dst string, fi os.FileInfo) error {
+	stat := fi.Sys().(*syscall.Stat_t)
+	if err := syscall.Mknod(dst, stat.Mode, int(stat.Rdev)); err != nil {
+		return err
+	}
+	return copyMetadata(dst, fi)
+}
+
+// copyMetadata copies the ownership and mode of a file. The mode is set
+// explicitly because it is affected by umask during creation.
+func copyMetadata(dst string, fi os.FileInfo) error {
+	stat := fi.Sys().(*syscall.Stat_t)
+	if err := os.Lchown(dst, int(stat.Uid), int(stat.Gid)); err != nil {
+		return err
+	}
+	return os.Chmod(dst, fi.Mode())
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package os
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyDir(t *testing.T) {
+	src, err := ioutil.TempDir("", "test-copy-src")
+	require.NoError(t, err)
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "test-copy-dst")
+	require.NoError(t, err)
+	defer os.RemoveAll(dst)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "sub", "file"), []byte("content"), 0640))
+	require.NoError(t, os.Symlink("sub/file", filepath.Join(src, "link")))
+
+	target := filepath.Join(dst, "target")
+	require.NoError(t, RealOS{}.CopyDir(src, target))
+
+	fi, err := os.Stat(filepath.Join(target, "sub"))
+	require.NoError(t, err)
+	assert.True(t, fi.IsDir())
+	assert.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+
+	data, err := ioutil.ReadFile(filepath.Join(target, "sub", "file"))
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(data))
+	fi, err = os.Stat(filepath.Join(target, "sub", "file"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+
+	link, err := os.Readlink(filepath.Join(target, "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "sub/file", link, "symlink should be copied as is")
+
+	t.Logf("should return error if source is not a directory")
+	assert.Error(t, RealOS{}.CopyDir(filepath.Join(src, "sub", "file"), filepath.Join(dst, "another")))
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package os
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// hostDevicesDir is the directory of devices on the host.
+const hostDevicesDir = "/dev"
+
+// errNotADevice is returned when the path is not a device.
+var errNotADevice = errors.New("not a device node")
+
+// HostDevices will return all devices under /dev on the host.
+func (RealOS) HostDevices() ([]runtimespec.LinuxDevice, error) {
+	return getDevices(hostDevicesDir)
+}
+
+// DevicesFromPath will return the device at the path, or all devices under
+// the path if it is a directory. Symlinks in the path are resolved for the
+// lookup, but the returned device paths are still under the given path.
+func (RealOS) DevicesFromPath(path string) ([]runtimespec.LinuxDevice, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		devices, err := getDevices(resolved)
+		if err != nil {
+			return nil, err
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("no device found under directory %q", path)
+		}
+		for i := range devices {
+			rel, err := filepath.Rel(resolved, devices[i].Path)
+			if err != nil {
+				return nil, err
+			}
+			devices[i].Path = filepath.Join(path, rel)
+		}
+		return devices, nil
+	}
+	device, err := deviceFromPath(resolved)
+	if err != nil {
+		return nil, err
+	}
+	device.Path = path
+	return []runtimespec.LinuxDevice{*device}, nil
+}
+
+// getDevices recursively gets all devices under a directory. Directories and
+// files which are container specific, e.g. /dev/pts and /dev/console, are
+// skipped.
+func getDevices(path string) ([]runtimespec.LinuxDevice, error) {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var devices []runtimespec.LinuxDevice
+	for _, f := range files {
+		if f.IsDir() {
+			switch f.Name() {
+			case "pts", "shm", "fd", "mqueue", ".lxc", ".lxd-mounts", ".udev":
+				continue
+			}
+			sub, err := getDevices(filepath.Join(path, f.Name()))
+			if err != nil {
+				return nil, err
+			}
+			devices = append(devices, sub...)
+			continue
+		}
+		if f.Name() == "console" {
+			continue
+		}
+		device, err := deviceFromPath(filepath.Join(path, f.Name()))
+		if err != nil {
+			if err == errNotADevice || os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		devices = append(devices, *device)
+	}
+	return devices, nil
+}
+
+// deviceFromPath gets the oci device of a device node. Symlinks are not
+// followed.
+func deviceFromPath(path string) (*runtimespec.LinuxDevice, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Lstat(path, &stat); err != nil {
+		return nil, err
+	}
+	var devType string
+	switch stat.Mode & syscall.S_IFMT {
+	case syscall.S_IFBLK:
+		devType = "b"
+	case syscall.S_IFCHR:
+		devType = "c"
+	case syscall.S_IFIFO:
+		devType = "p"
+	default:
+		return nil, errNotADevice
+	}
+	dev := uint64(stat.Rdev)
+	fileMode := os.FileMode(stat.Mode &^ syscall.S_IFMT)
+	return &runtimespec.LinuxDevice{
+		Path:     path,
+		Type:     devType,
+		Major:    int64(major(dev)),
+		Minor:    int64(minor(dev)),
+		FileMode: &fileMode,
+		UID:      &stat.Uid,
+		GID:      &stat.Gid,
+	}, nil
+}
+
+// major returns the major number of a device number. The split is the same
+// with glibc and unix.Major, which is not in the vendored x/sys yet.
+func major(dev uint64) uint32 {
+	return uint32(((dev >> 8) & 0xfff) | ((dev >> 32) & 0xfffff000))
+}
+
+// minor returns the minor number of a device number. The split is the same
+// with glibc and unix.Minor, which is not in the vendored x/sys yet.
+func minor(dev uint64) uint32 {
+	return uint32((dev & 0xff) | ((dev >> 12) & 0xffffff00))
+}
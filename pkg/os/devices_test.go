@@ -0,0 +1,122 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package os
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceFromPath(t *testing.T) {
+	device, err := deviceFromPath("/dev/null")
+	require.NoError(t, err)
+	assert.Equal(t, "/dev/null", device.Path)
+	assert.Equal(t, "c", device.Type)
+	assert.EqualValues(t, 1, device.Major)
+	assert.EqualValues(t, 3, device.Minor)
+
+	dir, err := ioutil.TempDir("", "test-devices")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, []byte{}, 0644))
+	_, err = deviceFromPath(file)
+	assert.Equal(t, errNotADevice, err)
+}
+
+func TestMajorMinor(t *testing.T) {
+	for desc, test := range map[string]struct {
+		dev   uint64
+		major uint32
+		minor uint32
+	}{
+		"small numbers": {
+			dev:   0x103,
+			major: 1,
+			minor: 3,
+		},
+		"minor number larger than 8 bits": {
+			// makedev(259, 0x123)
+			dev:   (0x103 << 8) | 0x23 | (0x100 << 12),
+			major: 259,
+			minor: 0x123,
+		},
+		"major and minor numbers larger than the old encoding": {
+			// makedev(0x12345, 0xabcdef)
+			dev:   (0x345 << 8) | (0x12000 << 32) | 0xef | (0xabcd00 << 12),
+			major: 0x12345,
+			minor: 0xabcdef,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		assert.Equal(t, test.major, major(test.dev))
+		assert.Equal(t, test.minor, minor(test.dev))
+	}
+}
+
+func TestGetDevices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-devices")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pts"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sub", "file"), []byte{}, 0644))
+	devices, err := getDevices(dir)
+	require.NoError(t, err)
+	assert.Empty(t, devices, "regular files should be skipped")
+
+	devices, err = getDevices("/dev")
+	require.NoError(t, err)
+	found := false
+	for _, d := range devices {
+		assert.NotEqual(t, "/dev/console", d.Path)
+		if d.Path == "/dev/null" {
+			found = true
+		}
+	}
+	assert.True(t, found, "/dev/null should be found")
+}
+
+func TestDevicesFromPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-devices")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	link := filepath.Join(dir, "null")
+	require.NoError(t, os.Symlink("/dev/null", link))
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, []byte{}, 0644))
+
+	devices, err := RealOS{}.DevicesFromPath(link)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, link, devices[0].Path)
+	assert.Equal(t, "c", devices[0].Type)
+
+	_, err = RealOS{}.DevicesFromPath(file)
+	assert.Equal(t, errNotADevice, err)
+
+	_, err = RealOS{}.DevicesFromPath(filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = RealOS{}.DevicesFromPath(dir)
+	assert.Error(t, err, "should return error for directory without devices")
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package os
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mountInfoFile is the mount info file of current process.
+const mountInfoFile = "/proc/self/mountinfo"
+
+// MountInfo is the mount information of a mount point.
+type MountInfo struct {
+	// Mountpoint is the path of the mount point.
+	Mountpoint string
+	// Optional are the optional fields, e.g. "shared:1" and "master:2".
+	Optional []string
+}
+
+// Shared returns whether the mount point is shared.
+func (m MountInfo) Shared() bool {
+	return m.hasOptional("shared:")
+}
+
+// Slave returns whether the mount point is a slave mount.
+func (m MountInfo) Slave() bool {
+	return m.hasOptional("master:")
+}
+
+func (m MountInfo) hasOptional(prefix string) bool {
+	for _, o := range m.Optional {
+		if strings.HasPrefix(o, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupMount will find the mount point containing the path from
+// /proc/self/mountinfo. Symlinks in the path are resolved. The path doesn't
+// need to exist, a path created later is on the mount of its ancestor.
+func (RealOS) LookupMount(path string) (MountInfo, error) {
+	path, err := evalSymlinks(path)
+	if err != nil {
+		return MountInfo{}, err
+	}
+	data, err := ioutil.ReadFile(mountInfoFile)
+	if err != nil {
+		return MountInfo{}, err
+	}
+	mounts, err := parseMountInfo(data)
+	if err != nil {
+		return MountInfo{}, fmt.Errorf("failed to parse %q: %v", mountInfoFile, err)
+	}
+	return lookupMount(mounts, path)
+}
+
+// evalSymlinks resolves symlinks in the path. If the path doesn't exist,
+// symlinks in its longest existing ancestor are resolved, and the rest of
+// the path is kept as is.
+func evalSymlinks(path string) (string, error) {
+	path = filepath.Clean(path)
+	var rest string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		parent := filepath.Dir(path)
+		if !os.IsNotExist(err) || parent == path {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// parseMountInfo parses the content of mountinfo. See proc(5) for the format.
+func parseMountInfo(data []byte) ([]MountInfo, error) {
+	var mounts []MountInfo
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		// Mount id, parent id, major:minor, root, mount point, options,
+		// optional fields, separator, filesystem type, source and super
+		// options.
+		if len(fields) < 10 {
+			return nil, fmt.Errorf("invalid mountinfo line %q", line)
+		}
+		var optional []string
+		sep := 6
+		for ; sep < len(fields) && fields[sep] != "-"; sep++ {
+			optional = append(optional, fields[sep])
+		}
+		if sep == len(fields) {
+			return nil, fmt.Errorf("no separator in mountinfo line %q", line)
+		}
+		mounts = append(mounts, MountInfo{
+			Mountpoint: fields[4],
+			Optional:   optional,
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// lookupMount finds the mount point containing the path. The longest
+// matching mount point is returned, and later mounts override earlier ones
+// on the same mount point.
+func lookupMount(mounts []MountInfo, path string) (MountInfo, error) {
+	path = filepath.Clean(path)
+	var found *MountInfo
+	for i, m := range mounts {
+		if m.Mountpoint != path && m.Mountpoint != "/" && !strings.HasPrefix(path, m.Mountpoint+"/") {
+			continue
+		}
+		if found == nil || len(m.Mountpoint) >= len(found.Mountpoint) {
+			found = &mounts[i]
+		}
+	}
+	if found == nil {
+		return MountInfo{}, fmt.Errorf("failed to find the mount point of %q", path)
+	}
+	return *found, nil
+}
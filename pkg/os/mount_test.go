@@ -0,0 +1,95 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package os
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMountInfo = `18 0 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+19 18 0:4 / /proc rw,nosuid,nodev,noexec,relatime shared:2 - proc proc rw
+20 18 8:2 / /var/lib rw,relatime master:3 - ext4 /dev/sda2 rw
+21 20 8:3 / /var/lib/private rw,relatime - ext4 /dev/sda3 rw
+22 20 8:4 / /var/lib/private rw,relatime shared:4 master:5 - ext4 /dev/sda4 rw
+`
+
+func TestParseMountInfo(t *testing.T) {
+	mounts, err := parseMountInfo([]byte(testMountInfo))
+	require.NoError(t, err)
+	assert.Equal(t, []MountInfo{
+		{Mountpoint: "/", Optional: []string{"shared:1"}},
+		{Mountpoint: "/proc", Optional: []string{"shared:2"}},
+		{Mountpoint: "/var/lib", Optional: []string{"master:3"}},
+		{Mountpoint: "/var/lib/private"},
+		{Mountpoint: "/var/lib/private", Optional: []string{"shared:4", "master:5"}},
+	}, mounts)
+
+	_, err = parseMountInfo([]byte("18 0 8:1 / / rw,relatime shared:1 ext4 /dev/sda1 rw\n"))
+	assert.Error(t, err, "should return error without separator")
+}
+
+func TestLookupMount(t *testing.T) {
+	mounts, err := parseMountInfo([]byte(testMountInfo))
+	require.NoError(t, err)
+	for path, test := range map[string]struct {
+		mountpoint string
+		shared     bool
+		slave      bool
+	}{
+		"/":                    {mountpoint: "/", shared: true},
+		"/usr/bin":             {mountpoint: "/", shared: true},
+		"/proc/1":              {mountpoint: "/proc", shared: true},
+		"/processes":           {mountpoint: "/", shared: true},
+		"/var/lib/kubelet":     {mountpoint: "/var/lib", slave: true},
+		"/var/lib/private/a/b": {mountpoint: "/var/lib/private", shared: true, slave: true},
+	} {
+		t.Logf("TestCase %q", path)
+		m, err := lookupMount(mounts, path)
+		require.NoError(t, err)
+		assert.Equal(t, test.mountpoint, m.Mountpoint)
+		assert.Equal(t, test.shared, m.Shared())
+		assert.Equal(t, test.slave, m.Slave())
+	}
+}
+
+func TestEvalSymlinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "test-eval-symlinks")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	// The temporary directory itself may be under a symlink.
+	tmp, err = filepath.EvalSymlinks(tmp)
+	require.NoError(t, err)
+	require.NoError(t, os.Mkdir(filepath.Join(tmp, "dir"), 0755))
+	require.NoError(t, os.Symlink("dir", filepath.Join(tmp, "link")))
+	for path, expected := range map[string]string{
+		filepath.Join(tmp, "link"):               filepath.Join(tmp, "dir"),
+		filepath.Join(tmp, "link", "missing"):    filepath.Join(tmp, "dir", "missing"),
+		filepath.Join(tmp, "link", "missing/a/"): filepath.Join(tmp, "dir", "missing", "a"),
+		filepath.Join(tmp, "missing", "a"):       filepath.Join(tmp, "missing", "a"),
+	} {
+		t.Logf("TestCase %q", path)
+		resolved, err := evalSymlinks(path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, resolved)
+	}
+}
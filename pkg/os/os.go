@@ -18,8 +18,11 @@ package os
 
 import (
 	"io"
+	"io/ioutil"
 	"os"
 
+	"github.com/containerd/containerd"
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/net/context"
 
 	"github.com/tonistiigi/fifo"
@@ -31,6 +34,16 @@ type OS interface {
 	MkdirAll(path string, perm os.FileMode) error
 	RemoveAll(path string) error
 	OpenFifo(ctx context.Context, fn string, flag int, perm os.FileMode) (io.ReadWriteCloser, error)
+	ReadFile(filename string) ([]byte, error)
+	MountAll(mounts []containerd.Mount, target string) error
+	Unmount(target string, flags int) error
+	HostDevices() ([]runtimespec.LinuxDevice, error)
+	DevicesFromPath(path string) ([]runtimespec.LinuxDevice, error)
+	LookupMount(path string) (MountInfo, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(dirname string) ([]os.FileInfo, error)
+	CopyDir(src, dst string) error
+	LoadApparmorProfile(profile string) error
 }
 
 // RealOS is used to dispatch the real system level operations.
@@ -50,3 +63,28 @@ func (RealOS) RemoveAll(path string) error {
 func (RealOS) OpenFifo(ctx context.Context, fn string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
 	return fifo.OpenFifo(ctx, fn, flag, perm)
 }
+
+// Stat will call os.Stat to get the file info.
+func (RealOS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// ReadDir will call ioutil.ReadDir to list the directory entries.
+func (RealOS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dirname)
+}
+
+// ReadFile will call ioutil.ReadFile to read data from a file.
+func (RealOS) ReadFile(filename string) ([]byte, error) {
+	return ioutil.ReadFile(filename)
+}
+
+// MountAll will call containerd.MountAll to mount all mounts onto the target.
+func (RealOS) MountAll(mounts []containerd.Mount, target string) error {
+	return containerd.MountAll(mounts, target)
+}
+
+// Unmount will call containerd.Unmount to unmount the target.
+func (RealOS) Unmount(target string, flags int) error {
+	return containerd.Unmount(target, flags)
+}
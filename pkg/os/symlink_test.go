@@ -0,0 +1,79 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package os
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollowSymlinkInScope(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-symlink")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "etc"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "real"), 0755))
+	require.NoError(t, os.Symlink("/etc/shadow", filepath.Join(root, "etc", "passwd")))
+	require.NoError(t, os.Symlink("../../../../group", filepath.Join(root, "etc", "group")))
+	require.NoError(t, os.Symlink("real", filepath.Join(root, "link")))
+	require.NoError(t, os.Symlink("loop", filepath.Join(root, "loop")))
+
+	for desc, test := range map[string]struct {
+		path      string
+		expected  string
+		expectErr bool
+	}{
+		"non-symlink path should be kept": {
+			path:     "etc/hostname",
+			expected: "etc/hostname",
+		},
+		"absolute symlink should be resolved in root": {
+			path:     "etc/passwd",
+			expected: "etc/shadow",
+		},
+		"relative symlink should not escape root": {
+			path:     "etc/group",
+			expected: "group",
+		},
+		"symlink in the middle of path should be resolved": {
+			path:     "link/file",
+			expected: "real/file",
+		},
+		"symlink loop should return error": {
+			path:      "loop",
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		resolved, err := FollowSymlinkInScope(filepath.Join(root, test.path), root)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(root, test.expected), resolved)
+	}
+
+	t.Logf("TestCase %q", "path outside of root should return error")
+	_, err = FollowSymlinkInScope("/etc/passwd", root)
+	assert.Error(t, err)
+}
@@ -20,6 +20,8 @@ import (
 	"io"
 	"os"
 
+	"github.com/containerd/containerd"
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/net/context"
 
 	osInterface "github.com/kubernetes-incubator/cri-containerd/pkg/os"
@@ -29,9 +31,19 @@ import (
 // If a member of the form `*Fn` is set, that function will be called in place
 // of the real call.
 type FakeOS struct {
-	MkdirAllFn  func(string, os.FileMode) error
-	RemoveAllFn func(string) error
-	OpenFifoFn  func(context.Context, string, int, os.FileMode) (io.ReadWriteCloser, error)
+	MkdirAllFn            func(string, os.FileMode) error
+	RemoveAllFn           func(string) error
+	OpenFifoFn            func(context.Context, string, int, os.FileMode) (io.ReadWriteCloser, error)
+	ReadFileFn            func(string) ([]byte, error)
+	MountAllFn            func([]containerd.Mount, string) error
+	UnmountFn             func(string, int) error
+	HostDevicesFn         func() ([]runtimespec.LinuxDevice, error)
+	LookupMountFn         func(string) (osInterface.MountInfo, error)
+	DevicesFromPathFn     func(string) ([]runtimespec.LinuxDevice, error)
+	StatFn                func(string) (os.FileInfo, error)
+	ReadDirFn             func(string) ([]os.FileInfo, error)
+	CopyDirFn             func(string, string) error
+	LoadApparmorProfileFn func(string) error
 }
 
 var _ osInterface.OS = &FakeOS{}
@@ -64,3 +76,86 @@ func (f *FakeOS) OpenFifo(ctx context.Context, fn string, flag int, perm os.File
 	}
 	return nil, nil
 }
+
+// ReadFile is a fake call that invokes ReadFileFn or just returns nil.
+func (f *FakeOS) ReadFile(filename string) ([]byte, error) {
+	if f.ReadFileFn != nil {
+		return f.ReadFileFn(filename)
+	}
+	return nil, nil
+}
+
+// MountAll is a fake call that invokes MountAllFn or just returns nil.
+func (f *FakeOS) MountAll(mounts []containerd.Mount, target string) error {
+	if f.MountAllFn != nil {
+		return f.MountAllFn(mounts, target)
+	}
+	return nil
+}
+
+// Unmount is a fake call that invokes UnmountFn or just returns nil.
+func (f *FakeOS) Unmount(target string, flags int) error {
+	if f.UnmountFn != nil {
+		return f.UnmountFn(target, flags)
+	}
+	return nil
+}
+
+// HostDevices is a fake call that invokes HostDevicesFn or just returns nil.
+func (f *FakeOS) HostDevices() ([]runtimespec.LinuxDevice, error) {
+	if f.HostDevicesFn != nil {
+		return f.HostDevicesFn()
+	}
+	return nil, nil
+}
+
+// LookupMount is a fake call that invokes LookupMountFn or just returns an
+// empty mount info.
+func (f *FakeOS) LookupMount(path string) (osInterface.MountInfo, error) {
+	if f.LookupMountFn != nil {
+		return f.LookupMountFn(path)
+	}
+	return osInterface.MountInfo{}, nil
+}
+
+// Stat is a fake call that invokes StatFn or just returns nil.
+func (f *FakeOS) Stat(name string) (os.FileInfo, error) {
+	if f.StatFn != nil {
+		return f.StatFn(name)
+	}
+	return nil, nil
+}
+
+// ReadDir is a fake call that invokes ReadDirFn or just returns nil.
+func (f *FakeOS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	if f.ReadDirFn != nil {
+		return f.ReadDirFn(dirname)
+	}
+	return nil, nil
+}
+
+// DevicesFromPath is a fake call that invokes DevicesFromPathFn or just
+// returns nil.
+func (f *FakeOS) DevicesFromPath(path string) ([]runtimespec.LinuxDevice, error) {
+	if f.DevicesFromPathFn != nil {
+		return f.DevicesFromPathFn(path)
+	}
+	return nil, nil
+}
+
+// CopyDir is a fake call that invokes CopyDirFn or just returns nil.
+func (f *FakeOS) CopyDir(src, dst string) error {
+	if f.CopyDirFn != nil {
+		return f.CopyDirFn(src, dst)
+	}
+	return nil
+}
+
+// LoadApparmorProfile is a fake call that invokes LoadApparmorProfileFn or
+// just returns nil.
+func (f *FakeOS) LoadApparmorProfile(profile string) error {
+	if f.LoadApparmorProfileFn != nil {
+		return f.LoadApparmorProfileFn(profile)
+	}
+	return nil
+}
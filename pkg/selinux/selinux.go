@@ -0,0 +1,208 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selinux
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/runc/libcontainer/system"
+)
+
+const (
+	// xattrName is the extended attribute storing the selinux label of a file.
+	xattrName = "security.selinux"
+	// selinuxConfig is the selinux config file.
+	selinuxConfig = "/etc/selinux/config"
+	// selinuxTypeKey is the key of the selinux policy type in the config file.
+	selinuxTypeKey = "SELINUXTYPE"
+	// lxcContextsFormat is the format of the file containing default labels for
+	// containers of a policy type.
+	lxcContextsFormat = "/etc/selinux/%s/contexts/lxc_contexts"
+	// mountinfo is the mount info file of current process.
+	mountinfo = "/proc/self/mountinfo"
+	// selinuxfsType is the filesystem type of selinuxfs.
+	selinuxfsType = "selinuxfs"
+
+	// defaultProcessLabel is the process label used when lxc_contexts is not
+	// available.
+	defaultProcessLabel = "system_u:system_r:svirt_lxc_net_t:s0"
+	// defaultMountLabel is the mount label used when lxc_contexts is not
+	// available.
+	defaultMountLabel = "system_u:object_r:svirt_sandbox_file_t:s0"
+)
+
+var (
+	enabled     bool
+	enabledOnce sync.Once
+)
+
+// Enabled returns whether selinux is enabled on the host. Selinux is
+// considered enabled when selinuxfs is mounted.
+func Enabled() bool {
+	enabledOnce.Do(func() {
+		mnt := findSelinuxfsMount()
+		if mnt == "" {
+			return
+		}
+		if _, err := os.Stat(filepath.Join(mnt, "enforce")); err != nil {
+			return
+		}
+		enabled = true
+	})
+	return enabled
+}
+
+// findSelinuxfsMount returns the mount point of selinuxfs, or empty string
+// if selinuxfs is not mounted.
+func findSelinuxfsMount() string {
+	data, err := ioutil.ReadFile(mountinfo)
+	if err != nil {
+		return ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// See proc(5) for the format of mountinfo, the filesystem type is the
+		// first field after the separator "-".
+		fields := strings.Split(scanner.Text(), " - ")
+		if len(fields) != 2 {
+			continue
+		}
+		pre, post := strings.Fields(fields[0]), strings.Fields(fields[1])
+		if len(pre) < 5 || len(post) < 1 {
+			continue
+		}
+		if post[0] == selinuxfsType {
+			return pre[4]
+		}
+	}
+	return ""
+}
+
+// Context is a selinux security context.
+type Context struct {
+	User  string
+	Role  string
+	Type  string
+	Level string
+}
+
+// NewContext parses a selinux label in the format of "user:role:type[:level]".
+// The level could contain ":", e.g. "s0:c1,c2".
+func NewContext(label string) (Context, error) {
+	parts := strings.SplitN(label, ":", 4)
+	if len(parts) < 3 {
+		return Context{}, fmt.Errorf("invalid selinux label %q", label)
+	}
+	c := Context{User: parts[0], Role: parts[1], Type: parts[2]}
+	if len(parts) == 4 {
+		c.Level = parts[3]
+	}
+	return c, nil
+}
+
+// String returns the label of the context.
+func (c Context) String() string {
+	label := strings.Join([]string{c.User, c.Role, c.Type}, ":")
+	if c.Level != "" {
+		label += ":" + c.Level
+	}
+	return label
+}
+
+// DefaultLabels returns the default process label and mount label for
+// containers defined by the selinux policy.
+func DefaultLabels() (string, string) {
+	policyType, err := readPolicyType()
+	if err != nil {
+		return defaultProcessLabel, defaultMountLabel
+	}
+	data, err := ioutil.ReadFile(fmt.Sprintf(lxcContextsFormat, policyType))
+	if err != nil {
+		return defaultProcessLabel, defaultMountLabel
+	}
+	return parseLXCContexts(data)
+}
+
+// readPolicyType reads the selinux policy type from the selinux config file.
+func readPolicyType() (string, error) {
+	data, err := ioutil.ReadFile(selinuxConfig)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == selinuxTypeKey {
+			return strings.Trim(strings.TrimSpace(kv[1]), "\""), nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in %q", selinuxTypeKey, selinuxConfig)
+}
+
+// parseLXCContexts parses the "process" and "file" labels from lxc_contexts.
+// Each line is in the format of `key = "label"`. Defaults are returned for
+// missing labels.
+func parseLXCContexts(data []byte) (string, string) {
+	processLabel, mountLabel := defaultProcessLabel, defaultMountLabel
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.Trim(strings.TrimSpace(kv[1]), "\"")
+		switch strings.TrimSpace(kv[0]) {
+		case "process":
+			processLabel = value
+		case "file":
+			mountLabel = value
+		}
+	}
+	return processLabel, mountLabel
+}
+
+// Relabel recursively sets the selinux label of path and all files under it.
+// It refuses to relabel system directories.
+func Relabel(path, label string) error {
+	if label == "" {
+		return nil
+	}
+	path = filepath.Clean(path)
+	for _, p := range []string{"/", "/usr", "/etc", "/proc", "/sys", "/dev"} {
+		if path == p {
+			return fmt.Errorf("relabeling system directory %q is not allowed", path)
+		}
+	}
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := system.Lsetxattr(p, xattrName, []byte(label), 0); err != nil {
+			return fmt.Errorf("failed to set label %q on %q: %v", label, p, err)
+		}
+		return nil
+	})
+}
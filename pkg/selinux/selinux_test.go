@@ -0,0 +1,81 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selinux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	for label, test := range map[string]struct {
+		expected  Context
+		expectErr bool
+	}{
+		"system_u:system_r:svirt_lxc_net_t": {
+			expected: Context{User: "system_u", Role: "system_r", Type: "svirt_lxc_net_t"},
+		},
+		"system_u:system_r:svirt_lxc_net_t:s0": {
+			expected: Context{User: "system_u", Role: "system_r", Type: "svirt_lxc_net_t", Level: "s0"},
+		},
+		"system_u:system_r:svirt_lxc_net_t:s0:c1,c2": {
+			expected: Context{User: "system_u", Role: "system_r", Type: "svirt_lxc_net_t", Level: "s0:c1,c2"},
+		},
+		"system_u:system_r": {
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", label)
+		c, err := NewContext(label)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, c)
+		assert.Equal(t, label, c.String())
+	}
+}
+
+func TestParseLXCContexts(t *testing.T) {
+	for desc, test := range map[string]struct {
+		data          string
+		expectProcess string
+		expectMount   string
+	}{
+		"should parse process and file labels": {
+			data: `# comment
+process = "system_u:system_r:container_t:s0"
+content = "system_u:object_r:virt_var_lib_t:s0"
+file = "system_u:object_r:container_file_t:s0"
+`,
+			expectProcess: "system_u:system_r:container_t:s0",
+			expectMount:   "system_u:object_r:container_file_t:s0",
+		},
+		"should return defaults for missing labels": {
+			data:          `content = "system_u:object_r:virt_var_lib_t:s0"`,
+			expectProcess: defaultProcessLabel,
+			expectMount:   defaultMountLabel,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		process, mount := parseLXCContexts([]byte(test.data))
+		assert.Equal(t, test.expectProcess, process)
+		assert.Equal(t, test.expectMount, mount)
+	}
+}
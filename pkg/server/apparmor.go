@@ -0,0 +1,79 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+)
+
+// defaultApparmorProfileTemplate is the template of the apparmor profile
+// used for "runtime/default". It is derived from the docker default profile,
+// and is loaded by cri-containerd itself so that it doesn't rely on profiles
+// loaded by other container runtimes.
+const defaultApparmorProfileTemplate = `#include <tunables/global>
+
+profile %s flags=(attach_disconnected,mediate_deleted) {
+  #include <abstractions/base>
+
+  network,
+  capability,
+  file,
+  umount,
+
+  # deny write for all files directly in /proc (not in a subdir)
+  deny @{PROC}/* w,
+  # deny write to files not in /proc/<number>/** or /proc/sys/**
+  deny @{PROC}/{[^1-9],[^1-9][^0-9],[^1-9s][^0-9y][^0-9s],[^1-9][^0-9][^0-9][^0-9]*}/** w,
+  # deny /proc/sys except /proc/sys/k* (effectively /proc/sys/kernel)
+  deny @{PROC}/sys/[^k]** w,
+  # deny everything except shm* in /proc/sys/kernel/
+  deny @{PROC}/sys/kernel/{?,??,[^s][^h][^m]**} w,
+  deny @{PROC}/sysrq-trigger rwklx,
+  deny @{PROC}/kcore rwklx,
+
+  deny mount,
+
+  deny /sys/[^f]*/** wklx,
+  deny /sys/f[^s]*/** wklx,
+  deny /sys/fs/[^c]*/** wklx,
+  deny /sys/fs/c[^g]*/** wklx,
+  deny /sys/fs/cg[^r]*/** wklx,
+  deny /sys/firmware/** rwklx,
+  deny /sys/kernel/security/** rwklx,
+}
+`
+
+// loadDefaultApparmorProfile loads the cri-containerd default apparmor
+// profile if apparmor is enabled on the host and the profile is not loaded
+// yet.
+func (c *criContainerdService) loadDefaultApparmorProfile() error {
+	if !c.isApparmorEnabled() {
+		return nil
+	}
+	loaded, err := c.isApparmorProfileLoaded(defaultApparmorProfile)
+	if err != nil {
+		return fmt.Errorf("failed to check apparmor profile %q: %v", defaultApparmorProfile, err)
+	}
+	if loaded {
+		return nil
+	}
+	profile := fmt.Sprintf(defaultApparmorProfileTemplate, defaultApparmorProfile)
+	if err := c.os.LoadApparmorProfile(profile); err != nil {
+		return fmt.Errorf("failed to load apparmor profile %q: %v", defaultApparmorProfile, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ostesting "github.com/kubernetes-incubator/cri-containerd/pkg/os/testing"
+)
+
+func TestLoadDefaultApparmorProfile(t *testing.T) {
+	for desc, test := range map[string]struct {
+		disabled   bool
+		profiles   string
+		loadErr    error
+		expectLoad bool
+		expectErr  bool
+	}{
+		"should not load profile when apparmor is disabled": {
+			disabled: true,
+		},
+		"should not load profile when it is already loaded": {
+			profiles: defaultApparmorProfile + " (enforce)\n",
+		},
+		"should load profile when it is not loaded": {
+			profiles:   "docker-default (enforce)\n",
+			expectLoad: true,
+		},
+		"should return error when loading fails": {
+			loadErr:    errors.New("load error"),
+			expectLoad: true,
+			expectErr:  true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		fakeOS := c.os.(*ostesting.FakeOS)
+		fakeOS.ReadFileFn = func(filename string) ([]byte, error) {
+			switch filename {
+			case apparmorEnabledFile:
+				if test.disabled {
+					return []byte("N\n"), nil
+				}
+				return []byte("Y\n"), nil
+			case apparmorProfilesFile:
+				return []byte(test.profiles), nil
+			}
+			return nil, fmt.Errorf("unexpected file %q", filename)
+		}
+		var loaded string
+		fakeOS.LoadApparmorProfileFn = func(profile string) error {
+			loaded = profile
+			return test.loadErr
+		}
+		err := c.loadDefaultApparmorProfile()
+		if test.expectErr {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+		if !test.expectLoad {
+			assert.Empty(t, loaded)
+			continue
+		}
+		assert.Contains(t, loaded, "profile "+defaultApparmorProfile+" ")
+	}
+}
@@ -17,14 +17,826 @@ limitations under the License.
 package server
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	prototypes "github.com/gogo/protobuf/types"
+	"github.com/golang/glog"
+	"github.com/opencontainers/go-digest"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
 	"golang.org/x/net/context"
 
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/api/services/execution"
+	rootfsapi "github.com/containerd/containerd/api/services/rootfs"
+	"github.com/containerd/containerd/api/types/container"
+	"github.com/containerd/containerd/api/types/mount"
+
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+	osinterface "github.com/kubernetes-incubator/cri-containerd/pkg/os"
+	"github.com/kubernetes-incubator/cri-containerd/pkg/selinux"
+	"github.com/kubernetes-incubator/cri-containerd/pkg/user"
 )
 
 // CreateContainer creates a new container in the given PodSandbox.
-func (c *criContainerdService) CreateContainer(ctx context.Context, r *runtime.CreateContainerRequest) (*runtime.CreateContainerResponse, error) {
-	return nil, errors.New("not implemented")
+func (c *criContainerdService) CreateContainer(ctx context.Context, r *runtime.CreateContainerRequest) (retRes *runtime.CreateContainerResponse, retErr error) {
+	glog.V(2).Infof("CreateContainer within sandbox %q with container config %+v and sandbox config %+v",
+		r.GetPodSandboxId(), r.GetConfig(), r.GetSandboxConfig())
+	defer func() {
+		if retErr == nil {
+			glog.V(2).Infof("CreateContainer returns container id %q", retRes.GetContainerId())
+		}
+	}()
+
+	config := r.GetConfig()
+	sandboxConfig := r.GetSandboxConfig()
+	sandbox, err := c.getSandbox(r.GetPodSandboxId())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sandbox %q: %v", r.GetPodSandboxId(), err)
+	}
+	if sandbox == nil {
+		return nil, fmt.Errorf("sandbox %q does not exist", r.GetPodSandboxId())
+	}
+	// Use the full sandbox id.
+	sandboxID := sandbox.ID
+
+	// Get the sandbox container pid, the container will join namespaces of
+	// the sandbox container.
+	info, err := c.containerService.Info(ctx, &execution.InfoRequest{ID: sandboxID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sandbox container %q info: %v", sandboxID, err)
+	}
+	if info.Status != container.Status_RUNNING {
+		return nil, fmt.Errorf("sandbox container %q is not running", sandboxID)
+	}
+	sandboxPid := info.Pid
+
+	// Generate unique id and name for the container and reserve the name.
+	// Reserve the container name to avoid concurrent `CreateContainer` request creating
+	// the same container.
+	id := generateID()
+	name := makeContainerName(config.GetMetadata(), sandboxConfig.GetMetadata())
+	if err := c.containerNameIndex.Reserve(name, id); err != nil {
+		return nil, fmt.Errorf("failed to reserve container name %q: %v", name, err)
+	}
+	defer func() {
+		// Release the name if the function returns with an error.
+		if retErr != nil {
+			c.containerNameIndex.ReleaseByName(name)
+		}
+	}()
+	// Register the container id.
+	if err := c.containerIDIndex.Add(id); err != nil {
+		return nil, fmt.Errorf("failed to insert container id %q: %v", id, err)
+	}
+	defer func() {
+		// Delete the container id if the function returns with an error.
+		if retErr != nil {
+			c.containerIDIndex.Delete(id) // nolint: errcheck
+		}
+	}()
+
+	// Create initial container metadata.
+	meta := metadata.ContainerMetadata{
+		ID:        id,
+		Name:      name,
+		SandboxID: sandboxID,
+		Config:    config,
+	}
+
+	// Prepare container rootfs.
+	image := config.GetImage().GetImage()
+	imageMeta, err := c.localResolve(image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve image %q: %v", image, err)
+	}
+	if imageMeta == nil {
+		return nil, fmt.Errorf("image %q not found", image)
+	}
+	meta.ImageRef = imageMeta.ID
+	prepareResp, err := c.rootfsService.Prepare(ctx, &rootfsapi.PrepareRequest{
+		Name:    id,
+		ChainID: digest.Digest(imageMeta.ChainID),
+		// Readonly rootfs is set in the oci spec.
+		Readonly: false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare container rootfs %q: %v", imageMeta.ChainID, err)
+	}
+	defer func() {
+		if retErr != nil {
+			// Cleanup the writable layer of the container rootfs.
+			if err := c.removeWritableLayer(prepareResp.Mounts); err != nil {
+				glog.Errorf("Failed to remove writable layer of container %q: %v", id, err)
+			}
+		}
+	}()
+
+	// Create container root directory.
+	containerRootDir := getContainerRootDir(c.rootDir, id)
+	if err := c.os.MkdirAll(containerRootDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create container root directory %q: %v",
+			containerRootDir, err)
+	}
+	defer func() {
+		if retErr != nil {
+			// Cleanup the container root directory.
+			if err := c.os.RemoveAll(containerRootDir); err != nil {
+				glog.Errorf("Failed to remove container root directory %q: %v",
+					containerRootDir, err)
+			}
+		}
+	}()
+
+	// Generate mounts for image volumes which are not covered by CRI mounts.
+	volumeMounts := generateVolumeMounts(containerRootDir, config.GetMounts(), imageMeta.Config)
+
+	// Resolve the user of the container process, create the working
+	// directory in the container rootfs if it doesn't exist, and set up
+	// the image volumes with the content in the image.
+	userSpec, err := getContainerUserSpec(config.GetLinux().GetSecurityContext(), imageMeta.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user of container: %v", err)
+	}
+	runAsNonRoot := getRunAsNonRoot(sandboxConfig.GetAnnotations(), config.GetMetadata().GetName())
+	workingDir := getContainerWorkingDir(config, imageMeta.Config)
+	var execUser *user.ExecUser
+	if err := c.withContainerRootfs(containerRootDir, prepareResp.Mounts, func(rootfs string) error {
+		var err error
+		execUser, err = c.resolveContainerUser(userSpec, rootfs)
+		if err != nil {
+			return fmt.Errorf("failed to resolve user %q: %v", userSpec, err)
+		}
+		if runAsNonRoot && execUser.UID == 0 {
+			return fmt.Errorf("container is required to run as non-root user, but user %q resolves to uid 0", userSpec)
+		}
+		if err := c.ensureWorkingDir(rootfs, workingDir); err != nil {
+			return fmt.Errorf("failed to create working directory %q: %v", workingDir, err)
+		}
+		if err := c.setupVolumes(rootfs, volumeMounts); err != nil {
+			return fmt.Errorf("failed to set up image volumes: %v", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Initialize selinux labels of the container.
+	processLabel, mountLabel, err := c.initContainerSelinuxLabels(
+		config.GetLinux().GetSecurityContext().GetSelinuxOptions(), sandbox)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init selinux labels: %v", err)
+	}
+
+	// Generate the spec before touching host paths of mounts, so that mounts
+	// and their propagation are validated before anything is created on the
+	// host.
+	spec, err := c.generateContainerSpec(id, sandboxID, sandboxPid, config, sandboxConfig, imageMeta.Config, volumeMounts,
+		execUser, processLabel, mountLabel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate container %q spec: %v", id, err)
+	}
+
+	// Create missing host paths of mounts.
+	if err := c.ensureMountHostPaths(config.GetMounts()); err != nil {
+		return nil, fmt.Errorf("failed to create mount host paths: %v", err)
+	}
+
+	// Relabel the host paths of mounts which require relabeling.
+	mounts := append(append([]*runtime.Mount{}, volumeMounts...), config.GetMounts()...)
+	if err := c.relabelMounts(mounts, mountLabel); err != nil {
+		return nil, fmt.Errorf("failed to relabel mounts: %v", err)
+	}
+	meta.StopSignal = imageMeta.StopSignal
+	if config.GetLinux().GetSecurityContext().GetPrivileged() {
+		meta.SecurityRelaxations = append([]string{}, privilegedRelaxations...)
+	}
+	rawSpec, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal oci spec %+v: %v", spec, err)
+	}
+	glog.V(4).Infof("Container spec: %+v", spec)
+
+	// Prepare container stdout and stderr named pipe.
+	// TODO(agent): [P1] Support container stdin.
+	_, stdout, stderr := getStreamingPipes(containerRootDir)
+	var pipes []io.ReadCloser
+	for _, p := range []string{stdout, stderr} {
+		f, err := c.os.OpenFifo(ctx, p, syscall.O_RDONLY|syscall.O_CREAT|syscall.O_NONBLOCK, 0700)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open named pipe %q: %v", p, err)
+		}
+		defer func(c io.Closer) {
+			if retErr != nil {
+				c.Close()
+			}
+		}(f)
+		pipes = append(pipes, f)
+	}
+	logPath := getContainerLogPath(sandboxConfig, config)
+	if err := redirectLogs(logPath, pipes...); err != nil {
+		return nil, fmt.Errorf("failed to redirect container logs to %q: %v", logPath, err)
+	}
+
+	createOpts := &execution.CreateRequest{
+		ID: id,
+		Spec: &prototypes.Any{
+			TypeUrl: runtimespec.Version,
+			Value:   rawSpec,
+		},
+		Rootfs:   prepareResp.Mounts,
+		Runtime:  defaultRuntime,
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Terminal: config.GetTty(),
+	}
+	glog.V(5).Infof("Create container (id=%q, name=%q) with options %+v.",
+		id, name, createOpts)
+	createResp, err := c.containerService.Create(ctx, createOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container %q in containerd: %v", id, err)
+	}
+	c.stateCache.create(id, createResp.Pid)
+	defer func() {
+		if retErr != nil {
+			// Cleanup the container if an error is returned.
+			if _, err := c.containerService.Delete(ctx, &execution.DeleteRequest{ID: id}); err != nil {
+				glog.Errorf("Failed to delete container %q: %v", id, err)
+				return
+			}
+			c.stateCache.delete(id)
+		}
+	}()
+
+	// Add container into container store.
+	meta.Pid = createResp.Pid
+	meta.CreatedAt = time.Now().UnixNano()
+	if err := c.containerStore.Create(meta); err != nil {
+		return nil, fmt.Errorf("failed to add container metadata %+v into store: %v",
+			meta, err)
+	}
+
+	return &runtime.CreateContainerResponse{ContainerId: id}, nil
+}
+
+func (c *criContainerdService) generateContainerSpec(id, sandboxID string, sandboxPid uint32, config *runtime.ContainerConfig,
+	sandboxConfig *runtime.PodSandboxConfig, imageConfig *imagespec.ImageConfig, extraMounts []*runtime.Mount,
+	execUser *user.ExecUser, processLabel, mountLabel string) (*runtimespec.Spec, error) {
+	// Creates a spec Generator with the default spec.
+	g := c.newSpecGenerator()
+
+	args := getContainerArgs(config, imageConfig)
+	if len(args) == 0 {
+		return nil, errors.New("no command specified")
+	}
+	g.SetProcessArgs(args)
+
+	addOwnershipAnnotations(&g, c.instanceID, sandboxID, containerKindContainer)
+
+	if workingDir := getContainerWorkingDir(config, imageConfig); workingDir != "" {
+		g.SetProcessCwd(workingDir)
+	}
+
+	// Apply envs from image config first, so that CRI envs override them.
+	if imageConfig != nil {
+		for _, e := range imageConfig.Env {
+			kv := strings.SplitN(e, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid image env %q", e)
+			}
+			g.AddProcessEnv(kv[0], kv[1])
+		}
+	}
+	for _, e := range config.GetEnvs() {
+		g.AddProcessEnv(e.GetKey(), e.GetValue())
+	}
+
+	g.SetProcessTerminal(config.GetTty())
+	if config.GetTty() {
+		g.AddProcessEnv("TERM", "xterm")
+	}
+
+	securityContext := config.GetLinux().GetSecurityContext()
+
+	g.SetRootReadonly(securityContext.GetReadonlyRootfs())
+
+	// Add extra mounts, e.g. image volumes, and CRI mounts.
+	mounts := append(append([]*runtime.Mount{}, extraMounts...), config.GetMounts()...)
+	if err := c.addOCIBindMounts(&g, mounts, config.GetAnnotations()); err != nil {
+		return nil, fmt.Errorf("failed to set mounts: %v", err)
+	}
+
+	// Add CRI devices.
+	if err := c.addOCIDevices(&g, config.GetDevices()); err != nil {
+		return nil, fmt.Errorf("failed to set devices: %v", err)
+	}
+
+	// Set cgroups parent, the default cgroups parent is used if it's not
+	// specified.
+	cgroupsPath, err := c.getCgroupsPath(sandboxConfig.GetLinux().GetCgroupParent(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cgroups path: %v", err)
+	}
+	g.SetLinuxCgroupsPath(cgroupsPath)
+
+	// Set namespaces, share namespace with sandbox container.
+	setOCINamespaces(&g, securityContext.GetNamespaceOptions(), sandboxPid)
+
+	// Set selinux labels.
+	setOCISelinux(&g, processLabel, mountLabel)
+
+	// Set user.
+	g.SetProcessUID(execUser.UID)
+	g.SetProcessGID(execUser.GID)
+
+	// Set supplemental groups. Groups of the user in the image, the sandbox
+	// and the container are all added, duplicated ones are ignored.
+	for _, group := range execUser.Sgids {
+		g.AddProcessAdditionalGid(group)
+	}
+	for _, group := range sandboxConfig.GetLinux().GetSecurityContext().GetSupplementalGroups() {
+		g.AddProcessAdditionalGid(uint32(group))
+	}
+	for _, group := range securityContext.GetSupplementalGroups() {
+		g.AddProcessAdditionalGid(uint32(group))
+	}
+
+	// Set capabilities, privileged mode overrides them.
+	if err := setOCICapabilities(&g, securityContext.GetCapabilities()); err != nil {
+		return nil, fmt.Errorf("failed to set capabilities: %v", err)
+	}
+
+	if securityContext.GetPrivileged() {
+		if !sandboxConfig.GetLinux().GetSecurityContext().GetPrivileged() {
+			return nil, errors.New("no privileged container allowed in non-privileged sandbox")
+		}
+		// Privileged mode overrides apparmor and seccomp profiles.
+		if err := c.setOCIPrivileged(&g); err != nil {
+			return nil, fmt.Errorf("failed to set privileged: %v", err)
+		}
+	} else {
+		// Set apparmor profile from the pod annotations.
+		apparmorProfile := getApparmorProfile(sandboxConfig.GetAnnotations(), config.GetMetadata().GetName())
+		if err := c.setOCIApparmor(&g, apparmorProfile); err != nil {
+			return nil, fmt.Errorf("failed to set apparmor profile: %v", err)
+		}
+
+		// Set seccomp profile from the pod annotations.
+		seccompProfile := getSeccompProfile(sandboxConfig.GetAnnotations(), config.GetMetadata().GetName())
+		if err := c.setOCISeccomp(&g, seccompProfile); err != nil {
+			return nil, fmt.Errorf("failed to set seccomp profile: %v", err)
+		}
+	}
+
+	// Set container resource limit.
+	setOCILinuxResource(&g, config.GetLinux().GetResources())
+
+	return g.Spec(), nil
 }
+
+// addOCIBindMounts adds CRI mounts as bind mounts into the oci spec. Default
+// mounts with the same container path are replaced. The mount propagation is
+// rprivate by default, and could be overridden by the container annotation
+// mountPropagationAnnotationKeyPrefix + container path.
+// TODO(agent): [P1] Use the mount propagation field after it is added
+// into CRI.
+func (c *criContainerdService) addOCIBindMounts(g *generate.Generator, mounts []*runtime.Mount, annotations map[string]string) error {
+	spec := g.Spec()
+	for _, mount := range mounts {
+		dst := mount.GetContainerPath()
+		src := mount.GetHostPath()
+		if !filepath.IsAbs(dst) {
+			return fmt.Errorf("mount container path %q is not absolute", dst)
+		}
+		// Remove the default mount with the same container path.
+		var specMounts []runtimespec.Mount
+		for _, m := range spec.Mounts {
+			if filepath.Clean(m.Destination) != filepath.Clean(dst) {
+				specMounts = append(specMounts, m)
+			}
+		}
+		spec.Mounts = specMounts
+
+		options := []string{"rbind"}
+		propagation := annotations[mountPropagationAnnotationKeyPrefix+dst]
+		switch propagation {
+		case "", mountPropagationPrivate:
+			options = append(options, mountPropagationPrivate)
+		case mountPropagationShared:
+			mountInfo, err := c.os.LookupMount(src)
+			if err != nil {
+				return fmt.Errorf("failed to lookup mount of %q: %v", src, err)
+			}
+			if !mountInfo.Shared() {
+				return fmt.Errorf("path %q is mounted on %q but it is not a shared mount",
+					src, mountInfo.Mountpoint)
+			}
+			options = append(options, mountPropagationShared)
+			// The rootfs should be shared for the shared mount to propagate
+			// to the host.
+			g.SetLinuxRootPropagation(mountPropagationShared) // nolint: errcheck
+		case mountPropagationSlave:
+			mountInfo, err := c.os.LookupMount(src)
+			if err != nil {
+				return fmt.Errorf("failed to lookup mount of %q: %v", src, err)
+			}
+			if !mountInfo.Shared() && !mountInfo.Slave() {
+				return fmt.Errorf("path %q is mounted on %q but it is not a shared or slave mount",
+					src, mountInfo.Mountpoint)
+			}
+			options = append(options, mountPropagationSlave)
+			// The rootfs should be at least slave for the mount to receive
+			// propagation from the host.
+			if spec.Linux.RootfsPropagation != mountPropagationShared {
+				g.SetLinuxRootPropagation(mountPropagationSlave) // nolint: errcheck
+			}
+		default:
+			return fmt.Errorf("unsupported mount propagation %q for %q", propagation, dst)
+		}
+		if mount.GetReadonly() {
+			options = append(options, "ro")
+		} else {
+			options = append(options, "rw")
+		}
+		g.AddBindMount(src, dst, options)
+	}
+	return nil
+}
+
+// addOCIDevices adds CRI devices into the oci spec, and allows access to them
+// in device cgroup with the requested permissions. If the host path is a
+// directory, all devices under it are added under the container path.
+func (c *criContainerdService) addOCIDevices(g *generate.Generator, devices []*runtime.Device) error {
+	spec := g.Spec()
+	for _, device := range devices {
+		if !filepath.IsAbs(device.GetContainerPath()) {
+			return fmt.Errorf("device container path %q of %q is not absolute",
+				device.GetContainerPath(), device.GetHostPath())
+		}
+		permissions := device.GetPermissions()
+		if permissions == "" {
+			permissions = defaultDevicePermissions
+		}
+		if err := validateDevicePermissions(permissions); err != nil {
+			return fmt.Errorf("invalid permissions of device %q: %v", device.GetHostPath(), err)
+		}
+		hostPath := filepath.Clean(device.GetHostPath())
+		hostDevices, err := c.os.DevicesFromPath(hostPath)
+		if err != nil {
+			return fmt.Errorf("failed to get device %q: %v", device.GetHostPath(), err)
+		}
+		for _, dev := range hostDevices {
+			// Devices under a host directory keep their relative paths under
+			// the container path.
+			rel, err := filepath.Rel(hostPath, dev.Path)
+			if err != nil {
+				return fmt.Errorf("failed to get relative path of device %q: %v", dev.Path, err)
+			}
+			dev.Path = filepath.Join(device.GetContainerPath(), rel)
+			g.AddDevice(dev)
+			major, minor := dev.Major, dev.Minor
+			spec.Linux.Resources.Devices = append(spec.Linux.Resources.Devices, runtimespec.LinuxDeviceCgroup{
+				Allow:  true,
+				Type:   dev.Type,
+				Major:  &major,
+				Minor:  &minor,
+				Access: permissions,
+			})
+		}
+	}
+	return nil
+}
+
+// validateDevicePermissions validates device cgroup permissions, which should
+// be one or more of "r", "w" and "m".
+func validateDevicePermissions(permissions string) error {
+	for _, p := range permissions {
+		if !strings.ContainsRune(defaultDevicePermissions, p) {
+			return fmt.Errorf("unknown permission %q in %q", p, permissions)
+		}
+	}
+	return nil
+}
+
+// ensureMountHostPaths creates host paths of mounts as directories if they
+// don't exist.
+func (c *criContainerdService) ensureMountHostPaths(mounts []*runtime.Mount) error {
+	for _, mount := range mounts {
+		src := mount.GetHostPath()
+		if _, err := c.os.Stat(src); err != nil {
+			if !os.IsNotExist(err) {
+				return fmt.Errorf("failed to stat %q: %v", src, err)
+			}
+			if err := c.os.MkdirAll(src, 0755); err != nil {
+				return fmt.Errorf("failed to mkdir %q: %v", src, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setOCILinuxResource sets container resource limit. Zero values mean not
+// specified except for oom score adj.
+func setOCILinuxResource(g *generate.Generator, resources *runtime.LinuxContainerResources) {
+	if resources == nil {
+		return
+	}
+	if resources.GetCpuPeriod() != 0 {
+		g.SetLinuxResourcesCPUPeriod(uint64(resources.GetCpuPeriod()))
+	}
+	if resources.GetCpuQuota() != 0 {
+		g.SetLinuxResourcesCPUQuota(resources.GetCpuQuota())
+	}
+	if resources.GetCpuShares() != 0 {
+		g.SetLinuxResourcesCPUShares(uint64(resources.GetCpuShares()))
+	}
+	if resources.GetMemoryLimitInBytes() != 0 {
+		g.SetLinuxResourcesMemoryLimit(uint64(resources.GetMemoryLimitInBytes()))
+	}
+	// Always set oom score adj, otherwise the container inherits the
+	// oom score adj of containerd-shim.
+	// TODO(agent): [P2] Move to Process.OOMScoreAdj after updating
+	// runtime-spec.
+	g.SetLinuxResourcesOOMScoreAdj(int(resources.GetOomScoreAdj()))
+}
+
+// setOCINamespaces sets namespaces.
+func setOCINamespaces(g *generate.Generator, namespaces *runtime.NamespaceOption, sandboxPid uint32) {
+	g.AddOrReplaceLinuxNamespace(string(runtimespec.NetworkNamespace), getNetworkNamespace(sandboxPid)) // nolint: errcheck
+	g.AddOrReplaceLinuxNamespace(string(runtimespec.IPCNamespace), getIPCNamespace(sandboxPid))         // nolint: errcheck
+	g.AddOrReplaceLinuxNamespace(string(runtimespec.UTSNamespace), getUTSNamespace(sandboxPid))         // nolint: errcheck
+	g.AddOrReplaceLinuxNamespace(string(runtimespec.PIDNamespace), getPIDNamespace(sandboxPid))         // nolint: errcheck
+	// By removing the namespace, the container will inherit the namespace of the runtime.
+	if namespaces.GetHostNetwork() {
+		g.RemoveLinuxNamespace(string(runtimespec.NetworkNamespace)) // nolint: errcheck
+		// TODO(random-liu): [P1] Figure out how to handle UTS namespace.
+	}
+	if namespaces.GetHostIpc() {
+		g.RemoveLinuxNamespace(string(runtimespec.IPCNamespace)) // nolint: errcheck
+	}
+	if namespaces.GetHostPid() {
+		g.RemoveLinuxNamespace(string(runtimespec.PIDNamespace)) // nolint: errcheck
+	}
+}
+
+// getContainerUserSpec gets the user spec of the container in the format of
+// "user[:group]". RunAsUser and RunAsUsername in the security context override
+// the user in the image config. Empty string is returned if the user is not
+// specified.
+func getContainerUserSpec(securityContext *runtime.LinuxContainerSecurityContext, imageConfig *imagespec.ImageConfig) (string, error) {
+	if securityContext.GetRunAsUser() != nil {
+		uid := securityContext.GetRunAsUser().GetValue()
+		if uid < 0 {
+			return "", fmt.Errorf("invalid RunAsUser %d, uid must not be negative", uid)
+		}
+		return strconv.FormatInt(uid, 10), nil
+	}
+	if securityContext.GetRunAsUsername() != "" {
+		return securityContext.GetRunAsUsername(), nil
+	}
+	if imageConfig != nil {
+		return imageConfig.User, nil
+	}
+	return "", nil
+}
+
+// getRunAsNonRoot returns whether a container is required to run as a non-root
+// user by the pod annotations.
+func getRunAsNonRoot(annotations map[string]string, containerName string) bool {
+	return annotations[runAsNonRootAnnotationKeyPrefix+containerName] == "true"
+}
+
+// getContainerArgs gets the args of the container process following the
+// docker semantics: the CRI command overrides the image entrypoint, and the
+// CRI args override the image cmd. The image cmd is ignored if the CRI
+// command is specified.
+func getContainerArgs(config *runtime.ContainerConfig, imageConfig *imagespec.ImageConfig) []string {
+	command, args := config.GetCommand(), config.GetArgs()
+	if len(command) == 0 && imageConfig != nil {
+		command = imageConfig.Entrypoint
+		if len(args) == 0 {
+			args = imageConfig.Cmd
+		}
+	}
+	return append(append([]string{}, command...), args...)
+}
+
+// getContainerWorkingDir gets the working directory of the container
+// process. The CRI working directory overrides the image one.
+func getContainerWorkingDir(config *runtime.ContainerConfig, imageConfig *imagespec.ImageConfig) string {
+	if config.GetWorkingDir() != "" {
+		return config.GetWorkingDir()
+	}
+	if imageConfig != nil {
+		return imageConfig.WorkingDir
+	}
+	return ""
+}
+
+// generateVolumeMounts generates a mount for each image volume which is not
+// covered by a CRI mount. The host path of each mount is a new directory
+// under the container root directory.
+func generateVolumeMounts(containerRootDir string, criMounts []*runtime.Mount, imageConfig *imagespec.ImageConfig) []*runtime.Mount {
+	if imageConfig == nil {
+		return nil
+	}
+	var dsts []string
+	for dst := range imageConfig.Volumes {
+		dsts = append(dsts, filepath.Clean(dst))
+	}
+	// Sort the volumes to make the generated mounts stable.
+	sort.Strings(dsts)
+	var mounts []*runtime.Mount
+	for _, dst := range dsts {
+		covered := false
+		for _, m := range criMounts {
+			if filepath.Clean(m.GetContainerPath()) == dst {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+		mounts = append(mounts, &runtime.Mount{
+			ContainerPath:  dst,
+			HostPath:       filepath.Join(containerRootDir, volumesDir, generateID()),
+			SelinuxRelabel: true,
+		})
+	}
+	return mounts
+}
+
+// setupVolumes creates the host paths of image volumes, and copies the
+// content at the volume paths in the mounted container rootfs into them.
+func (c *criContainerdService) setupVolumes(rootfs string, volumeMounts []*runtime.Mount) error {
+	for _, m := range volumeMounts {
+		if err := c.os.MkdirAll(m.GetHostPath(), 0755); err != nil {
+			return fmt.Errorf("failed to create volume directory %q: %v", m.GetHostPath(), err)
+		}
+		src, err := osinterface.FollowSymlinkInScope(filepath.Join(rootfs, m.GetContainerPath()), rootfs)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %q in rootfs: %v", m.GetContainerPath(), err)
+		}
+		if _, err := c.os.Stat(src); err != nil {
+			if os.IsNotExist(err) {
+				// Leave the volume empty if the path doesn't exist in the image.
+				continue
+			}
+			return fmt.Errorf("failed to stat %q: %v", src, err)
+		}
+		if err := c.os.CopyDir(src, m.GetHostPath()); err != nil {
+			return fmt.Errorf("failed to copy image content at %q to volume: %v", m.GetContainerPath(), err)
+		}
+	}
+	return nil
+}
+
+// withContainerRootfs mounts the container rootfs temporarily under the
+// container root directory, and calls the function with the mounted rootfs.
+// The rootfs is unmounted after the function returns.
+func (c *criContainerdService) withContainerRootfs(containerRootDir string, rootfsMounts []*mount.Mount, f func(string) error) error {
+	rootfs := filepath.Join(containerRootDir, rootfsMountDir)
+	if err := c.os.MkdirAll(rootfs, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %q: %v", rootfs, err)
+	}
+	var mounts []containerd.Mount
+	for _, m := range rootfsMounts {
+		mounts = append(mounts, containerd.Mount{
+			Type:    m.Type,
+			Source:  m.Source,
+			Options: m.Options,
+		})
+	}
+	if err := c.os.MountAll(mounts, rootfs); err != nil {
+		return fmt.Errorf("failed to mount container rootfs to %q: %v", rootfs, err)
+	}
+	defer func() {
+		for range mounts {
+			if err := c.os.Unmount(rootfs, 0); err != nil {
+				glog.Errorf("Failed to unmount container rootfs %q: %v", rootfs, err)
+			}
+		}
+	}()
+	return f(rootfs)
+}
+
+// resolveContainerUser resolves the user spec into uid and gid with the
+// passwd and group files in the mounted container rootfs. The container runs
+// as root if the user spec is empty.
+func (c *criContainerdService) resolveContainerUser(userSpec, rootfs string) (*user.ExecUser, error) {
+	if userSpec == "" {
+		userSpec = "0"
+	}
+	// TODO(agent): [P2] Skip reading files when the user spec is numeric
+	// and no group lookup is needed.
+	passwd, err := c.readRootfsFile(rootfs, passwdFile)
+	if err != nil {
+		return nil, err
+	}
+	group, err := c.readRootfsFile(rootfs, groupFile)
+	if err != nil {
+		return nil, err
+	}
+	return user.GetExecUser(userSpec, user.ParsePasswd(passwd), user.ParseGroup(group))
+}
+
+// ensureWorkingDir creates the working directory in the mounted container
+// rootfs if it doesn't exist. Symlinks are resolved in the scope of the rootfs.
+func (c *criContainerdService) ensureWorkingDir(rootfs, workingDir string) error {
+	if workingDir == "" {
+		return nil
+	}
+	resolved, err := osinterface.FollowSymlinkInScope(filepath.Join(rootfs, workingDir), rootfs)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %q in rootfs: %v", workingDir, err)
+	}
+	return c.os.MkdirAll(resolved, 0755)
+}
+
+// readRootfsFile reads a file in the rootfs. Symlinks are resolved in the
+// scope of the rootfs. Nil is returned without error if the file doesn't exist.
+func (c *criContainerdService) readRootfsFile(rootfs, path string) ([]byte, error) {
+	resolved, err := osinterface.FollowSymlinkInScope(filepath.Join(rootfs, path), rootfs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %q in rootfs: %v", path, err)
+	}
+	data, err := c.os.ReadFile(resolved)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %q: %v", resolved, err)
+	}
+	return data, nil
+}
+
+// relabelMounts relabels the host paths of mounts which require relabeling
+// with the mount label. It does nothing if selinux is disabled.
+func (c *criContainerdService) relabelMounts(mounts []*runtime.Mount, mountLabel string) error {
+	if !c.selinuxEnabled || mountLabel == "" {
+		return nil
+	}
+	for _, m := range mounts {
+		if !m.GetSelinuxRelabel() {
+			continue
+		}
+		if err := selinux.Relabel(m.GetHostPath(), mountLabel); err != nil {
+			return fmt.Errorf("failed to relabel %q: %v", m.GetHostPath(), err)
+		}
+	}
+	return nil
+}
+
+// redirectLogs redirects the container output into the log file. The output
+// is discarded if the log path is empty.
+// TODO(agent): [P1] Use CRI log format once it is defined.
+func redirectLogs(path string, rcs ...io.ReadCloser) error {
+	var w io.WriteCloser = nopWriteCloser{ioutil.Discard}
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+		if err != nil {
+			return fmt.Errorf("failed to open log file %q: %v", path, err)
+		}
+		w = f
+	}
+	wg := &sync.WaitGroup{}
+	wg.Add(len(rcs))
+	for _, rc := range rcs {
+		go func(r io.ReadCloser) {
+			defer wg.Done()
+			if _, err := io.Copy(w, r); err != nil {
+				glog.Errorf("Failed to redirect container log to %q: %v", path, err)
+			}
+			r.Close()
+		}(rc)
+	}
+	go func() {
+		wg.Wait()
+		w.Close()
+	}()
+	return nil
+}
+
+// nopWriteCloser wraps an io.Writer with a no-op Close method.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,1049 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/api/services/execution"
+	rootfsapi "github.com/containerd/containerd/api/services/rootfs"
+	"github.com/containerd/containerd/api/types/container"
+	"github.com/containerd/containerd/api/types/mount"
+	"github.com/opencontainers/go-digest"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+	osinterface "github.com/kubernetes-incubator/cri-containerd/pkg/os"
+	ostesting "github.com/kubernetes-incubator/cri-containerd/pkg/os/testing"
+	servertesting "github.com/kubernetes-incubator/cri-containerd/pkg/server/testing"
+	"github.com/kubernetes-incubator/cri-containerd/pkg/user"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// eofReadCloser is a ReadCloser which returns EOF immediately.
+type eofReadCloser struct{}
+
+func (eofReadCloser) Read(p []byte) (n int, err error) { return 0, io.EOF }
+func (eofReadCloser) Close() error                     { return nil }
+
+func getCreateContainerTestData() (*runtime.ContainerConfig, *runtime.PodSandboxConfig,
+	func(*testing.T, string, *runtimespec.Spec)) {
+	config := &runtime.ContainerConfig{
+		Metadata: &runtime.ContainerMetadata{
+			Name:    "test-name",
+			Attempt: 1,
+		},
+		Image: &runtime.ImageSpec{
+			Image: "sha256:c75bebcdd211f41b3a460c7bf82970ed6c75acaab9cd4c9a4e125b03ca113799",
+		},
+		Command:    []string{"test", "command"},
+		Args:       []string{"test", "args"},
+		WorkingDir: "test-cwd",
+		Envs: []*runtime.KeyValue{
+			{Key: "k1", Value: "v1"},
+			{Key: "k2", Value: "v2"},
+		},
+		Labels:      map[string]string{"a": "b"},
+		Annotations: map[string]string{"c": "d"},
+		Linux: &runtime.LinuxContainerConfig{
+			SecurityContext: &runtime.LinuxContainerSecurityContext{
+				SupplementalGroups: []int64{2222, 3333, 2000},
+			},
+		},
+	}
+	sandboxConfig := &runtime.PodSandboxConfig{
+		Metadata: &runtime.PodSandboxMetadata{
+			Name:      "test-sandbox-name",
+			Uid:       "test-sandbox-uid",
+			Namespace: "test-sandbox-ns",
+			Attempt:   2,
+		},
+		Linux: &runtime.LinuxPodSandboxConfig{
+			CgroupParent: "/test/cgroup/parent",
+			SecurityContext: &runtime.LinuxSandboxSecurityContext{
+				SupplementalGroups: []int64{1111, 2222},
+			},
+		},
+	}
+	specCheck := func(t *testing.T, id string, spec *runtimespec.Spec) {
+		assert.Equal(t, relativeRootfsPath, spec.Root.Path)
+		assert.Equal(t, []string{"test", "command", "test", "args"}, spec.Process.Args)
+		assert.Equal(t, "test-cwd", spec.Process.Cwd)
+		assert.Contains(t, spec.Process.Env, "k1=v1")
+		assert.Contains(t, spec.Process.Env, "k2=v2")
+		assert.Equal(t, filepath.Join("/test/cgroup/parent", id), spec.Linux.CgroupsPath)
+	}
+	return config, sandboxConfig, specCheck
+}
+
+func TestGenerateContainerSpec(t *testing.T) {
+	testID := "test-id"
+	testSandboxID := "sandbox-id"
+	testPid := uint32(1234)
+	testProcessLabel := "system_u:system_r:svirt_lxc_net_t:s0:c1,c2"
+	testMountLabel := "system_u:object_r:svirt_sandbox_file_t:s0:c1,c2"
+	testExecUser := &user.ExecUser{UID: 1000, GID: 1001, Sgids: []uint32{2000, 3000}}
+	for desc, test := range map[string]struct {
+		configChange func(*runtime.ContainerConfig, *runtime.PodSandboxConfig)
+		imageConfig  *imagespec.ImageConfig
+		extraMounts  []*runtime.Mount
+		expectErr    bool
+		specCheck    func(*testing.T, *runtimespec.Spec)
+	}{
+		"spec should reflect original config": {
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				assert.Nil(t, spec.Linux.Seccomp, "seccomp should be unconfined by default")
+				assert.Contains(t, spec.Linux.Namespaces, runtimespec.LinuxNamespace{
+					Type: runtimespec.NetworkNamespace,
+					Path: getNetworkNamespace(testPid),
+				})
+				assert.Contains(t, spec.Linux.Namespaces, runtimespec.LinuxNamespace{
+					Type: runtimespec.IPCNamespace,
+					Path: getIPCNamespace(testPid),
+				})
+				assert.Contains(t, spec.Linux.Namespaces, runtimespec.LinuxNamespace{
+					Type: runtimespec.UTSNamespace,
+					Path: getUTSNamespace(testPid),
+				})
+				assert.Contains(t, spec.Linux.Namespaces, runtimespec.LinuxNamespace{
+					Type: runtimespec.PIDNamespace,
+					Path: getPIDNamespace(testPid),
+				})
+			},
+		},
+		"spec should not have namespace when host namespace is used": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Linux.SecurityContext.NamespaceOptions = &runtime.NamespaceOption{
+					HostNetwork: true,
+					HostPid:     true,
+					HostIpc:     true,
+				}
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				for _, ns := range spec.Linux.Namespaces {
+					assert.NotEqual(t, runtimespec.NetworkNamespace, ns.Type)
+					assert.NotEqual(t, runtimespec.PIDNamespace, ns.Type)
+					assert.NotEqual(t, runtimespec.IPCNamespace, ns.Type)
+				}
+			},
+		},
+		"spec should use runtime default seccomp profile from pod annotation": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				s.Annotations = map[string]string{
+					seccompPodAnnotationKey: profileNameRuntimeDefault,
+				}
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				require.NotNil(t, spec.Linux.Seccomp)
+				assert.Equal(t, runtimespec.ActErrno, spec.Linux.Seccomp.DefaultAction)
+			},
+		},
+		"container seccomp annotation should override pod annotation": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				s.Annotations = map[string]string{
+					seccompPodAnnotationKey:                               profileNameRuntimeDefault,
+					seccompContainerAnnotationKeyPrefix + c.Metadata.Name: profileNameUnconfined,
+				}
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				assert.Nil(t, spec.Linux.Seccomp)
+			},
+		},
+		"should return error for unsupported seccomp profile": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				s.Annotations = map[string]string{
+					seccompPodAnnotationKey: "unknown-profile",
+				}
+			},
+			expectErr: true,
+		},
+		"should return error if apparmor profile is not loaded": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				s.Annotations = map[string]string{
+					apparmorAnnotationKeyPrefix + c.Metadata.Name: profileNamePrefixLocalhost + "test-profile",
+				}
+			},
+			expectErr: true,
+		},
+		"spec should add and drop capabilities from security context": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Linux.SecurityContext.Capabilities = &runtime.Capability{
+					AddCapabilities:  []string{"SYS_ADMIN"},
+					DropCapabilities: []string{"ALL"},
+				}
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				assert.Equal(t, []string{"CAP_SYS_ADMIN"}, spec.Process.Capabilities.Bounding)
+				assert.Equal(t, []string{"CAP_SYS_ADMIN"}, spec.Process.Capabilities.Ambient)
+			},
+		},
+		"spec should set resource limit": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Linux.Resources = &runtime.LinuxContainerResources{
+					CpuPeriod:          100000,
+					CpuQuota:           200000,
+					CpuShares:          1024,
+					MemoryLimitInBytes: 1 << 30,
+					OomScoreAdj:        -500,
+				}
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				require.NotNil(t, spec.Linux.Resources.CPU)
+				assert.EqualValues(t, 100000, *spec.Linux.Resources.CPU.Period)
+				assert.EqualValues(t, 200000, *spec.Linux.Resources.CPU.Quota)
+				assert.EqualValues(t, 1024, *spec.Linux.Resources.CPU.Shares)
+				require.NotNil(t, spec.Linux.Resources.Memory)
+				assert.EqualValues(t, 1<<30, *spec.Linux.Resources.Memory.Limit)
+				assert.EqualValues(t, -500, *spec.Linux.Resources.OOMScoreAdj)
+			},
+		},
+		"spec should not set unspecified resource limit": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Linux.Resources = &runtime.LinuxContainerResources{
+					CpuShares: 512,
+				}
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				require.NotNil(t, spec.Linux.Resources.CPU)
+				assert.Nil(t, spec.Linux.Resources.CPU.Period)
+				assert.Nil(t, spec.Linux.Resources.CPU.Quota)
+				assert.EqualValues(t, 512, *spec.Linux.Resources.CPU.Shares)
+				assert.Nil(t, spec.Linux.Resources.Memory)
+				assert.EqualValues(t, 0, *spec.Linux.Resources.OOMScoreAdj)
+			},
+		},
+		"spec should add cri mounts": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Mounts = []*runtime.Mount{
+					{ContainerPath: "/test-rw", HostPath: "/host-rw"},
+					{ContainerPath: "/test-ro", HostPath: "/host-ro", Readonly: true},
+					{ContainerPath: "/dev/shm", HostPath: "/host-shm"},
+				}
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				assert.Contains(t, spec.Mounts, runtimespec.Mount{
+					Destination: "/test-rw",
+					Type:        "bind",
+					Source:      "/host-rw",
+					Options:     []string{"rbind", "rprivate", "rw"},
+				})
+				assert.Contains(t, spec.Mounts, runtimespec.Mount{
+					Destination: "/test-ro",
+					Type:        "bind",
+					Source:      "/host-ro",
+					Options:     []string{"rbind", "rprivate", "ro"},
+				})
+				var shmMounts []runtimespec.Mount
+				for _, m := range spec.Mounts {
+					if m.Destination == "/dev/shm" {
+						shmMounts = append(shmMounts, m)
+					}
+				}
+				assert.Equal(t, []runtimespec.Mount{{
+					Destination: "/dev/shm",
+					Type:        "bind",
+					Source:      "/host-shm",
+					Options:     []string{"rbind", "rprivate", "rw"},
+				}}, shmMounts, "default mount should be replaced")
+				assert.Empty(t, spec.Linux.RootfsPropagation)
+			},
+		},
+		"spec should set mount propagation from annotation": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Mounts = []*runtime.Mount{
+					{ContainerPath: "/test-shared", HostPath: "/shared/path"},
+					{ContainerPath: "/test-slave", HostPath: "/slave/path"},
+				}
+				c.Annotations[mountPropagationAnnotationKeyPrefix+"/test-shared"] = mountPropagationShared
+				c.Annotations[mountPropagationAnnotationKeyPrefix+"/test-slave"] = mountPropagationSlave
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				assert.Contains(t, spec.Mounts, runtimespec.Mount{
+					Destination: "/test-shared",
+					Type:        "bind",
+					Source:      "/shared/path",
+					Options:     []string{"rbind", "rshared", "rw"},
+				})
+				assert.Contains(t, spec.Mounts, runtimespec.Mount{
+					Destination: "/test-slave",
+					Type:        "bind",
+					Source:      "/slave/path",
+					Options:     []string{"rbind", "rslave", "rw"},
+				})
+				assert.Equal(t, mountPropagationShared, spec.Linux.RootfsPropagation)
+			},
+		},
+		"should return error if shared mount source is not shared": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Mounts = []*runtime.Mount{{ContainerPath: "/test", HostPath: "/private/path"}}
+				c.Annotations[mountPropagationAnnotationKeyPrefix+"/test"] = mountPropagationShared
+			},
+			expectErr: true,
+		},
+		"should return error if slave mount source is private": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Mounts = []*runtime.Mount{{ContainerPath: "/test", HostPath: "/private/path"}}
+				c.Annotations[mountPropagationAnnotationKeyPrefix+"/test"] = mountPropagationSlave
+			},
+			expectErr: true,
+		},
+		"should return error for unsupported mount propagation": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Mounts = []*runtime.Mount{{ContainerPath: "/test", HostPath: "/shared/path"}}
+				c.Annotations[mountPropagationAnnotationKeyPrefix+"/test"] = "unknown"
+			},
+			expectErr: true,
+		},
+		"privileged container should relax all security confinements": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Linux.SecurityContext.Privileged = true
+				s.Linux.SecurityContext.Privileged = true
+				s.Annotations = map[string]string{
+					seccompPodAnnotationKey:                       profileNameRuntimeDefault,
+					apparmorAnnotationKeyPrefix + c.Metadata.Name: profileNamePrefixLocalhost + "test-profile",
+				}
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				caps := getAllCapabilities()
+				assert.Equal(t, caps, spec.Process.Capabilities.Bounding)
+				assert.Equal(t, caps, spec.Process.Capabilities.Effective)
+				assert.Equal(t, caps, spec.Process.Capabilities.Inheritable)
+				assert.Equal(t, caps, spec.Process.Capabilities.Permitted)
+				assert.Equal(t, caps, spec.Process.Capabilities.Ambient)
+				assert.Equal(t, []runtimespec.LinuxDevice{{Path: "/dev/test", Type: "c", Major: 1, Minor: 2}}, spec.Linux.Devices)
+				assert.Equal(t, []runtimespec.LinuxDeviceCgroup{{Allow: true, Access: "rwm"}}, spec.Linux.Resources.Devices)
+				assert.Empty(t, spec.Linux.MaskedPaths)
+				assert.Empty(t, spec.Linux.ReadonlyPaths)
+				assert.Nil(t, spec.Linux.Seccomp)
+				assert.Empty(t, spec.Process.ApparmorProfile)
+				for _, m := range spec.Mounts {
+					if m.Type == "sysfs" {
+						assert.NotContains(t, m.Options, "ro")
+						assert.Contains(t, m.Options, "rw")
+					}
+				}
+			},
+		},
+		"should return error for privileged container in non-privileged sandbox": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Linux.SecurityContext.Privileged = true
+			},
+			expectErr: true,
+		},
+		"should add devices and allow them in device cgroup": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Devices = []*runtime.Device{
+					{ContainerPath: "/dev/container-single", HostPath: "/dev/single", Permissions: "r"},
+					{ContainerPath: "/dev/container-dir", HostPath: "/dev/dir"},
+				}
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				assert.Equal(t, []runtimespec.LinuxDevice{
+					{Path: "/dev/container-single", Type: "c", Major: 1, Minor: 1},
+					{Path: "/dev/container-dir/a", Type: "c", Major: 2, Minor: 1},
+					{Path: "/dev/container-dir/sub/b", Type: "b", Major: 2, Minor: 2},
+				}, spec.Linux.Devices)
+				major1, major2 := int64(1), int64(2)
+				minor1, minor2 := int64(1), int64(2)
+				assert.Equal(t, []runtimespec.LinuxDeviceCgroup{
+					{Allow: false, Access: "rwm"},
+					{Allow: true, Type: "c", Major: &major1, Minor: &minor1, Access: "r"},
+					{Allow: true, Type: "c", Major: &major2, Minor: &minor1, Access: "rwm"},
+					{Allow: true, Type: "b", Major: &major2, Minor: &minor2, Access: "rwm"},
+				}, spec.Linux.Resources.Devices)
+			},
+		},
+		"should return error if device doesn't exist": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Devices = []*runtime.Device{{ContainerPath: "/dev/test", HostPath: "/dev/not-exist"}}
+			},
+			expectErr: true,
+		},
+		"should return error for empty device container path": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Devices = []*runtime.Device{{HostPath: "/dev/single"}}
+			},
+			expectErr: true,
+		},
+		"should return error for relative device container path": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Devices = []*runtime.Device{{ContainerPath: "dev/test", HostPath: "/dev/single"}}
+			},
+			expectErr: true,
+		},
+		"should return error for invalid device permissions": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Devices = []*runtime.Device{{ContainerPath: "/dev/test", HostPath: "/dev/single", Permissions: "rwx"}}
+			},
+			expectErr: true,
+		},
+		"should merge envs and working dir in image config": {
+			imageConfig: &imagespec.ImageConfig{
+				Env:        []string{"k1=image-v1", "k3=image-v3=x"},
+				WorkingDir: "/image-cwd",
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				assert.Contains(t, spec.Process.Env, "k1=v1", "CRI env should override image env")
+				assert.NotContains(t, spec.Process.Env, "k1=image-v1")
+				assert.Contains(t, spec.Process.Env, "k3=image-v3=x")
+				assert.Equal(t, "test-cwd", spec.Process.Cwd, "CRI working dir should override image working dir")
+			},
+		},
+		"should add extra mounts before CRI mounts": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Mounts = []*runtime.Mount{{ContainerPath: "/test-cri", HostPath: "/host-cri"}}
+			},
+			extraMounts: []*runtime.Mount{{ContainerPath: "/test-volume", HostPath: "/host-volume"}},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				var dsts []string
+				for _, m := range spec.Mounts {
+					if m.Type == "bind" {
+						dsts = append(dsts, m.Destination)
+					}
+				}
+				assert.Equal(t, []string{"/test-volume", "/test-cri"}, dsts)
+			},
+		},
+		"should return error for invalid image env": {
+			imageConfig: &imagespec.ImageConfig{Env: []string{"invalid"}},
+			expectErr:   true,
+		},
+		"should return error if no command is specified": {
+			configChange: func(c *runtime.ContainerConfig, s *runtime.PodSandboxConfig) {
+				c.Command = nil
+				c.Args = nil
+			},
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		fakeOS := c.os.(*ostesting.FakeOS)
+		fakeOS.HostDevicesFn = func() ([]runtimespec.LinuxDevice, error) {
+			return []runtimespec.LinuxDevice{{Path: "/dev/test", Type: "c", Major: 1, Minor: 2}}, nil
+		}
+		fakeOS.DevicesFromPathFn = func(path string) ([]runtimespec.LinuxDevice, error) {
+			switch path {
+			case "/dev/single":
+				return []runtimespec.LinuxDevice{{Path: "/dev/single", Type: "c", Major: 1, Minor: 1}}, nil
+			case "/dev/dir":
+				return []runtimespec.LinuxDevice{
+					{Path: "/dev/dir/a", Type: "c", Major: 2, Minor: 1},
+					{Path: "/dev/dir/sub/b", Type: "b", Major: 2, Minor: 2},
+				}, nil
+			}
+			return nil, os.ErrNotExist
+		}
+		fakeOS.LookupMountFn = func(path string) (osinterface.MountInfo, error) {
+			switch filepath.Dir(path) {
+			case "/shared":
+				return osinterface.MountInfo{Mountpoint: "/shared", Optional: []string{"shared:1"}}, nil
+			case "/slave":
+				return osinterface.MountInfo{Mountpoint: "/slave", Optional: []string{"master:1"}}, nil
+			}
+			return osinterface.MountInfo{Mountpoint: "/"}, nil
+		}
+		config, sandboxConfig, specCheck := getCreateContainerTestData()
+		if test.configChange != nil {
+			test.configChange(config, sandboxConfig)
+		}
+		spec, err := c.generateContainerSpec(testID, testSandboxID, testPid, config, sandboxConfig, test.imageConfig, test.extraMounts, testExecUser, testProcessLabel, testMountLabel)
+		if test.expectErr {
+			assert.Error(t, err)
+			assert.Nil(t, spec)
+			continue
+		}
+		assert.NoError(t, err)
+		require.NotNil(t, spec)
+		specCheck(t, testID, spec)
+		assert.Equal(t, uint32(1000), spec.Process.User.UID)
+		assert.Equal(t, uint32(1001), spec.Process.User.GID)
+		assert.Equal(t, []uint32{2000, 3000, 1111, 2222, 3333}, spec.Process.User.AdditionalGids)
+		assert.Equal(t, testProcessLabel, spec.Process.SelinuxLabel)
+		assert.Equal(t, testMountLabel, spec.Linux.MountLabel)
+		assert.Equal(t, map[string]string{
+			managerAnnotationKey:       managerName,
+			sandboxIDAnnotationKey:     testSandboxID,
+			containerKindAnnotationKey: containerKindContainer,
+		}, spec.Annotations)
+		if test.specCheck != nil {
+			test.specCheck(t, spec)
+		}
+	}
+}
+
+func TestCreateContainer(t *testing.T) {
+	testSandboxID := "test-sandbox-id"
+	testSandboxPid := uint32(4321)
+	testImageID := "sha256:c75bebcdd211f41b3a460c7bf82970ed6c75acaab9cd4c9a4e125b03ca113799"
+	testChainID := "test-chain-id"
+	config, sandboxConfig, specCheck := getCreateContainerTestData()
+	for desc, test := range map[string]struct {
+		sandboxMetadata    *metadata.SandboxMetadata
+		sandboxContainers  []container.Container
+		imageMetadata      *metadata.ImageMetadata
+		createRootDirErr   error
+		createContainerErr error
+		runAsNonRoot       bool
+		expectErr          bool
+		expectCalls        []string
+	}{
+		"should return error if sandbox does not exist": {
+			expectErr:   true,
+			expectCalls: []string{},
+		},
+		"should return error if sandbox container is not running": {
+			sandboxMetadata: &metadata.SandboxMetadata{ID: testSandboxID},
+			sandboxContainers: []container.Container{{
+				ID:     testSandboxID,
+				Pid:    testSandboxPid,
+				Status: container.Status_STOPPED,
+			}},
+			expectErr:   true,
+			expectCalls: []string{"info"},
+		},
+		"should return error if image does not exist": {
+			sandboxMetadata: &metadata.SandboxMetadata{ID: testSandboxID},
+			sandboxContainers: []container.Container{{
+				ID:     testSandboxID,
+				Pid:    testSandboxPid,
+				Status: container.Status_RUNNING,
+			}},
+			expectErr:   true,
+			expectCalls: []string{"info"},
+		},
+		"should return error if fs error is injected": {
+			sandboxMetadata: &metadata.SandboxMetadata{ID: testSandboxID},
+			sandboxContainers: []container.Container{{
+				ID:     testSandboxID,
+				Pid:    testSandboxPid,
+				Status: container.Status_RUNNING,
+			}},
+			imageMetadata: &metadata.ImageMetadata{
+				ID:      testImageID,
+				ChainID: testChainID,
+			},
+			createRootDirErr: errors.New("random error"),
+			expectErr:        true,
+			expectCalls:      []string{"info"},
+		},
+		"should return error and cleanup if containerd create fails": {
+			sandboxMetadata: &metadata.SandboxMetadata{ID: testSandboxID},
+			sandboxContainers: []container.Container{{
+				ID:     testSandboxID,
+				Pid:    testSandboxPid,
+				Status: container.Status_RUNNING,
+			}},
+			imageMetadata: &metadata.ImageMetadata{
+				ID:      testImageID,
+				ChainID: testChainID,
+			},
+			createContainerErr: errors.New("random error"),
+			expectErr:          true,
+			expectCalls:        []string{"info", "create"},
+		},
+		"should return error if container runs as root but non-root is required": {
+			sandboxMetadata: &metadata.SandboxMetadata{ID: testSandboxID},
+			sandboxContainers: []container.Container{{
+				ID:     testSandboxID,
+				Pid:    testSandboxPid,
+				Status: container.Status_RUNNING,
+			}},
+			imageMetadata: &metadata.ImageMetadata{
+				ID:      testImageID,
+				ChainID: testChainID,
+			},
+			runAsNonRoot: true,
+			expectErr:    true,
+			expectCalls:  []string{"info"},
+		},
+		"should be able to create container": {
+			sandboxMetadata: &metadata.SandboxMetadata{ID: testSandboxID},
+			sandboxContainers: []container.Container{{
+				ID:     testSandboxID,
+				Pid:    testSandboxPid,
+				Status: container.Status_RUNNING,
+			}},
+			imageMetadata: &metadata.ImageMetadata{
+				ID:         testImageID,
+				ChainID:    testChainID,
+				StopSignal: "SIGQUIT",
+			},
+			expectCalls: []string{"info", "create"},
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		fake := c.containerService.(*servertesting.FakeExecutionClient)
+		fakeRootfs := c.rootfsService.(*servertesting.FakeRootfsClient)
+		fakeOS := c.os.(*ostesting.FakeOS)
+		if test.sandboxMetadata != nil {
+			assert.NoError(t, c.sandboxStore.Create(*test.sandboxMetadata))
+		}
+		fake.SetFakeContainers(test.sandboxContainers)
+		if test.imageMetadata != nil {
+			assert.NoError(t, c.imageMetadataStore.Create(*test.imageMetadata))
+			fakeRootfs.SetFakeChainIDs([]digest.Digest{digest.Digest(test.imageMetadata.ChainID)})
+		}
+		rootExists := false
+		rootPath := ""
+		fakeOS.MkdirAllFn = func(path string, perm os.FileMode) error {
+			assert.Equal(t, os.FileMode(0755), perm)
+			if strings.Contains(path, rootfsMountDir) {
+				// Ignore the temporary rootfs mount directory and the working
+				// directory created in it.
+				return nil
+			}
+			rootPath = path
+			if test.createRootDirErr == nil {
+				rootExists = true
+			}
+			return test.createRootDirErr
+		}
+		fakeOS.RemoveAllFn = func(path string) error {
+			if strings.HasPrefix(path, servertesting.FakeSnapshotRoot) {
+				// Ignore the writable layer of the container rootfs.
+				return nil
+			}
+			assert.Equal(t, rootPath, path)
+			rootExists = false
+			return nil
+		}
+		fakeOS.OpenFifoFn = func(ctx context.Context, fn string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
+			return struct {
+				eofReadCloser
+				io.Writer
+			}{Writer: nopReadWriteCloser{}}, nil
+		}
+		if test.createContainerErr != nil {
+			fake.InjectError("create", test.createContainerErr)
+		}
+		sandboxConfig.Annotations = map[string]string{}
+		if test.runAsNonRoot {
+			sandboxConfig.Annotations[runAsNonRootAnnotationKeyPrefix+config.Metadata.Name] = "true"
+		}
+		resp, err := c.CreateContainer(context.Background(), &runtime.CreateContainerRequest{
+			PodSandboxId:  testSandboxID,
+			Config:        config,
+			SandboxConfig: sandboxConfig,
+		})
+		assert.Equal(t, test.expectCalls, fake.GetCalledNames())
+		if test.expectErr {
+			assert.Error(t, err)
+			assert.Nil(t, resp)
+			assert.False(t, rootExists, "root directory should be cleaned up")
+			assert.NoError(t, c.containerNameIndex.Reserve(makeContainerName(config.Metadata, sandboxConfig.Metadata), "random id"),
+				"container name should be released")
+			metas, err := c.containerStore.List()
+			assert.NoError(t, err)
+			assert.Empty(t, metas, "container metadata should not be created")
+			continue
+		}
+		assert.NoError(t, err)
+		require.NotNil(t, resp)
+		id := resp.GetContainerId()
+		assert.True(t, rootExists)
+		assert.Equal(t, getContainerRootDir(c.rootDir, id), rootPath, "root directory should be created")
+
+		calls := fakeRootfs.GetCalledDetails()
+		require.Len(t, calls, 1)
+		assert.Equal(t, &rootfsapi.PrepareRequest{
+			Name:    id,
+			ChainID: digest.Digest(testChainID),
+		}, calls[0].Argument, "rootfs prepare request should be correct")
+
+		calls = fake.GetCalledDetails()
+		createOpts := calls[1].Argument.(*execution.CreateRequest)
+		assert.Equal(t, id, createOpts.ID, "create id should be correct")
+		mountsResp, err := fakeRootfs.Mounts(context.Background(), &rootfsapi.MountsRequest{Name: id})
+		assert.NoError(t, err)
+		assert.Equal(t, mountsResp.Mounts, createOpts.Rootfs, "rootfs mount should be correct")
+		spec := &runtimespec.Spec{}
+		assert.NoError(t, json.Unmarshal(createOpts.Spec.Value, spec))
+		specCheck(t, id, spec)
+
+		meta, err := c.containerStore.Get(id)
+		assert.NoError(t, err)
+		require.NotNil(t, meta)
+		assert.Equal(t, testSandboxID, meta.SandboxID)
+		assert.Equal(t, testImageID, meta.ImageRef)
+		assert.Equal(t, "SIGQUIT", meta.StopSignal)
+		assert.Equal(t, config, meta.Config)
+		assert.Equal(t, runtime.ContainerState_CONTAINER_CREATED, meta.State())
+		assert.Equal(t, fake.ContainerList[id].Pid, meta.Pid)
+	}
+}
+
+func TestCreateContainerValidatesMountsBeforeCreatingHostPaths(t *testing.T) {
+	testSandboxID := "test-sandbox-id"
+	testChainID := "test-chain-id"
+	testHostPath := "/test/missing/host/path"
+	c := newTestCRIContainerdService()
+	fake := c.containerService.(*servertesting.FakeExecutionClient)
+	fakeRootfs := c.rootfsService.(*servertesting.FakeRootfsClient)
+	fakeOS := c.os.(*ostesting.FakeOS)
+	require.NoError(t, c.sandboxStore.Create(metadata.SandboxMetadata{ID: testSandboxID}))
+	fake.SetFakeContainers([]container.Container{{
+		ID:     testSandboxID,
+		Pid:    4321,
+		Status: container.Status_RUNNING,
+	}})
+	config, sandboxConfig, _ := getCreateContainerTestData()
+	require.NoError(t, c.imageMetadataStore.Create(metadata.ImageMetadata{
+		ID:      config.GetImage().GetImage(),
+		ChainID: testChainID,
+	}))
+	fakeRootfs.SetFakeChainIDs([]digest.Digest{digest.Digest(testChainID)})
+	fakeOS.StatFn = func(name string) (os.FileInfo, error) {
+		if name == testHostPath {
+			return nil, os.ErrNotExist
+		}
+		return nil, nil
+	}
+	fakeOS.MkdirAllFn = func(path string, perm os.FileMode) error {
+		assert.NotEqual(t, testHostPath, path, "host path should not be created")
+		return nil
+	}
+	var removed []string
+	fakeOS.RemoveAllFn = func(path string) error {
+		removed = append(removed, path)
+		return nil
+	}
+	config.Mounts = []*runtime.Mount{{ContainerPath: "/test", HostPath: testHostPath}}
+	config.Annotations = map[string]string{
+		mountPropagationAnnotationKeyPrefix + "/test": "unknown",
+	}
+	_, err := c.CreateContainer(context.Background(), &runtime.CreateContainerRequest{
+		PodSandboxId:  testSandboxID,
+		Config:        config,
+		SandboxConfig: sandboxConfig,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported mount propagation")
+
+	t.Logf("writable layer of the container rootfs should be removed on failure")
+	calls := fakeRootfs.GetCalledDetails()
+	require.NotEmpty(t, calls)
+	id := calls[0].Argument.(*rootfsapi.PrepareRequest).Name
+	assert.Contains(t, removed, filepath.Join(servertesting.FakeSnapshotRoot, id))
+}
+
+func TestGetContainerUserSpec(t *testing.T) {
+	for desc, test := range map[string]struct {
+		securityContext *runtime.LinuxContainerSecurityContext
+		imageConfig     *imagespec.ImageConfig
+		expectErr       bool
+		expected        string
+	}{
+		"should return empty if user is not specified": {
+			expected: "",
+		},
+		"should use image user if user is not specified in security context": {
+			securityContext: &runtime.LinuxContainerSecurityContext{},
+			imageConfig:     &imagespec.ImageConfig{User: "test:group"},
+			expected:        "test:group",
+		},
+		"run as user should override image user": {
+			securityContext: &runtime.LinuxContainerSecurityContext{
+				RunAsUser: &runtime.Int64Value{Value: 1000},
+			},
+			imageConfig: &imagespec.ImageConfig{User: "test:group"},
+			expected:    "1000",
+		},
+		"run as user 0 should override image user": {
+			securityContext: &runtime.LinuxContainerSecurityContext{
+				RunAsUser: &runtime.Int64Value{Value: 0},
+			},
+			imageConfig: &imagespec.ImageConfig{User: "test"},
+			expected:    "0",
+		},
+		"run as username should override image user": {
+			securityContext: &runtime.LinuxContainerSecurityContext{
+				RunAsUsername: "another",
+			},
+			imageConfig: &imagespec.ImageConfig{User: "test"},
+			expected:    "another",
+		},
+		"should return error for negative run as user": {
+			securityContext: &runtime.LinuxContainerSecurityContext{
+				RunAsUser: &runtime.Int64Value{Value: -5},
+			},
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		userSpec, err := getContainerUserSpec(test.securityContext, test.imageConfig)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, userSpec)
+	}
+}
+
+func TestGetRunAsNonRoot(t *testing.T) {
+	annotations := map[string]string{
+		runAsNonRootAnnotationKeyPrefix + "c1": "true",
+		runAsNonRootAnnotationKeyPrefix + "c2": "false",
+	}
+	assert.True(t, getRunAsNonRoot(annotations, "c1"))
+	assert.False(t, getRunAsNonRoot(annotations, "c2"))
+	assert.False(t, getRunAsNonRoot(annotations, "c3"))
+}
+
+func TestGetContainerArgs(t *testing.T) {
+	imageConfig := &imagespec.ImageConfig{
+		Entrypoint: []string{"image", "entrypoint"},
+		Cmd:        []string{"image", "cmd"},
+	}
+	for desc, test := range map[string]struct {
+		command     []string
+		args        []string
+		imageConfig *imagespec.ImageConfig
+		expected    []string
+	}{
+		"should use image entrypoint and cmd if command and args are not specified": {
+			imageConfig: imageConfig,
+			expected:    []string{"image", "entrypoint", "image", "cmd"},
+		},
+		"args should override image cmd": {
+			args:        []string{"args"},
+			imageConfig: imageConfig,
+			expected:    []string{"image", "entrypoint", "args"},
+		},
+		"command should override image entrypoint and ignore image cmd": {
+			command:     []string{"command"},
+			imageConfig: imageConfig,
+			expected:    []string{"command"},
+		},
+		"command and args should override image entrypoint and cmd": {
+			command:     []string{"command"},
+			args:        []string{"args"},
+			imageConfig: imageConfig,
+			expected:    []string{"command", "args"},
+		},
+		"should use command and args if image config is not available": {
+			command:  []string{"command"},
+			args:     []string{"args"},
+			expected: []string{"command", "args"},
+		},
+		"should return empty if nothing is specified": {
+			expected: []string{},
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		config := &runtime.ContainerConfig{Command: test.command, Args: test.args}
+		assert.Equal(t, test.expected, getContainerArgs(config, test.imageConfig))
+	}
+}
+
+func TestGenerateVolumeMounts(t *testing.T) {
+	testContainerRootDir := "test-container-root"
+	for desc, test := range map[string]struct {
+		criMounts   []*runtime.Mount
+		imageConfig *imagespec.ImageConfig
+		expected    []string
+	}{
+		"should return nil if image config is not available": {},
+		"should generate mounts for image volumes": {
+			imageConfig: &imagespec.ImageConfig{
+				Volumes: map[string]struct{}{"/test-volume-2/": {}, "/test-volume-1": {}},
+			},
+			expected: []string{"/test-volume-1", "/test-volume-2"},
+		},
+		"should skip image volumes covered by CRI mounts": {
+			criMounts: []*runtime.Mount{{ContainerPath: "/test-volume-1/", HostPath: "/host"}},
+			imageConfig: &imagespec.ImageConfig{
+				Volumes: map[string]struct{}{"/test-volume-1": {}, "/test-volume-2": {}},
+			},
+			expected: []string{"/test-volume-2"},
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		mounts := generateVolumeMounts(testContainerRootDir, test.criMounts, test.imageConfig)
+		require.Len(t, mounts, len(test.expected))
+		for i, m := range mounts {
+			assert.Equal(t, test.expected[i], m.GetContainerPath())
+			assert.Equal(t, filepath.Join(testContainerRootDir, volumesDir), filepath.Dir(m.GetHostPath()))
+			assert.True(t, m.GetSelinuxRelabel())
+		}
+	}
+}
+
+func TestSetupVolumes(t *testing.T) {
+	rootfs := "/test/rootfs"
+	volumeMounts := []*runtime.Mount{
+		{ContainerPath: "/existing", HostPath: "/test/volumes/1"},
+		{ContainerPath: "/missing", HostPath: "/test/volumes/2"},
+	}
+	c := newTestCRIContainerdService()
+	fakeOS := c.os.(*ostesting.FakeOS)
+	var created []string
+	fakeOS.MkdirAllFn = func(path string, perm os.FileMode) error {
+		created = append(created, path)
+		return nil
+	}
+	fakeOS.StatFn = func(name string) (os.FileInfo, error) {
+		if name == "/test/rootfs/existing" {
+			return nil, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	copied := map[string]string{}
+	fakeOS.CopyDirFn = func(src, dst string) error {
+		copied[src] = dst
+		return nil
+	}
+	assert.NoError(t, c.setupVolumes(rootfs, volumeMounts))
+	assert.Equal(t, []string{"/test/volumes/1", "/test/volumes/2"}, created)
+	assert.Equal(t, map[string]string{"/test/rootfs/existing": "/test/volumes/1"}, copied,
+		"only existing image content should be copied")
+
+	t.Logf("should return error if copy fails")
+	fakeOS.CopyDirFn = func(src, dst string) error {
+		return errors.New("random error")
+	}
+	assert.Error(t, c.setupVolumes(rootfs, volumeMounts))
+}
+
+func TestEnsureWorkingDir(t *testing.T) {
+	c := newTestCRIContainerdService()
+	fakeOS := c.os.(*ostesting.FakeOS)
+	var created []string
+	fakeOS.MkdirAllFn = func(path string, perm os.FileMode) error {
+		assert.Equal(t, os.FileMode(0755), perm)
+		created = append(created, path)
+		return nil
+	}
+	rootfs := "/test/rootfs"
+	assert.NoError(t, c.ensureWorkingDir(rootfs, ""))
+	assert.Empty(t, created, "nothing should be created if working dir is not specified")
+	assert.NoError(t, c.ensureWorkingDir(rootfs, "/work/dir"))
+	assert.Equal(t, []string{"/test/rootfs/work/dir"}, created)
+}
+
+func TestResolveContainerUser(t *testing.T) {
+	testRoot := getContainerRootDir(testRootDir, "test-id")
+	testRootfs := filepath.Join(testRoot, rootfsMountDir)
+	testMounts := []*mount.Mount{{Type: "overlay", Source: "overlay", Options: []string{"lowerdir=/a"}}}
+	testFiles := map[string]string{
+		filepath.Join(testRootfs, passwdFile): "root:x:0:0:root:/root:/bin/sh\ntest:x:1000:1001::/home/test:/bin/sh\n",
+		filepath.Join(testRootfs, groupFile):  "root:x:0:\ntest:x:1001:\nextra:x:2000:test\n",
+	}
+	for desc, test := range map[string]struct {
+		userSpec  string
+		expectErr bool
+		expected  *user.ExecUser
+	}{
+		"should run as root if user is not specified": {
+			userSpec: "",
+			expected: &user.ExecUser{UID: 0, GID: 0, Name: "root", Home: "/root"},
+		},
+		"should resolve user name": {
+			userSpec: "test",
+			expected: &user.ExecUser{UID: 1000, GID: 1001, Name: "test", Home: "/home/test", Sgids: []uint32{2000}},
+		},
+		"should resolve user name and group name": {
+			userSpec: "test:extra",
+			expected: &user.ExecUser{UID: 1000, GID: 2000, Name: "test", Home: "/home/test", Sgids: []uint32{2000}},
+		},
+		"should return error if user name does not exist": {
+			userSpec:  "unknown",
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		fakeOS := c.os.(*ostesting.FakeOS)
+		mounted := false
+		fakeOS.MountAllFn = func(mounts []containerd.Mount, target string) error {
+			assert.Equal(t, []containerd.Mount{{Type: "overlay", Source: "overlay", Options: []string{"lowerdir=/a"}}}, mounts)
+			assert.Equal(t, testRootfs, target)
+			mounted = true
+			return nil
+		}
+		fakeOS.UnmountFn = func(target string, flags int) error {
+			assert.Equal(t, testRootfs, target)
+			mounted = false
+			return nil
+		}
+		fakeOS.ReadFileFn = func(filename string) ([]byte, error) {
+			assert.True(t, mounted, "rootfs should be mounted when reading files")
+			return []byte(testFiles[filename]), nil
+		}
+		var execUser *user.ExecUser
+		err := c.withContainerRootfs(testRoot, testMounts, func(rootfs string) error {
+			assert.Equal(t, testRootfs, rootfs)
+			var err error
+			execUser, err = c.resolveContainerUser(test.userSpec, rootfs)
+			return err
+		})
+		assert.False(t, mounted, "rootfs should be unmounted")
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, execUser)
+	}
+}
+
+func TestEnsureMountHostPaths(t *testing.T) {
+	c := newTestCRIContainerdService()
+	fakeOS := c.os.(*ostesting.FakeOS)
+	existing := map[string]bool{"/existing/dir": true, "/existing/file": true}
+	fakeOS.StatFn = func(name string) (os.FileInfo, error) {
+		if existing[name] {
+			return nil, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	var created []string
+	fakeOS.MkdirAllFn = func(path string, perm os.FileMode) error {
+		assert.Equal(t, os.FileMode(0755), perm)
+		created = append(created, path)
+		return nil
+	}
+	err := c.ensureMountHostPaths([]*runtime.Mount{
+		{ContainerPath: "/a", HostPath: "/existing/dir"},
+		{ContainerPath: "/b", HostPath: "/existing/file"},
+		{ContainerPath: "/c", HostPath: "/missing/dir"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/missing/dir"}, created)
+
+	t.Logf("should return error if stat fails")
+	fakeOS.StatFn = func(name string) (os.FileInfo, error) {
+		return nil, errors.New("random error")
+	}
+	err = c.ensureMountHostPaths([]*runtime.Mount{{ContainerPath: "/a", HostPath: "/a"}})
+	assert.Error(t, err)
+}
@@ -17,14 +17,130 @@ limitations under the License.
 package server
 
 import (
-	"errors"
+	"fmt"
 
+	"github.com/golang/glog"
 	"golang.org/x/net/context"
 
+	"github.com/containerd/containerd/api/services/execution"
+	rootfsapi "github.com/containerd/containerd/api/services/rootfs"
+
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
 )
 
 // RemoveContainer removes the container.
-func (c *criContainerdService) RemoveContainer(ctx context.Context, r *runtime.RemoveContainerRequest) (*runtime.RemoveContainerResponse, error) {
-	return nil, errors.New("not implemented")
+func (c *criContainerdService) RemoveContainer(ctx context.Context, r *runtime.RemoveContainerRequest) (retRes *runtime.RemoveContainerResponse, retErr error) {
+	glog.V(2).Infof("RemoveContainer for %q", r.GetContainerId())
+	defer func() {
+		if retErr == nil {
+			glog.V(2).Infof("RemoveContainer %q returns successfully", r.GetContainerId())
+		}
+	}()
+
+	meta, err := c.getContainer(r.GetContainerId())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find container %q: %v", r.GetContainerId(), err)
+	}
+	if meta == nil {
+		// Do not return error if container metadata doesn't exist.
+		glog.V(5).Infof("RemoveContainer called for container %q that does not exist",
+			r.GetContainerId())
+		return &runtime.RemoveContainerResponse{}, nil
+	}
+	// Use the full container id.
+	id := meta.ID
+
+	// Set removing state to prevent other start/remove operations against this container
+	// while it's being removed.
+	if err := c.setContainerRemoving(id); err != nil {
+		return nil, fmt.Errorf("failed to set removing state for container %q: %v",
+			id, err)
+	}
+	defer func() {
+		if retErr != nil {
+			// Reset removing if remove failed.
+			if err := c.resetContainerRemoving(id); err != nil {
+				glog.Errorf("failed to reset removing state for container %q: %v",
+					id, err)
+			}
+		}
+	}()
+
+	// Delete the container from containerd in case it is created but never
+	// started.
+	_, err = c.containerService.Delete(ctx, &execution.DeleteRequest{ID: id})
+	if err != nil && !isContainerdContainerNotExistError(err) {
+		return nil, fmt.Errorf("failed to delete container %q in containerd: %v", id, err)
+	}
+	c.stateCache.delete(id)
+
+	// Remove the writable layer of the container. The snapshot itself is
+	// left in containerd, because the rootfs api can't remove it.
+	mountsResp, err := c.rootfsService.Mounts(ctx, &rootfsapi.MountsRequest{Name: id})
+	if err != nil {
+		if !isContainerdSnapshotNotExistError(err) {
+			return nil, fmt.Errorf("failed to get rootfs mounts of container %q: %v", id, err)
+		}
+	} else if err := c.removeWritableLayer(mountsResp.Mounts); err != nil {
+		return nil, fmt.Errorf("failed to remove writable layer of container %q: %v", id, err)
+	}
+
+	// Cleanup container root directory, including the image volumes created
+	// for the container.
+	containerRootDir := getContainerRootDir(c.rootDir, id)
+	if err := c.os.RemoveAll(containerRootDir); err != nil {
+		return nil, fmt.Errorf("failed to remove container root directory %q: %v",
+			containerRootDir, err)
+	}
+
+	// Cleanup container log. The sandbox config is required to get the log
+	// path, skip the cleanup if the sandbox has been removed.
+	sandbox, err := c.sandboxStore.Get(meta.SandboxID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sandbox %q metadata: %v", meta.SandboxID, err)
+	}
+	if sandbox != nil {
+		if logPath := getContainerLogPath(sandbox.Config, meta.Config); logPath != "" {
+			if err := c.os.RemoveAll(logPath); err != nil {
+				return nil, fmt.Errorf("failed to remove container log %q: %v", logPath, err)
+			}
+		}
+	}
+
+	// Delete container metadata.
+	if err := c.containerStore.Delete(id); err != nil {
+		return nil, fmt.Errorf("failed to delete container metadata for %q: %v", id, err)
+	}
+
+	c.containerIDIndex.Delete(id) // nolint: errcheck
+	c.containerNameIndex.ReleaseByKey(id)
+
+	return &runtime.RemoveContainerResponse{}, nil
+}
+
+// setContainerRemoving sets the container into removing state. In removing state, the
+// container will not be started or removed again.
+func (c *criContainerdService) setContainerRemoving(id string) error {
+	return c.containerStore.Update(id, func(meta metadata.ContainerMetadata) (metadata.ContainerMetadata, error) {
+		// Do not remove container if it's still running.
+		if meta.State() == runtime.ContainerState_CONTAINER_RUNNING {
+			return meta, fmt.Errorf("container %q is still running", id)
+		}
+		if meta.Removing {
+			return meta, fmt.Errorf("container is already in removing state")
+		}
+		meta.Removing = true
+		return meta, nil
+	})
+}
+
+// resetContainerRemoving resets the container removing state on remove failure. So
+// that we could remove the container again.
+func (c *criContainerdService) resetContainerRemoving(id string) error {
+	return c.containerStore.Update(id, func(meta metadata.ContainerMetadata) (metadata.ContainerMetadata, error) {
+		meta.Removing = false
+		return meta, nil
+	})
 }
@@ -0,0 +1,189 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/containerd/containerd/api/types/mount"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+	ostesting "github.com/kubernetes-incubator/cri-containerd/pkg/os/testing"
+	servertesting "github.com/kubernetes-incubator/cri-containerd/pkg/server/testing"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+func TestRemoveContainer(t *testing.T) {
+	testID := "test-id"
+	testName := "test-name"
+	testLayerDir := "/test/snapshots/test-id"
+	testRootfsMounts := []*mount.Mount{
+		{
+			Type:    "bind",
+			Source:  testLayerDir,
+			Options: []string{"rbind", "rw"},
+		},
+	}
+	for desc, test := range map[string]struct {
+		metadata            *metadata.ContainerMetadata
+		rootfsMounts        []*mount.Mount
+		mountsErr           error
+		removeDirErr        error
+		removeLayerErr      error
+		expectErr           bool
+		expectUnsetRemoving bool
+	}{
+		"should return error when container is still running": {
+			metadata: &metadata.ContainerMetadata{
+				ID:        testID,
+				CreatedAt: time.Now().UnixNano(),
+				StartedAt: time.Now().UnixNano(),
+			},
+			expectErr: true,
+		},
+		"should return error when there is ongoing removing": {
+			metadata: &metadata.ContainerMetadata{
+				ID:        testID,
+				CreatedAt: time.Now().UnixNano(),
+				StartedAt: time.Now().UnixNano(),
+				Removing:  true,
+			},
+			expectErr: true,
+		},
+		"should not return error if container does not exist": {
+			metadata:  nil,
+			expectErr: false,
+		},
+		"should return error if remove container root fails": {
+			metadata: &metadata.ContainerMetadata{
+				ID:         testID,
+				CreatedAt:  time.Now().UnixNano(),
+				StartedAt:  time.Now().UnixNano(),
+				FinishedAt: time.Now().UnixNano(),
+			},
+			removeDirErr:        errors.New("random error"),
+			expectErr:           true,
+			expectUnsetRemoving: true,
+		},
+		"should return error if get rootfs mounts fails": {
+			metadata: &metadata.ContainerMetadata{
+				ID:         testID,
+				CreatedAt:  time.Now().UnixNano(),
+				StartedAt:  time.Now().UnixNano(),
+				FinishedAt: time.Now().UnixNano(),
+			},
+			mountsErr:           errors.New("random error"),
+			expectErr:           true,
+			expectUnsetRemoving: true,
+		},
+		"should return error if remove writable layer fails": {
+			metadata: &metadata.ContainerMetadata{
+				ID:         testID,
+				CreatedAt:  time.Now().UnixNano(),
+				StartedAt:  time.Now().UnixNano(),
+				FinishedAt: time.Now().UnixNano(),
+			},
+			rootfsMounts:        testRootfsMounts,
+			removeLayerErr:      errors.New("random error"),
+			expectErr:           true,
+			expectUnsetRemoving: true,
+		},
+		"should be able to remove container and its writable layer": {
+			metadata: &metadata.ContainerMetadata{
+				ID:         testID,
+				CreatedAt:  time.Now().UnixNano(),
+				StartedAt:  time.Now().UnixNano(),
+				FinishedAt: time.Now().UnixNano(),
+			},
+			rootfsMounts: testRootfsMounts,
+			expectErr:    false,
+		},
+		"should be able to remove container successfully": {
+			metadata: &metadata.ContainerMetadata{
+				ID:         testID,
+				CreatedAt:  time.Now().UnixNano(),
+				StartedAt:  time.Now().UnixNano(),
+				FinishedAt: time.Now().UnixNano(),
+			},
+			expectErr: false,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		fake := c.containerService.(*servertesting.FakeExecutionClient)
+		fakeOS := c.os.(*ostesting.FakeOS)
+		fakeRootfs := c.rootfsService.(*servertesting.FakeRootfsClient)
+		if test.rootfsMounts != nil {
+			fakeRootfs.SetFakeMounts(testID, test.rootfsMounts)
+		}
+		if test.mountsErr != nil {
+			fakeRootfs.InjectError("mounts", test.mountsErr)
+		}
+		if test.metadata != nil {
+			assert.NoError(t, c.containerNameIndex.Reserve(testName, testID))
+			assert.NoError(t, c.containerIDIndex.Add(testID))
+			assert.NoError(t, c.containerStore.Create(*test.metadata))
+		}
+		var removed []string
+		fakeOS.RemoveAllFn = func(path string) error {
+			removed = append(removed, path)
+			if path == testLayerDir {
+				return test.removeLayerErr
+			}
+			assert.Equal(t, getContainerRootDir(c.rootDir, testID), path)
+			return test.removeDirErr
+		}
+		resp, err := c.RemoveContainer(context.Background(), &runtime.RemoveContainerRequest{
+			ContainerId: testID,
+		})
+		if test.expectErr {
+			assert.Error(t, err)
+			assert.Nil(t, resp)
+			if !test.expectUnsetRemoving {
+				continue
+			}
+			meta, err := c.containerStore.Get(testID)
+			assert.NoError(t, err)
+			assert.NotNil(t, meta)
+			// Removing field should be reset if remove failed.
+			assert.False(t, meta.Removing)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.NotNil(t, resp)
+		if test.metadata == nil {
+			continue
+		}
+		meta, err := c.containerStore.Get(testID)
+		assert.NoError(t, err)
+		assert.Nil(t, meta)
+		_, err = c.containerIDIndex.Get(testID)
+		assert.Error(t, err, "container id should be removed")
+		assert.NoError(t, c.containerNameIndex.Reserve(testName, testID),
+			"container name should be released")
+		assert.Equal(t, []string{"delete"}, fake.GetCalledNames(), "containerd delete should be called")
+		if test.rootfsMounts != nil {
+			assert.Contains(t, removed, testLayerDir, "writable layer should be removed")
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/containerd/containerd/api/types/container"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+	servertesting "github.com/kubernetes-incubator/cri-containerd/pkg/server/testing"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+func TestStartContainer(t *testing.T) {
+	testID := "test-id"
+	testMetadata := metadata.ContainerMetadata{
+		ID:        testID,
+		Pid:       4321,
+		CreatedAt: time.Now().UnixNano(),
+	}
+	for desc, test := range map[string]struct {
+		containerMetadata *metadata.ContainerMetadata
+		containers        []container.Container
+		startErr          error
+		expectStarted     bool
+		expectErr         bool
+		expectCalls       []string
+	}{
+		"should return error if container does not exist": {
+			expectErr:   true,
+			expectCalls: []string{},
+		},
+		"should return error if container is not in created state": {
+			containerMetadata: &metadata.ContainerMetadata{
+				ID:        testID,
+				CreatedAt: time.Now().UnixNano(),
+				StartedAt: time.Now().UnixNano(),
+			},
+			expectErr:   true,
+			expectCalls: []string{},
+		},
+		"should return error if container is in removing state": {
+			containerMetadata: &metadata.ContainerMetadata{
+				ID:        testID,
+				CreatedAt: time.Now().UnixNano(),
+				Removing:  true,
+			},
+			expectErr:   true,
+			expectCalls: []string{},
+		},
+		"should return error if containerd start fails": {
+			containerMetadata: &testMetadata,
+			containers: []container.Container{{
+				ID:     testID,
+				Pid:    testMetadata.Pid,
+				Status: container.Status_CREATED,
+			}},
+			startErr:    errors.New("random error"),
+			expectErr:   true,
+			expectCalls: []string{"start"},
+		},
+		"should be able to start container": {
+			containerMetadata: &testMetadata,
+			containers: []container.Container{{
+				ID:     testID,
+				Pid:    testMetadata.Pid,
+				Status: container.Status_CREATED,
+			}},
+			expectStarted: true,
+			expectCalls:   []string{"start"},
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		fake := c.containerService.(*servertesting.FakeExecutionClient)
+		if test.containerMetadata != nil {
+			assert.NoError(t, c.containerStore.Create(*test.containerMetadata))
+		}
+		fake.SetFakeContainers(test.containers)
+		if test.startErr != nil {
+			fake.InjectError("start", test.startErr)
+		}
+		resp, err := c.StartContainer(context.Background(), &runtime.StartContainerRequest{
+			ContainerId: testID,
+		})
+		assert.Equal(t, test.expectCalls, fake.GetCalledNames())
+		if test.expectErr {
+			assert.Error(t, err)
+			assert.Nil(t, resp)
+		} else {
+			assert.NoError(t, err)
+			assert.NotNil(t, resp)
+		}
+		if test.containerMetadata == nil {
+			continue
+		}
+		meta, err := c.containerStore.Get(testID)
+		assert.NoError(t, err)
+		if test.expectStarted {
+			assert.Equal(t, runtime.ContainerState_CONTAINER_RUNNING, meta.State())
+			assert.Equal(t, container.Status_RUNNING, fake.ContainerList[testID].Status)
+		} else {
+			assert.Equal(t, test.containerMetadata.StartedAt, meta.StartedAt,
+				"container start timestamp should not be changed")
+		}
+	}
+}
@@ -17,14 +17,74 @@ limitations under the License.
 package server
 
 import (
-	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/golang/glog"
 	"golang.org/x/net/context"
 
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
 )
 
 // ContainerStatus inspects the container and returns the status.
-func (c *criContainerdService) ContainerStatus(ctx context.Context, r *runtime.ContainerStatusRequest) (*runtime.ContainerStatusResponse, error) {
-	return nil, errors.New("not implemented")
+func (c *criContainerdService) ContainerStatus(ctx context.Context, r *runtime.ContainerStatusRequest) (retRes *runtime.ContainerStatusResponse, retErr error) {
+	glog.V(4).Infof("ContainerStatus for container %q", r.GetContainerId())
+	defer func() {
+		if retErr == nil {
+			glog.V(4).Infof("ContainerStatus for %q returns status %+v", r.GetContainerId(), retRes.GetStatus())
+		}
+	}()
+
+	meta, err := c.getContainer(r.GetContainerId())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find container %q: %v", r.GetContainerId(), err)
+	}
+	if meta == nil {
+		return nil, fmt.Errorf("container %q does not exist", r.GetContainerId())
+	}
+
+	return &runtime.ContainerStatusResponse{Status: toCRIContainerStatus(meta)}, nil
+}
+
+// toCRIContainerStatus converts container metadata to CRI container status.
+func toCRIContainerStatus(meta *metadata.ContainerMetadata) *runtime.ContainerStatus {
+	state := meta.State()
+	reason := meta.Reason
+	if state == runtime.ContainerState_CONTAINER_EXITED && reason == "" {
+		if meta.ExitCode == 0 {
+			reason = completeExitReason
+		} else {
+			reason = errorExitReason
+		}
+	}
+	annotations := meta.Config.GetAnnotations()
+	if len(meta.SecurityRelaxations) != 0 {
+		// Show the relaxations in an annotation because there is no field for
+		// it in CRI container status. Labels are left unchanged so that they
+		// match the labels in ListContainers. Copy the annotations to avoid
+		// changing the config.
+		annotations = make(map[string]string)
+		for k, v := range meta.Config.GetAnnotations() {
+			annotations[k] = v
+		}
+		annotations[privilegedAnnotationKey] = strings.Join(meta.SecurityRelaxations, ",")
+	}
+	return &runtime.ContainerStatus{
+		Id:          meta.ID,
+		Metadata:    meta.Config.GetMetadata(),
+		State:       state,
+		CreatedAt:   meta.CreatedAt,
+		StartedAt:   meta.StartedAt,
+		FinishedAt:  meta.FinishedAt,
+		ExitCode:    meta.ExitCode,
+		Image:       meta.Config.GetImage(),
+		ImageRef:    meta.ImageRef,
+		Reason:      reason,
+		Message:     meta.Message,
+		Labels:      meta.Config.GetLabels(),
+		Annotations: annotations,
+		Mounts:      meta.Config.GetMounts(),
+	}
 }
@@ -0,0 +1,151 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+func getContainerStatusTestData() (*metadata.ContainerMetadata, *runtime.ContainerStatus) {
+	testID := "test-id"
+	config := &runtime.ContainerConfig{
+		Metadata: &runtime.ContainerMetadata{
+			Name:    "test-name",
+			Attempt: 1,
+		},
+		Image:       &runtime.ImageSpec{Image: "test-image"},
+		Mounts:      []*runtime.Mount{{ContainerPath: "test-container-path", HostPath: "test-host-path"}},
+		Labels:      map[string]string{"a": "b"},
+		Annotations: map[string]string{"c": "d"},
+	}
+
+	createdAt := time.Now().UnixNano()
+	startedAt := time.Now().UnixNano()
+
+	meta := &metadata.ContainerMetadata{
+		ID:        testID,
+		Name:      "test-long-name",
+		SandboxID: "test-sandbox-id",
+		Config:    config,
+		ImageRef:  "test-image-ref",
+		Pid:       1234,
+		CreatedAt: createdAt,
+		StartedAt: startedAt,
+	}
+
+	expected := &runtime.ContainerStatus{
+		Id:          testID,
+		Metadata:    config.GetMetadata(),
+		State:       runtime.ContainerState_CONTAINER_RUNNING,
+		CreatedAt:   createdAt,
+		StartedAt:   startedAt,
+		Image:       config.GetImage(),
+		ImageRef:    "test-image-ref",
+		Labels:      config.GetLabels(),
+		Annotations: config.GetAnnotations(),
+		Mounts:      config.GetMounts(),
+	}
+
+	return meta, expected
+}
+
+func TestToCRIContainerStatus(t *testing.T) {
+	for desc, test := range map[string]struct {
+		finishedAt     int64
+		exitCode       int32
+		reason         string
+		message        string
+		expectedState  runtime.ContainerState
+		expectedReason string
+	}{
+		"container running": {
+			expectedState: runtime.ContainerState_CONTAINER_RUNNING,
+		},
+		"container exited with reason": {
+			finishedAt:     time.Now().UnixNano(),
+			exitCode:       1,
+			reason:         "test-reason",
+			message:        "test-message",
+			expectedState:  runtime.ContainerState_CONTAINER_EXITED,
+			expectedReason: "test-reason",
+		},
+		"container exited with exit code 0 without reason": {
+			finishedAt:     time.Now().UnixNano(),
+			exitCode:       0,
+			expectedState:  runtime.ContainerState_CONTAINER_EXITED,
+			expectedReason: completeExitReason,
+		},
+		"container exited with non-zero exit code without reason": {
+			finishedAt:     time.Now().UnixNano(),
+			exitCode:       1,
+			expectedState:  runtime.ContainerState_CONTAINER_EXITED,
+			expectedReason: errorExitReason,
+		},
+	} {
+		meta, expected := getContainerStatusTestData()
+		// Update metadata with test case.
+		meta.FinishedAt = test.finishedAt
+		meta.ExitCode = test.exitCode
+		meta.Reason = test.reason
+		meta.Message = test.message
+		// Set expectation based on test case.
+		expected.State = test.expectedState
+		expected.Reason = test.expectedReason
+		expected.FinishedAt = test.finishedAt
+		expected.ExitCode = test.exitCode
+		expected.Message = test.message
+		assert.Equal(t, expected, toCRIContainerStatus(meta), desc)
+	}
+}
+
+func TestToCRIContainerStatusPrivileged(t *testing.T) {
+	meta, expected := getContainerStatusTestData()
+	meta.SecurityRelaxations = []string{relaxationAllCapabilities, relaxationHostDevices}
+	status := toCRIContainerStatus(meta)
+	assert.Equal(t, expected.Labels, status.Labels, "labels should not be changed")
+	assert.Equal(t, "all-capabilities,host-devices", status.Annotations[privilegedAnnotationKey])
+	delete(status.Annotations, privilegedAnnotationKey)
+	assert.Equal(t, expected.Annotations, status.Annotations)
+	_, ok := meta.Config.Annotations[privilegedAnnotationKey]
+	assert.False(t, ok, "container config should not be changed")
+}
+
+func TestContainerStatus(t *testing.T) {
+	c := newTestCRIContainerdService()
+	meta, expected := getContainerStatusTestData()
+
+	t.Logf("should return error if container does not exist")
+	_, err := c.ContainerStatus(context.Background(), &runtime.ContainerStatusRequest{ContainerId: meta.ID})
+	assert.Error(t, err)
+
+	t.Logf("should be able to get container status with truncated id")
+	assert.NoError(t, c.containerStore.Create(*meta))
+	assert.NoError(t, c.containerIDIndex.Add(meta.ID))
+	resp, err := c.ContainerStatus(context.Background(), &runtime.ContainerStatusRequest{ContainerId: meta.ID[:3]})
+	assert.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, expected, resp.GetStatus())
+}
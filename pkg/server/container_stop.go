@@ -17,14 +17,123 @@ limitations under the License.
 package server
 
 import (
-	"errors"
+	"fmt"
+	"syscall"
+	"time"
 
+	"github.com/golang/glog"
 	"golang.org/x/net/context"
 
+	"github.com/containerd/containerd/api/services/execution"
+
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
 )
 
+const (
+	// stopCheckPollInterval is the the interval to check whether a container
+	// is stopped successfully.
+	stopCheckPollInterval = 100 * time.Millisecond
+
+	// killContainerTimeout is the timeout that we wait for the container to
+	// be SIGKILLed.
+	killContainerTimeout = 2 * time.Minute
+)
+
 // StopContainer stops a running container with a grace period (i.e., timeout).
-func (c *criContainerdService) StopContainer(ctx context.Context, r *runtime.StopContainerRequest) (*runtime.StopContainerResponse, error) {
-	return nil, errors.New("not implemented")
+func (c *criContainerdService) StopContainer(ctx context.Context, r *runtime.StopContainerRequest) (retRes *runtime.StopContainerResponse, retErr error) {
+	glog.V(2).Infof("StopContainer for %q with timeout %d (s)", r.GetContainerId(), r.GetTimeout())
+	defer func() {
+		if retErr == nil {
+			glog.V(2).Infof("StopContainer %q returns successfully", r.GetContainerId())
+		}
+	}()
+
+	// Get container config from container store.
+	meta, err := c.getContainer(r.GetContainerId())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find container %q: %v", r.GetContainerId(), err)
+	}
+	if meta == nil {
+		return nil, fmt.Errorf("container %q does not exist", r.GetContainerId())
+	}
+	// Use the full container id.
+	id := meta.ID
+
+	// Return without error if container is not running. This makes sure that
+	// stop only takes real action after the container is started.
+	if meta.State() != runtime.ContainerState_CONTAINER_RUNNING {
+		glog.V(2).Infof("Container to stop %q is not running, current state %q",
+			id, criContainerStateToString(meta.State()))
+		return &runtime.StopContainerResponse{}, nil
+	}
+
+	if r.GetTimeout() > 0 {
+		stopSignal := syscall.SIGTERM
+		if meta.StopSignal != "" {
+			stopSignal, err = parseSignal(meta.StopSignal)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse stop signal %q: %v", meta.StopSignal, err)
+			}
+		}
+		glog.V(2).Infof("Stop container %q with signal %v", id, stopSignal)
+		_, err = c.containerService.Kill(ctx, &execution.KillRequest{ID: id, Signal: uint32(stopSignal)})
+		if err != nil {
+			if !isContainerdContainerNotExistError(err) {
+				return nil, fmt.Errorf("failed to stop container %q: %v", id, err)
+			}
+			// Move on to make sure container status is updated.
+		}
+
+		err = c.waitContainerStop(ctx, id, time.Duration(r.GetTimeout())*time.Second)
+		if err == nil {
+			return &runtime.StopContainerResponse{}, nil
+		}
+		glog.Errorf("Stop container %q timed out: %v", id, err)
+	}
+
+	// Event handler will Delete the container from containerd after it handles the Exited event.
+	glog.V(2).Infof("Kill container %q", id)
+	_, err = c.containerService.Kill(ctx, &execution.KillRequest{ID: id, Signal: uint32(syscall.SIGKILL)})
+	if err != nil {
+		if !isContainerdContainerNotExistError(err) {
+			return nil, fmt.Errorf("failed to kill container %q: %v", id, err)
+		}
+		// Move on to make sure container status is updated.
+	}
+
+	// Wait for a fixed timeout until container stop is observed by event monitor.
+	if err := c.waitContainerStop(ctx, id, killContainerTimeout); err != nil {
+		return nil, fmt.Errorf("an error occurs during waiting for container %q to stop: %v",
+			id, err)
+	}
+	return &runtime.StopContainerResponse{}, nil
+}
+
+// waitContainerStop polls container state until timeout exceeds, the context
+// is done or container is stopped.
+func (c *criContainerdService) waitContainerStop(ctx context.Context, id string, timeout time.Duration) error {
+	ticker := time.NewTicker(stopCheckPollInterval)
+	defer ticker.Stop()
+	timeoutTimer := time.NewTimer(timeout)
+	defer timeoutTimer.Stop()
+	for {
+		// Poll once before waiting for stopCheckPollInterval.
+		meta, err := c.containerStore.Get(id)
+		if err != nil {
+			return fmt.Errorf("failed to get container %q metadata: %v", id, err)
+		}
+		// Do not return error here because container was removed means
+		// it is already stopped.
+		if meta == nil || meta.State() == runtime.ContainerState_CONTAINER_EXITED {
+			return nil
+		}
+		select {
+		case <-timeoutTimer.C:
+			return fmt.Errorf("wait container %q stop timeout", id)
+		case <-ctx.Done():
+			return fmt.Errorf("wait container %q stop: %v", id, ctx.Err())
+		case <-ticker.C:
+			continue
+		}
+	}
 }
@@ -0,0 +1,220 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/containerd/containerd/api/services/execution"
+	"github.com/containerd/containerd/api/types/container"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+	servertesting "github.com/kubernetes-incubator/cri-containerd/pkg/server/testing"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+func TestWaitContainerStop(t *testing.T) {
+	id := "test-id"
+	for desc, test := range map[string]struct {
+		metadata  *metadata.ContainerMetadata
+		timeout   time.Duration
+		cancel    bool
+		expectErr bool
+	}{
+		"should return error if timeout exceeds": {
+			metadata: &metadata.ContainerMetadata{
+				ID:        id,
+				CreatedAt: time.Now().UnixNano(),
+				StartedAt: time.Now().UnixNano(),
+			},
+			timeout:   2 * stopCheckPollInterval,
+			expectErr: true,
+		},
+		"should return error if context is done": {
+			metadata: &metadata.ContainerMetadata{
+				ID:        id,
+				CreatedAt: time.Now().UnixNano(),
+				StartedAt: time.Now().UnixNano(),
+			},
+			timeout:   time.Hour,
+			cancel:    true,
+			expectErr: true,
+		},
+		"should not return error if container is removed before timeout": {
+			metadata:  nil,
+			timeout:   time.Hour,
+			expectErr: false,
+		},
+		"should not return error if container is stopped before timeout": {
+			metadata: &metadata.ContainerMetadata{
+				ID:         id,
+				CreatedAt:  time.Now().UnixNano(),
+				StartedAt:  time.Now().UnixNano(),
+				FinishedAt: time.Now().UnixNano(),
+			},
+			timeout:   time.Hour,
+			expectErr: false,
+		},
+	} {
+		c := newTestCRIContainerdService()
+		if test.metadata != nil {
+			assert.NoError(t, c.containerStore.Create(*test.metadata))
+		}
+		ctx := context.Background()
+		if test.cancel {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(ctx)
+			cancel()
+		}
+		err := c.waitContainerStop(ctx, id, test.timeout)
+		assert.Equal(t, test.expectErr, err != nil, desc)
+	}
+}
+
+func TestStopContainer(t *testing.T) {
+	testID := "test-id"
+	testPid := uint32(1234)
+	testMetadata := metadata.ContainerMetadata{
+		ID:        testID,
+		Pid:       testPid,
+		CreatedAt: time.Now().UnixNano(),
+		StartedAt: time.Now().UnixNano(),
+	}
+	testContainer := container.Container{
+		ID:     testID,
+		Pid:    testPid,
+		Status: container.Status_RUNNING,
+	}
+	for desc, test := range map[string]struct {
+		metadata            *metadata.ContainerMetadata
+		containerdContainer *container.Container
+		killErr             error
+		timeout             int64
+		expectErr           bool
+		expectCalls         []servertesting.CalledDetail
+	}{
+		"should return error when container does not exist": {
+			expectErr:   true,
+			expectCalls: []servertesting.CalledDetail{},
+		},
+		"should not return error when container is not running": {
+			metadata: &metadata.ContainerMetadata{
+				ID:        testID,
+				CreatedAt: time.Now().UnixNano(),
+			},
+			expectCalls: []servertesting.CalledDetail{},
+		},
+		"should return error if containerd kill fails": {
+			metadata:            &testMetadata,
+			containerdContainer: &testContainer,
+			killErr:             errors.New("random error"),
+			expectErr:           true,
+			expectCalls: []servertesting.CalledDetail{
+				{
+					Name:     "kill",
+					Argument: &execution.KillRequest{ID: testID, Signal: uint32(syscall.SIGKILL)},
+				},
+			},
+		},
+		"should send SIGTERM first when timeout is specified": {
+			metadata:            &testMetadata,
+			containerdContainer: &testContainer,
+			timeout:             10,
+			expectCalls: []servertesting.CalledDetail{
+				{
+					Name:     "kill",
+					Argument: &execution.KillRequest{ID: testID, Signal: uint32(syscall.SIGTERM)},
+				},
+				{
+					Name:     "delete",
+					Argument: &execution.DeleteRequest{ID: testID},
+				},
+			},
+		},
+		"should send stop signal in image config when timeout is specified": {
+			metadata: &metadata.ContainerMetadata{
+				ID:         testID,
+				Pid:        testPid,
+				CreatedAt:  time.Now().UnixNano(),
+				StartedAt:  time.Now().UnixNano(),
+				StopSignal: "SIGQUIT",
+			},
+			containerdContainer: &testContainer,
+			timeout:             10,
+			expectCalls: []servertesting.CalledDetail{
+				{
+					Name:     "kill",
+					Argument: &execution.KillRequest{ID: testID, Signal: uint32(syscall.SIGQUIT)},
+				},
+				{
+					Name:     "delete",
+					Argument: &execution.DeleteRequest{ID: testID},
+				},
+			},
+		},
+		"should send SIGKILL directly when timeout is not specified": {
+			metadata:            &testMetadata,
+			containerdContainer: &testContainer,
+			expectCalls: []servertesting.CalledDetail{
+				{
+					Name:     "kill",
+					Argument: &execution.KillRequest{ID: testID, Signal: uint32(syscall.SIGKILL)},
+				},
+				{
+					Name:     "delete",
+					Argument: &execution.DeleteRequest{ID: testID},
+				},
+			},
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		fake := servertesting.NewFakeExecutionClient().WithEvents()
+		c.containerService = fake
+		assert.NoError(t, c.Start())
+		if test.metadata != nil {
+			assert.NoError(t, c.containerStore.Create(*test.metadata))
+		}
+		if test.containerdContainer != nil {
+			fake.SetFakeContainers([]container.Container{*test.containerdContainer})
+		}
+		if test.killErr != nil {
+			fake.InjectError("kill", test.killErr)
+		}
+		// Clear the events call issued by the event monitor.
+		fake.ClearCalls()
+		resp, err := c.StopContainer(context.Background(), &runtime.StopContainerRequest{
+			ContainerId: testID,
+			Timeout:     test.timeout,
+		})
+		if test.expectErr {
+			assert.Error(t, err)
+			assert.Nil(t, resp)
+		} else {
+			assert.NoError(t, err)
+			assert.NotNil(t, resp)
+		}
+		assert.Equal(t, test.expectCalls, fake.GetCalledDetails())
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"github.com/containerd/containerd/api/services/execution"
+	"github.com/containerd/containerd/api/types/container"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+)
+
+const (
+	// eventRetryInitialInterval is the initial interval to retry handling
+	// a failed event.
+	eventRetryInitialInterval = 100 * time.Millisecond
+	// eventRetryMaxInterval is the max interval to retry handling a failed
+	// event.
+	eventRetryMaxInterval = 30 * time.Second
+)
+
+// subscribeEvents subscribes to the containerd event stream. Events are
+// buffered in the stream until they are received by the event monitor, so
+// the subscription should be made before recovery to not lose any event
+// happened during recovery.
+func (c *criContainerdService) subscribeEvents() (execution.ContainerService_EventsClient, error) {
+	// TODO(agent): [P1] Figure out is it possible to lose event during containerd restart?
+	return c.containerService.Events(context.Background(), &execution.EventsRequest{})
+}
+
+// startEventMonitor starts an event monitor which handles all container
+// events received from the event stream.
+func (c *criContainerdService) startEventMonitor(events execution.ContainerService_EventsClient) {
+	go func() {
+		for {
+			e, err := events.Recv()
+			if err != nil {
+				glog.Errorf("Failed to receive event: %v", err)
+				return
+			}
+			c.handleEvent(e)
+		}
+	}()
+}
+
+// handleEvent handles a containerd event. The container state cache is
+// updated right away, and the handling of a container event is retried with
+// backoff until it succeeds.
+func (c *criContainerdService) handleEvent(e *container.Event) {
+	c.updateStateCache(e)
+	c.retryContainerEvent(e, 0)
+}
+
+// retryContainerEvent handles a container event after the interval, and
+// retries it with a doubled interval if it fails.
+func (c *criContainerdService) retryContainerEvent(e *container.Event, interval time.Duration) {
+	handle := func() {
+		if err := c.handleContainerEvent(e); err != nil {
+			next := 2 * interval
+			if next < eventRetryInitialInterval {
+				next = eventRetryInitialInterval
+			}
+			if next > eventRetryMaxInterval {
+				next = eventRetryMaxInterval
+			}
+			glog.Errorf("Failed to handle event %+v, retry in %v: %v", e, next, err)
+			c.retryContainerEvent(e, next)
+		}
+	}
+	if interval == 0 {
+		handle()
+		return
+	}
+	time.AfterFunc(interval, handle)
+}
+
+// handleContainerEvent handles a containerd event for a container. It is
+// idempotent, so that it could be retried on failure.
+func (c *criContainerdService) handleContainerEvent(e *container.Event) error {
+	// Only handle events for container managed by cri-containerd.
+	// TODO(agent): [P1] Handle events for sandbox container.
+	meta, err := c.containerStore.Get(e.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get container %q metadata: %v", e.ID, err)
+	}
+	if meta == nil {
+		glog.V(5).Infof("Ignore event %+v for container not managed by cri-containerd", e)
+		return nil
+	}
+	switch e.Type {
+	case container.Event_EXIT:
+		// Only handle exit event of the container init process.
+		if e.Pid != meta.Pid {
+			return nil
+		}
+		// Delete the container from containerd.
+		_, err = c.containerService.Delete(context.Background(), &execution.DeleteRequest{ID: e.ID})
+		if err != nil && !isContainerdContainerNotExistError(err) {
+			return fmt.Errorf("failed to delete container %q: %v", e.ID, err)
+		}
+		c.stateCache.delete(e.ID)
+		err = c.containerStore.Update(e.ID, func(meta metadata.ContainerMetadata) (metadata.ContainerMetadata, error) {
+			// If FinishedAt has been set (e.g. with start failure), keep as
+			// it is.
+			if meta.FinishedAt != 0 {
+				return meta, nil
+			}
+			meta.Pid = 0
+			meta.FinishedAt = e.ExitedAt.UnixNano()
+			meta.ExitCode = int32(e.ExitStatus)
+			if meta.Reason == "" {
+				meta.Reason = completeExitReason
+				if meta.ExitCode != 0 {
+					meta.Reason = errorExitReason
+				}
+			}
+			return meta, nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update container %q state: %v", e.ID, err)
+		}
+	case container.Event_OOM:
+		err = c.containerStore.Update(e.ID, func(meta metadata.ContainerMetadata) (metadata.ContainerMetadata, error) {
+			meta.Reason = oomExitReason
+			return meta, nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update container %q oom: %v", e.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/containerd/api/types/container"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+	servertesting "github.com/kubernetes-incubator/cri-containerd/pkg/server/testing"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+func TestHandleExitEventRetry(t *testing.T) {
+	testID := "test-id"
+	now := time.Now().UnixNano()
+	c := newTestCRIContainerdService()
+	fake := c.containerService.(*servertesting.FakeExecutionClient)
+	require.NoError(t, c.containerStore.Create(metadata.ContainerMetadata{
+		ID: testID, Name: "test-name", Pid: 1, CreatedAt: now, StartedAt: now,
+	}))
+	fake.SetFakeContainers([]container.Container{{ID: testID, Pid: 1, Status: container.Status_STOPPED}})
+	fake.InjectError("delete", errors.New("random error"))
+
+	c.handleEvent(&container.Event{
+		ID:         testID,
+		Type:       container.Event_EXIT,
+		Pid:        1,
+		ExitStatus: 1,
+		ExitedAt:   time.Now(),
+	})
+	t.Logf("container should not be exited if the event handling fails")
+	meta, err := c.containerStore.Get(testID)
+	require.NoError(t, err)
+	assert.Equal(t, runtime.ContainerState_CONTAINER_RUNNING, meta.State())
+
+	t.Logf("the event should be retried until it succeeds")
+	for i := 0; i < 100; i++ {
+		meta, err = c.containerStore.Get(testID)
+		require.NoError(t, err)
+		if meta.State() == runtime.ContainerState_CONTAINER_EXITED {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, runtime.ContainerState_CONTAINER_EXITED, meta.State())
+	assert.Equal(t, errorExitReason, meta.Reason)
+	assert.EqualValues(t, 1, meta.ExitCode)
+	assert.Equal(t, []string{"delete", "delete"}, fake.GetCalledNames())
+}
@@ -17,17 +17,33 @@ limitations under the License.
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/docker/docker/pkg/stringid"
 	"github.com/docker/docker/pkg/truncindex"
+	"github.com/golang/glog"
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/opencontainers/runtime-tools/generate/seccomp"
+	"github.com/syndtr/gocapability/capability"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 
 	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/api/services/execution"
+	"github.com/containerd/containerd/api/types/container"
+	"github.com/containerd/containerd/snapshot"
 
 	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+	"github.com/kubernetes-incubator/cri-containerd/pkg/selinux"
 
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
 )
@@ -42,6 +58,27 @@ const (
 	// directory of the sandbox, all files created for the sandbox will be
 	// placed under this directory.
 	sandboxesDir = "sandboxes"
+	// containersDir contains all container root.
+	containersDir = "containers"
+	// imagesDir contains all image metadata checkpoints.
+	imagesDir = "images"
+	// metadataDir is the directory under root directory where sandbox,
+	// container and image metadata are checkpointed.
+	metadataDir = "metadata"
+	// metadataDBFile is the bolt database file under metadata directory,
+	// which is used by the bolt metadata store backend.
+	metadataDBFile = "metadata.db"
+	// rootfsMountDir is the directory under container root where the
+	// container rootfs is temporarily mounted to look up users and groups,
+	// and to set up the working directory.
+	rootfsMountDir = "rootfs-mount"
+	// volumesDir is the directory under container root where the volumes
+	// declared in the image config are created.
+	volumesDir = "volumes"
+	// passwdFile is the path of passwd file in the container rootfs.
+	passwdFile = "/etc/passwd"
+	// groupFile is the path of group file in the container rootfs.
+	groupFile = "/etc/group"
 	// stdinNamedPipe is the name of stdin named pipe.
 	stdinNamedPipe = "stdin"
 	// stdoutNamedPipe is the name of stdout named pipe.
@@ -52,8 +89,215 @@ const (
 	nameDelimiter = "_"
 	// netNSFormat is the format of network namespace of a process.
 	netNSFormat = "/proc/%v/ns/net"
+	// ipcNSFormat is the format of ipc namespace of a process.
+	ipcNSFormat = "/proc/%v/ns/ipc"
+	// utsNSFormat is the format of uts namespace of a process.
+	utsNSFormat = "/proc/%v/ns/uts"
+	// pidNSFormat is the format of pid namespace of a process.
+	pidNSFormat = "/proc/%v/ns/pid"
+	// systemdSliceSuffix is the suffix of systemd slice name.
+	systemdSliceSuffix = ".slice"
+	// systemdScopePrefix is the prefix of the systemd scope created for a
+	// container, the scope name is "<prefix>-<id>.scope".
+	systemdScopePrefix = "cri-containerd"
+	// defaultDevicePermissions is the default cgroup permissions of a device.
+	defaultDevicePermissions = "rwm"
+	// defaultSandboxCPUShares is the default cpu shares of sandbox container.
+	defaultSandboxCPUShares = 2
+	// defaultSandboxOOMAdj is the default oom score adj of sandbox container,
+	// which is the same with kubelet pod infra container.
+	defaultSandboxOOMAdj = -998
 )
 
+// signalMap is the map from signal name (without the "SIG" prefix) to
+// signal, which is used to parse the stop signal in image config.
+var signalMap = map[string]syscall.Signal{
+	"ABRT":   syscall.SIGABRT,
+	"ALRM":   syscall.SIGALRM,
+	"BUS":    syscall.SIGBUS,
+	"CHLD":   syscall.SIGCHLD,
+	"CONT":   syscall.SIGCONT,
+	"FPE":    syscall.SIGFPE,
+	"HUP":    syscall.SIGHUP,
+	"ILL":    syscall.SIGILL,
+	"INT":    syscall.SIGINT,
+	"IO":     syscall.SIGIO,
+	"KILL":   syscall.SIGKILL,
+	"PIPE":   syscall.SIGPIPE,
+	"PROF":   syscall.SIGPROF,
+	"PWR":    syscall.SIGPWR,
+	"QUIT":   syscall.SIGQUIT,
+	"SEGV":   syscall.SIGSEGV,
+	"STKFLT": syscall.SIGSTKFLT,
+	"STOP":   syscall.SIGSTOP,
+	"SYS":    syscall.SIGSYS,
+	"TERM":   syscall.SIGTERM,
+	"TRAP":   syscall.SIGTRAP,
+	"TSTP":   syscall.SIGTSTP,
+	"TTIN":   syscall.SIGTTIN,
+	"TTOU":   syscall.SIGTTOU,
+	"URG":    syscall.SIGURG,
+	"USR1":   syscall.SIGUSR1,
+	"USR2":   syscall.SIGUSR2,
+	"VTALRM": syscall.SIGVTALRM,
+	"WINCH":  syscall.SIGWINCH,
+	"XCPU":   syscall.SIGXCPU,
+	"XFSZ":   syscall.SIGXFSZ,
+}
+
+const (
+	// completeExitReason is the exit reason when container exits with code 0.
+	completeExitReason = "Completed"
+	// errorExitReason is the exit reason when container exits with code non-zero.
+	errorExitReason = "Error"
+	// oomExitReason is the exit reason when process in container is oom killed.
+	oomExitReason = "OOMKilled"
+	// unknownExitReason is the exit reason when the container exited while
+	// cri-containerd is not running, thus the real exit status is unknown.
+	unknownExitReason = "Unknown"
+	// unknownExitCode is the exit code used when the real exit code is
+	// unknown.
+	unknownExitCode = 255
+)
+
+const (
+	// seccompPodAnnotationKey is the annotation key of the seccomp profile for
+	// all containers in a pod.
+	seccompPodAnnotationKey = "security.alpha.kubernetes.io/seccomp/pod"
+	// seccompContainerAnnotationKeyPrefix is the annotation key prefix of the
+	// seccomp profile for a specific container, it overrides the pod profile.
+	seccompContainerAnnotationKeyPrefix = "security.alpha.kubernetes.io/seccomp/container/"
+	// profileNameUnconfined is the profile name which disables the confinement.
+	profileNameUnconfined = "unconfined"
+	// profileNameRuntimeDefault is the profile name of the runtime default
+	// profile.
+	profileNameRuntimeDefault = "runtime/default"
+	// profileNameDockerDefault is the legacy name of the runtime default seccomp
+	// profile, it is still used by old kubelet.
+	profileNameDockerDefault = "docker/default"
+	// profileNamePrefixLocalhost is the prefix of profiles loaded on the node.
+	profileNamePrefixLocalhost = "localhost/"
+)
+
+const (
+	// apparmorAnnotationKeyPrefix is the annotation key prefix of the apparmor
+	// profile for a specific container.
+	apparmorAnnotationKeyPrefix = "container.apparmor.security.beta.kubernetes.io/"
+	// sandboxApparmorContainerName is the container name the kubelet gives
+	// the sandbox container, so the apparmor annotation with this name sets
+	// the profile of the sandbox container.
+	sandboxApparmorContainerName = "POD"
+	// defaultApparmorProfile is the apparmor profile used for "runtime/default".
+	// It is loaded by cri-containerd on start, see apparmor.go.
+	defaultApparmorProfile = "cri-containerd.apparmor.d"
+	// apparmorEnabledFile is the file indicating whether apparmor is enabled.
+	apparmorEnabledFile = "/sys/module/apparmor/parameters/enabled"
+	// apparmorProfilesFile is the file listing all apparmor profiles loaded
+	// in the kernel.
+	apparmorProfilesFile = "/sys/kernel/security/apparmor/profiles"
+)
+
+// runAsNonRootAnnotationKeyPrefix is the annotation key prefix requiring a
+// specific container to run as a non-root user. The CRI security context has
+// no RunAsNonRoot field, so it is requested with a pod annotation set to
+// "true".
+const runAsNonRootAnnotationKeyPrefix = "io.kubernetes.cri-containerd.run-as-non-root/"
+
+const (
+	// managerAnnotationKey is the annotation key of the manager of a
+	// containerd container.
+	managerAnnotationKey = "io.kubernetes.cri-containerd.manager"
+	// managerName is the manager name of containerd containers managed by
+	// cri-containerd.
+	managerName = "cri-containerd"
+	// sandboxIDAnnotationKey is the annotation key of the id of the sandbox
+	// a containerd container belongs to.
+	sandboxIDAnnotationKey = "io.kubernetes.cri-containerd.sandbox-id"
+	// instanceAnnotationKey is the annotation key of the cri-containerd
+	// instance managing a containerd container.
+	instanceAnnotationKey = "io.kubernetes.cri-containerd.instance"
+	// containerKindAnnotationKey is the annotation key of the kind of a
+	// containerd container.
+	containerKindAnnotationKey = "io.kubernetes.cri-containerd.kind"
+	// containerKindSandbox is the kind of sandbox containers.
+	containerKindSandbox = "sandbox"
+	// containerKindContainer is the kind of application containers.
+	containerKindContainer = "container"
+)
+
+const (
+	// mountPropagationAnnotationKeyPrefix is the container annotation key
+	// prefix of the mount propagation of a container path.
+	mountPropagationAnnotationKeyPrefix = "io.kubernetes.cri-containerd.mount-propagation/"
+	// mountPropagationPrivate is the private mount propagation.
+	mountPropagationPrivate = "rprivate"
+	// mountPropagationSlave is the slave mount propagation, mounts on the
+	// host propagate into the container.
+	mountPropagationSlave = "rslave"
+	// mountPropagationShared is the shared mount propagation, mounts propagate
+	// between the host and the container in both directions.
+	mountPropagationShared = "rshared"
+)
+
+const (
+	// selinuxCategoryRange is the range of selinux categories used to
+	// allocate MCS levels.
+	selinuxCategoryRange = 1024
+	// maxSelinuxLevelAllocateAttempts is the max attempts to allocate a unique
+	// selinux level.
+	maxSelinuxLevelAllocateAttempts = 100
+)
+
+const (
+	// privilegedAnnotationKey is the annotation key added in container status
+	// to show the security relaxations applied to a privileged container.
+	privilegedAnnotationKey = "io.kubernetes.cri-containerd.privileged"
+	// relaxationAllCapabilities means all capabilities are granted.
+	relaxationAllCapabilities = "all-capabilities"
+	// relaxationHostDevices means all host devices are exposed.
+	relaxationHostDevices = "host-devices"
+	// relaxationUnmaskedPaths means masked and readonly paths are removed.
+	relaxationUnmaskedPaths = "unmasked-paths"
+	// relaxationUnconfinedSeccomp means seccomp confinement is not applied.
+	relaxationUnconfinedSeccomp = "unconfined-seccomp"
+	// relaxationUnconfinedApparmor means apparmor confinement is not applied.
+	relaxationUnconfinedApparmor = "unconfined-apparmor"
+	// relaxationWritableSysfs means /sys is mounted read-write.
+	relaxationWritableSysfs = "writable-sysfs"
+)
+
+// privilegedRelaxations are the security relaxations applied in privileged mode.
+var privilegedRelaxations = []string{
+	relaxationAllCapabilities,
+	relaxationHostDevices,
+	relaxationUnmaskedPaths,
+	relaxationUnconfinedSeccomp,
+	relaxationUnconfinedApparmor,
+	relaxationWritableSysfs,
+}
+
+// defaultCapabilities is the default capability set of a container, which
+// is the same with docker.
+var defaultCapabilities = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FSETID",
+	"CAP_FOWNER",
+	"CAP_MKNOD",
+	"CAP_NET_RAW",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETFCAP",
+	"CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_SYS_CHROOT",
+	"CAP_KILL",
+	"CAP_AUDIT_WRITE",
+}
+
+// capabilityAll is the special capability name meaning all capabilities.
+const capabilityAll = "ALL"
+
 // generateID generates a random unique id.
 func generateID() string {
 	return stringid.GenerateNonCryptoID()
@@ -70,10 +314,57 @@ func makeSandboxName(s *runtime.PodSandboxMetadata) string {
 	}, nameDelimiter)
 }
 
-// getCgroupsPath generates container cgroups path.
-func getCgroupsPath(cgroupsParent string, id string) string {
-	// TODO(random-liu): [P0] Handle systemd.
-	return filepath.Join(cgroupsParent, id)
+// makeContainerName generates container name from sandbox and container metadata.
+// The name generated is unique as long as the sandbox container combination is
+// unique.
+func makeContainerName(c *runtime.ContainerMetadata, s *runtime.PodSandboxMetadata) string {
+	return strings.Join([]string{
+		c.Name,      // 0
+		s.Name,      // 1: sandbox name
+		s.Namespace, // 2: sandbox namespace
+		s.Uid,       // 3: sandbox uid
+		fmt.Sprintf("%d", c.Attempt), // 4
+	}, nameDelimiter)
+}
+
+// getCgroupsPath generates container cgroups path. The default cgroups parent
+// is used if cgroups parent is not specified. With systemd cgroup driver,
+// the cgroups parent should be a slice name, and the cgroups path is in the
+// format of "slice:prefix:name" which runc understands.
+func (c *criContainerdService) getCgroupsPath(cgroupsParent string, id string) (string, error) {
+	if cgroupsParent == "" {
+		cgroupsParent = c.defaultCgroupParent
+	}
+	if !c.systemdCgroup {
+		return filepath.Join(cgroupsParent, id), nil
+	}
+	if err := validateSystemdSlice(cgroupsParent); err != nil {
+		return "", fmt.Errorf("invalid cgroups parent %q: %v", cgroupsParent, err)
+	}
+	return strings.Join([]string{cgroupsParent, systemdScopePrefix, id}, ":"), nil
+}
+
+// validateSystemdSlice validates a systemd slice name, e.g.
+// "kubepods-burstable-pod123.slice". Each dash separated component must not be
+// empty.
+func validateSystemdSlice(slice string) error {
+	if !strings.HasSuffix(slice, systemdSliceSuffix) {
+		return fmt.Errorf("slice name should end with %q", systemdSliceSuffix)
+	}
+	if strings.Contains(slice, "/") {
+		return errors.New("slice name should not contain \"/\"")
+	}
+	name := strings.TrimSuffix(slice, systemdSliceSuffix)
+	if name == "-" {
+		// "-.slice" is the root slice.
+		return nil
+	}
+	for _, component := range strings.Split(name, "-") {
+		if component == "" {
+			return errors.New("slice name should not contain empty component")
+		}
+	}
+	return nil
 }
 
 // getSandboxRootDir returns the root directory for managing sandbox files,
@@ -82,6 +373,110 @@ func getSandboxRootDir(rootDir, id string) string {
 	return filepath.Join(rootDir, sandboxesDir, id)
 }
 
+// getContainerRootDir returns the root directory for managing container files.
+func getContainerRootDir(rootDir, id string) string {
+	return filepath.Join(rootDir, containersDir, id)
+}
+
+// addOwnershipAnnotations adds annotations to identify that the container is
+// managed by cri-containerd, which instance manages it, which sandbox it
+// belongs to and its kind.
+func addOwnershipAnnotations(g *generate.Generator, instanceID, sandboxID, kind string) {
+	g.AddAnnotation(managerAnnotationKey, managerName)
+	if instanceID != "" {
+		g.AddAnnotation(instanceAnnotationKey, instanceID)
+	}
+	g.AddAnnotation(sandboxIDAnnotationKey, sandboxID)
+	g.AddAnnotation(containerKindAnnotationKey, kind)
+}
+
+// getImageStoreName returns the name of an image in the containerd image
+// store. The name is prefixed with the instance id for a named instance, so
+// that instances sharing the same containerd don't see each other's images.
+func (c *criContainerdService) getImageStoreName(name string) string {
+	if c.instanceID == "" {
+		return name
+	}
+	return c.instanceID + "/" + name
+}
+
+// getContainerKind returns the kind of a containerd container managed by
+// cri-containerd, or empty string if the container is not managed by
+// cri-containerd. Containers managed by other cri-containerd instances are
+// not managed, because each instance has its own metadata and root directory.
+// Every container spec carries the ownership annotations, but the containerd
+// api doesn't return the container spec, so they can't be read back here.
+// As a safeguard, the ownership is decided by cri-containerd's own records:
+// the metadata, and the root directory which is always created before the
+// containerd container, so that a container left behind by a crash before
+// its metadata is created is still recognized.
+func (c *criContainerdService) getContainerKind(id string) (string, error) {
+	if id == "" || id == "." || id == ".." || filepath.Base(id) != id {
+		return "", nil
+	}
+	sandbox, err := c.sandboxStore.Get(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to get sandbox metadata: %v", err)
+	}
+	if sandbox != nil {
+		return containerKindSandbox, nil
+	}
+	cntr, err := c.containerStore.Get(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to get container metadata: %v", err)
+	}
+	if cntr != nil {
+		return containerKindContainer, nil
+	}
+	for _, k := range []struct {
+		kind string
+		dir  string
+	}{
+		{kind: containerKindSandbox, dir: getSandboxRootDir(c.rootDir, id)},
+		{kind: containerKindContainer, dir: getContainerRootDir(c.rootDir, id)},
+	} {
+		if _, err := c.os.Stat(k.dir); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", fmt.Errorf("failed to stat %q: %v", k.dir, err)
+		}
+		return k.kind, nil
+	}
+	return "", nil
+}
+
+// listManagedContainers lists containerd containers managed by
+// cri-containerd, containers managed by others are ignored.
+func (c *criContainerdService) listManagedContainers(ctx context.Context) (map[string]*container.Container, error) {
+	resp, err := c.containerService.List(ctx, &execution.ListRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers from containerd: %v", err)
+	}
+	containers := make(map[string]*container.Container)
+	for _, cntr := range resp.Containers {
+		kind, err := c.getContainerKind(cntr.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get kind of container %q: %v", cntr.ID, err)
+		}
+		if kind == "" {
+			glog.V(5).Infof("Ignore container %q not managed by cri-containerd", cntr.ID)
+			continue
+		}
+		containers[cntr.ID] = cntr
+	}
+	return containers, nil
+}
+
+// getContainerLogPath returns the log path of a container, or empty string if
+// the container log is not configured.
+func getContainerLogPath(sandboxConfig *runtime.PodSandboxConfig, config *runtime.ContainerConfig) string {
+	if sandboxConfig.GetLogDirectory() == "" || config.GetLogPath() == "" {
+		return ""
+	}
+	return filepath.Join(sandboxConfig.GetLogDirectory(), config.GetLogPath())
+}
+
 // getStreamingPipes returns the stdin/stdout/stderr pipes path in the root.
 func getStreamingPipes(rootDir string) (string, string, string) {
 	stdin := filepath.Join(rootDir, stdinNamedPipe)
@@ -95,6 +490,21 @@ func getNetworkNamespace(pid uint32) string {
 	return fmt.Sprintf(netNSFormat, pid)
 }
 
+// getIPCNamespace returns the ipc namespace of a process.
+func getIPCNamespace(pid uint32) string {
+	return fmt.Sprintf(ipcNSFormat, pid)
+}
+
+// getUTSNamespace returns the uts namespace of a process.
+func getUTSNamespace(pid uint32) string {
+	return fmt.Sprintf(utsNSFormat, pid)
+}
+
+// getPIDNamespace returns the pid namespace of a process.
+func getPIDNamespace(pid uint32) string {
+	return fmt.Sprintf(pidNSFormat, pid)
+}
+
 // isContainerdContainerNotExistError checks whether a grpc error is containerd
 // ErrContainerNotExist error.
 // TODO(random-liu): Containerd should expose error better through api.
@@ -102,6 +512,12 @@ func isContainerdContainerNotExistError(grpcError error) bool {
 	return grpc.ErrorDesc(grpcError) == containerd.ErrContainerNotExist.Error()
 }
 
+// isContainerdSnapshotNotExistError checks whether a grpc error is containerd
+// ErrSnapshotNotExist error. The error may be wrapped by the snapshotter.
+func isContainerdSnapshotNotExistError(grpcError error) bool {
+	return strings.Contains(grpc.ErrorDesc(grpcError), snapshot.ErrSnapshotNotExist.Error())
+}
+
 // getSandbox gets the sandbox metadata from the sandbox store. It returns nil without
 // error if the sandbox metadata is not found. It also tries to get full sandbox id and
 // retry if the sandbox metadata is not found with the initial id.
@@ -123,3 +539,489 @@ func (c *criContainerdService) getSandbox(id string) (*metadata.SandboxMetadata,
 	}
 	return c.sandboxStore.Get(id)
 }
+
+// getContainer gets the container metadata from the container store. It returns nil without
+// error if the container metadata is not found. It also tries to get full container id and
+// retry if the container metadata is not found with the initial id.
+func (c *criContainerdService) getContainer(id string) (*metadata.ContainerMetadata, error) {
+	container, err := c.containerStore.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("container metadata not found: %v", err)
+	}
+	if container != nil {
+		return container, nil
+	}
+	// container is not found in metadata store, try to extract full id.
+	id, err = c.containerIDIndex.Get(id)
+	if err != nil {
+		if err == truncindex.ErrNotExist {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("container id not found: %v", err)
+	}
+	return c.containerStore.Get(id)
+}
+
+// localResolve resolves image reference to image metadata locally. It returns
+// nil without error if the reference doesn't exist.
+func (c *criContainerdService) localResolve(ref string) (*metadata.ImageMetadata, error) {
+	// Try to get the image with the reference as digest first.
+	meta, err := c.imageMetadataStore.Get(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image %q metadata: %v", ref, err)
+	}
+	if meta != nil {
+		return meta, nil
+	}
+	normalized, err := normalizeImageRef(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference %q: %v", ref, err)
+	}
+	metas, err := c.imageMetadataStore.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list image metadata: %v", err)
+	}
+	for _, meta := range metas {
+		for _, tag := range meta.RepoTags {
+			if tag == normalized {
+				return meta, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// getSeccompProfile gets the seccomp profile of a container from the pod
+// annotations. The container profile overrides the pod profile. Empty
+// container name means the sandbox container, which only uses the pod
+// profile.
+func getSeccompProfile(annotations map[string]string, containerName string) string {
+	if containerName != "" {
+		if profile, ok := annotations[seccompContainerAnnotationKeyPrefix+containerName]; ok {
+			return profile
+		}
+	}
+	return annotations[seccompPodAnnotationKey]
+}
+
+// setOCISeccomp sets seccomp profile in the oci spec. It should be called after
+// capabilities are set, because the runtime default profile allows syscalls
+// based on the capabilities.
+func (c *criContainerdService) setOCISeccomp(g *generate.Generator, profile string) error {
+	spec := g.Spec()
+	switch {
+	case profile == "" || profile == profileNameUnconfined:
+		// Kubernetes defaults to unconfined when no profile is specified.
+		spec.Linux.Seccomp = nil
+	case profile == profileNameRuntimeDefault || profile == profileNameDockerDefault:
+		spec.Linux.Seccomp = seccomp.DefaultProfile(spec)
+	case strings.HasPrefix(profile, profileNamePrefixLocalhost):
+		s, err := c.loadSeccompProfile(strings.TrimPrefix(profile, profileNamePrefixLocalhost))
+		if err != nil {
+			return fmt.Errorf("failed to load seccomp profile %q: %v", profile, err)
+		}
+		spec.Linux.Seccomp = s
+	default:
+		return fmt.Errorf("unsupported seccomp profile %q", profile)
+	}
+	return nil
+}
+
+// loadSeccompProfile loads an oci seccomp profile from a path relative to the
+// seccomp profile root.
+func (c *criContainerdService) loadSeccompProfile(name string) (*runtimespec.LinuxSeccomp, error) {
+	// Make sure the profile doesn't escape from the seccomp profile root.
+	name = filepath.Clean(name)
+	if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return nil, fmt.Errorf("profile path %q is not relative to seccomp profile root", name)
+	}
+	path := filepath.Join(c.seccompProfileRoot, name)
+	data, err := c.os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %v", path, err)
+	}
+	s := &runtimespec.LinuxSeccomp{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %q: %v", path, err)
+	}
+	if s.DefaultAction == "" {
+		return nil, fmt.Errorf("default action is not specified in %q", path)
+	}
+	return s, nil
+}
+
+// getApparmorProfile gets the apparmor profile of a container from the pod
+// annotations.
+func getApparmorProfile(annotations map[string]string, containerName string) string {
+	return annotations[apparmorAnnotationKeyPrefix+containerName]
+}
+
+// getSandboxApparmorProfile gets the apparmor profile of the sandbox container
+// from the pod annotations. The profile set for the sandbox container is used
+// if there is one. Otherwise the sandbox container is confined with the
+// runtime default profile if any container in the pod requests apparmor, and
+// is unconfined if none does.
+func getSandboxApparmorProfile(annotations map[string]string) string {
+	if profile, ok := annotations[apparmorAnnotationKeyPrefix+sandboxApparmorContainerName]; ok {
+		return profile
+	}
+	for k, v := range annotations {
+		if strings.HasPrefix(k, apparmorAnnotationKeyPrefix) && v != profileNameUnconfined {
+			return profileNameRuntimeDefault
+		}
+	}
+	return ""
+}
+
+// setOCIApparmor sets apparmor profile in the oci spec. It returns error if
+// the profile is not loaded on the host.
+func (c *criContainerdService) setOCIApparmor(g *generate.Generator, profile string) error {
+	var name string
+	switch {
+	case profile == "" || profile == profileNameUnconfined:
+		// Do not set apparmor profile when it's not specified.
+		return nil
+	case profile == profileNameRuntimeDefault:
+		name = defaultApparmorProfile
+	case strings.HasPrefix(profile, profileNamePrefixLocalhost):
+		name = strings.TrimPrefix(profile, profileNamePrefixLocalhost)
+	default:
+		return fmt.Errorf("unsupported apparmor profile %q", profile)
+	}
+	if !c.isApparmorEnabled() {
+		return fmt.Errorf("apparmor is not enabled on the host, can not apply profile %q", profile)
+	}
+	loaded, err := c.isApparmorProfileLoaded(name)
+	if err != nil {
+		return fmt.Errorf("failed to check apparmor profile %q: %v", name, err)
+	}
+	if !loaded {
+		return fmt.Errorf("apparmor profile %q is not loaded on the host", name)
+	}
+	g.SetProcessApparmorProfile(name)
+	return nil
+}
+
+// isApparmorEnabled checks whether apparmor is enabled on the host.
+func (c *criContainerdService) isApparmorEnabled() bool {
+	data, err := c.os.ReadFile(apparmorEnabledFile)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(data)) == "Y"
+}
+
+// isApparmorProfileLoaded checks whether an apparmor profile is loaded in the
+// kernel. Each line of the profiles file is in the format of "name (mode)".
+func (c *criContainerdService) isApparmorProfileLoaded(name string) (bool, error) {
+	data, err := c.os.ReadFile(apparmorProfilesFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %q: %v", apparmorProfilesFile, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.LastIndex(line, " ("); i >= 0 {
+			line = line[:i]
+		}
+		if line == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// initSandboxSelinuxLabels initializes selinux process label and mount label of
+// a sandbox. A unique selinux level is allocated for the sandbox if it's not
+// specified in the selinux options. It returns empty labels if selinux is
+// disabled.
+func (c *criContainerdService) initSandboxSelinuxLabels(id string, options *runtime.SELinuxOption) (string, string, error) {
+	if !c.selinuxEnabled {
+		return "", "", nil
+	}
+	level := options.GetLevel()
+	if level == "" {
+		var err error
+		level, err = c.allocateSelinuxLevel(id)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to allocate selinux level: %v", err)
+		}
+	}
+	return c.makeSelinuxLabels(options, level)
+}
+
+// initContainerSelinuxLabels initializes selinux process label and mount label
+// of a container. The container shares the selinux level of the sandbox if the
+// level is not specified in the selinux options. It returns empty labels if
+// selinux is disabled.
+func (c *criContainerdService) initContainerSelinuxLabels(options *runtime.SELinuxOption, sandbox *metadata.SandboxMetadata) (string, string, error) {
+	if !c.selinuxEnabled {
+		return "", "", nil
+	}
+	level := options.GetLevel()
+	if level == "" && sandbox.ProcessLabel != "" {
+		sandboxContext, err := selinux.NewContext(sandbox.ProcessLabel)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to parse sandbox process label: %v", err)
+		}
+		level = sandboxContext.Level
+	}
+	return c.makeSelinuxLabels(options, level)
+}
+
+// makeSelinuxLabels makes selinux process label and mount label from the
+// default labels, the selinux options and the selinux level. The user and level
+// apply to both labels, the role and type only apply to the process label.
+func (c *criContainerdService) makeSelinuxLabels(options *runtime.SELinuxOption, level string) (string, string, error) {
+	processContext, err := selinux.NewContext(c.defaultProcessLabel)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse default process label: %v", err)
+	}
+	mountContext, err := selinux.NewContext(c.defaultMountLabel)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse default mount label: %v", err)
+	}
+	if options.GetUser() != "" {
+		processContext.User = options.GetUser()
+		mountContext.User = options.GetUser()
+	}
+	if options.GetRole() != "" {
+		processContext.Role = options.GetRole()
+	}
+	if options.GetType() != "" {
+		processContext.Type = options.GetType()
+	}
+	if level != "" {
+		processContext.Level = level
+		mountContext.Level = level
+	}
+	return processContext.String(), mountContext.String(), nil
+}
+
+// allocateSelinuxLevel allocates a unique selinux MCS level for a sandbox.
+// The level should be released with selinuxLevelIndex.ReleaseByKey after the
+// sandbox is removed.
+func (c *criContainerdService) allocateSelinuxLevel(id string) (string, error) {
+	for i := 0; i < maxSelinuxLevelAllocateAttempts; i++ {
+		c1, c2 := rand.Intn(selinuxCategoryRange), rand.Intn(selinuxCategoryRange)
+		if c1 == c2 {
+			continue
+		}
+		if c1 > c2 {
+			c1, c2 = c2, c1
+		}
+		level := fmt.Sprintf("s0:c%d,c%d", c1, c2)
+		if err := c.selinuxLevelIndex.Reserve(level, id); err == nil {
+			return level, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find an unused selinux level after %d attempts",
+		maxSelinuxLevelAllocateAttempts)
+}
+
+// setOCISelinux sets selinux process label and mount label in the oci spec.
+func setOCISelinux(g *generate.Generator, processLabel, mountLabel string) {
+	g.SetProcessSelinuxLabel(processLabel)
+	g.SetLinuxMountLabel(mountLabel)
+}
+
+// setOCIPrivileged sets the oci spec to run in privileged mode, all relaxations
+// in privilegedRelaxations are applied.
+func (c *criContainerdService) setOCIPrivileged(g *generate.Generator) error {
+	spec := g.Spec()
+
+	// Grant all capabilities.
+	caps := getAllCapabilities()
+	spec.Process.Capabilities = &runtimespec.LinuxCapabilities{
+		Bounding:    caps,
+		Effective:   append([]string{}, caps...),
+		Inheritable: append([]string{}, caps...),
+		Permitted:   append([]string{}, caps...),
+		Ambient:     append([]string{}, caps...),
+	}
+
+	// Expose all host devices, and allow access to any device.
+	hostDevices, err := c.os.HostDevices()
+	if err != nil {
+		return fmt.Errorf("failed to get host devices: %v", err)
+	}
+	existing := make(map[string]bool)
+	for _, d := range spec.Linux.Devices {
+		existing[d.Path] = true
+	}
+	for _, d := range hostDevices {
+		// Keep devices already in the spec, e.g. CRI devices.
+		if !existing[d.Path] {
+			spec.Linux.Devices = append(spec.Linux.Devices, d)
+		}
+	}
+	if spec.Linux.Resources == nil {
+		spec.Linux.Resources = &runtimespec.LinuxResources{}
+	}
+	spec.Linux.Resources.Devices = []runtimespec.LinuxDeviceCgroup{{Allow: true, Access: "rwm"}}
+
+	// Remove masked and readonly paths.
+	spec.Linux.MaskedPaths = nil
+	spec.Linux.ReadonlyPaths = nil
+
+	// Remove seccomp and apparmor confinement.
+	spec.Linux.Seccomp = nil
+	g.SetProcessApparmorProfile("")
+
+	// Mount sysfs and cgroup read-write.
+	for i, m := range spec.Mounts {
+		if m.Type != "sysfs" && m.Type != "cgroup" {
+			continue
+		}
+		var options []string
+		for _, o := range m.Options {
+			if o != "ro" {
+				options = append(options, o)
+			}
+		}
+		spec.Mounts[i].Options = append(options, "rw")
+	}
+	return nil
+}
+
+// setOCICapabilities sets the capabilities in the oci spec. Capabilities are
+// added to and dropped from the default capability set, "ALL" could be used to
+// add or drop all capabilities. Dropping "ALL" takes precedence over adding
+// "ALL", specific capabilities added are always kept. The same capabilities
+// are set in the bounding, effective, inheritable, permitted and ambient sets.
+func setOCICapabilities(g *generate.Generator, capabilities *runtime.Capability) error {
+	allCaps := getAllCapabilities()
+	add, addAll, err := normalizeCapabilities(capabilities.GetAddCapabilities(), allCaps)
+	if err != nil {
+		return fmt.Errorf("invalid capabilities to add: %v", err)
+	}
+	drop, dropAll, err := normalizeCapabilities(capabilities.GetDropCapabilities(), allCaps)
+	if err != nil {
+		return fmt.Errorf("invalid capabilities to drop: %v", err)
+	}
+
+	base := defaultCapabilities
+	if addAll {
+		base = allCaps
+	}
+	caps := []string{}
+	if !dropAll {
+		for _, c := range base {
+			if !inStringSlice(drop, c) {
+				caps = append(caps, c)
+			}
+		}
+	}
+	for _, c := range add {
+		if !inStringSlice(caps, c) {
+			caps = append(caps, c)
+		}
+	}
+
+	g.Spec().Process.Capabilities = &runtimespec.LinuxCapabilities{
+		Bounding:    caps,
+		Effective:   append([]string{}, caps...),
+		Inheritable: append([]string{}, caps...),
+		Permitted:   append([]string{}, caps...),
+		Ambient:     append([]string{}, caps...),
+	}
+	return nil
+}
+
+// normalizeCapabilities converts capabilities into the oci format, e.g.
+// "net_admin" into "CAP_NET_ADMIN". It returns whether "ALL" is specified
+// separately, and returns error if a capability is not supported.
+func normalizeCapabilities(caps []string, allCaps []string) ([]string, bool, error) {
+	var normalized []string
+	all := false
+	for _, c := range caps {
+		c = strings.ToUpper(c)
+		if c == capabilityAll {
+			all = true
+			continue
+		}
+		if !strings.HasPrefix(c, "CAP_") {
+			c = "CAP_" + c
+		}
+		if !inStringSlice(allCaps, c) {
+			return nil, false, fmt.Errorf("unknown capability %q", c)
+		}
+		normalized = append(normalized, c)
+	}
+	return normalized, all, nil
+}
+
+// inStringSlice checks whether a string is in the slice.
+func inStringSlice(ss []string, str string) bool {
+	for _, s := range ss {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// getAllCapabilities returns all capabilities supported by the kernel.
+func getAllCapabilities() []string {
+	var caps []string
+	for _, cap := range capability.List() {
+		if cap > capability.CAP_LAST_CAP {
+			continue
+		}
+		caps = append(caps, "CAP_"+strings.ToUpper(cap.String()))
+	}
+	return caps
+}
+
+// toCRIImage converts image metadata to CRI image.
+func toCRIImage(meta *metadata.ImageMetadata) *runtime.Image {
+	image := &runtime.Image{
+		Id:          meta.ID,
+		RepoTags:    meta.RepoTags,
+		RepoDigests: meta.RepoDigests,
+		Size_:       meta.Size,
+	}
+	if meta.Config != nil {
+		image.Uid, image.Username = getUserFromImage(meta.Config.User)
+	}
+	return image
+}
+
+// getUserFromImage gets uid or user name of the image user. The group part of
+// the image user is ignored.
+// If the user is numeric, it returns uid; otherwise, it returns user name.
+func getUserFromImage(user string) (*runtime.Int64Value, string) {
+	// return both empty if user is not specified in the image.
+	if user == "" {
+		return nil, ""
+	}
+	// split instances where the id may contain user:group
+	user = strings.Split(user, ":")[0]
+	// user could be either uid or user name. Try to interpret as numeric uid.
+	uid, err := strconv.ParseInt(user, 10, 64)
+	if err != nil {
+		// If user is non numeric, assume it's user name.
+		return nil, user
+	}
+	// If user is a numeric uid.
+	return &runtime.Int64Value{Value: uid}, ""
+}
+
+// criContainerStateToString formats CRI container state to string.
+func criContainerStateToString(state runtime.ContainerState) string {
+	return runtime.ContainerState_name[int32(state)]
+}
+
+// parseSignal parses a signal in the image config, e.g. "SIGTERM", "TERM"
+// or "15".
+func parseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.ParseUint(s, 10, 8); err == nil {
+		if n == 0 {
+			return 0, fmt.Errorf("invalid signal %q", s)
+		}
+		return syscall.Signal(n), nil
+	}
+	signal, ok := signalMap[strings.TrimPrefix(strings.ToUpper(s), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal %q", s)
+	}
+	return signal, nil
+}
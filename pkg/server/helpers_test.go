@@ -17,11 +17,28 @@ limitations under the License.
 package server
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/opencontainers/runtime-tools/generate/seccomp"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/containerd/containerd/api/types/container"
 
 	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+	ostesting "github.com/kubernetes-incubator/cri-containerd/pkg/os/testing"
+	"github.com/kubernetes-incubator/cri-containerd/pkg/selinux"
+	servertesting "github.com/kubernetes-incubator/cri-containerd/pkg/server/testing"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
 )
 
 func TestGetSandbox(t *testing.T) {
@@ -57,3 +74,645 @@ func TestGetSandbox(t *testing.T) {
 		assert.Equal(t, test.expected, sb)
 	}
 }
+
+func TestGetSeccompProfile(t *testing.T) {
+	testContainerName := "test-container"
+	for desc, test := range map[string]struct {
+		annotations   map[string]string
+		containerName string
+		expected      string
+	}{
+		"should return empty profile without annotation": {
+			containerName: testContainerName,
+			expected:      "",
+		},
+		"should return pod profile for container without container annotation": {
+			annotations: map[string]string{
+				seccompPodAnnotationKey: profileNameRuntimeDefault,
+			},
+			containerName: testContainerName,
+			expected:      profileNameRuntimeDefault,
+		},
+		"should return container profile when container annotation is set": {
+			annotations: map[string]string{
+				seccompPodAnnotationKey:                                 profileNameRuntimeDefault,
+				seccompContainerAnnotationKeyPrefix + testContainerName: profileNamePrefixLocalhost + "test-profile",
+			},
+			containerName: testContainerName,
+			expected:      profileNamePrefixLocalhost + "test-profile",
+		},
+		"should return pod profile for sandbox container": {
+			annotations: map[string]string{
+				seccompPodAnnotationKey:                                 profileNameUnconfined,
+				seccompContainerAnnotationKeyPrefix + testContainerName: profileNameRuntimeDefault,
+			},
+			containerName: "",
+			expected:      profileNameUnconfined,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		assert.Equal(t, test.expected, getSeccompProfile(test.annotations, test.containerName))
+	}
+}
+
+func TestSetOCISeccomp(t *testing.T) {
+	testProfile := `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ALLOW"}]}`
+	for desc, test := range map[string]struct {
+		profile     string
+		fileContent string
+		expectPath  string
+		expectErr   bool
+		expected    *runtimespec.LinuxSeccomp
+	}{
+		"should set unconfined when profile is empty": {
+			profile: "",
+		},
+		"should set unconfined when profile is unconfined": {
+			profile: profileNameUnconfined,
+		},
+		"should load profile relative to seccomp profile root": {
+			profile:     profileNamePrefixLocalhost + "test/profile.json",
+			fileContent: testProfile,
+			expectPath:  filepath.Join(testSeccompProfileRoot, "test/profile.json"),
+			expected: &runtimespec.LinuxSeccomp{
+				DefaultAction: runtimespec.ActErrno,
+				Syscalls: []runtimespec.LinuxSyscall{{
+					Names:  []string{"read"},
+					Action: runtimespec.ActAllow,
+				}},
+			},
+		},
+		"should return error if localhost profile escapes seccomp profile root": {
+			profile:   profileNamePrefixLocalhost + "../profile.json",
+			expectErr: true,
+		},
+		"should return error if localhost profile is absolute path": {
+			profile:   profileNamePrefixLocalhost + "/profile.json",
+			expectErr: true,
+		},
+		"should return error if localhost profile has no default action": {
+			profile:     profileNamePrefixLocalhost + "profile.json",
+			fileContent: `{"syscalls": []}`,
+			expectPath:  filepath.Join(testSeccompProfileRoot, "profile.json"),
+			expectErr:   true,
+		},
+		"should return error for unknown profile": {
+			profile:   "unknown",
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		fakeOS := c.os.(*ostesting.FakeOS)
+		fakeOS.ReadFileFn = func(filename string) ([]byte, error) {
+			assert.Equal(t, test.expectPath, filename)
+			return []byte(test.fileContent), nil
+		}
+		g := generate.New()
+		err := c.setOCISeccomp(&g, test.profile)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, g.Spec().Linux.Seccomp)
+	}
+
+	t.Logf("TestCase %q", "should set default profile for runtime/default")
+	c := newTestCRIContainerdService()
+	g := generate.New()
+	assert.NoError(t, c.setOCISeccomp(&g, profileNameRuntimeDefault))
+	assert.Equal(t, seccomp.DefaultProfile(g.Spec()), g.Spec().Linux.Seccomp)
+}
+
+func TestGetSandboxApparmorProfile(t *testing.T) {
+	for desc, test := range map[string]struct {
+		annotations map[string]string
+		expected    string
+	}{
+		"should be unconfined without apparmor annotation": {
+			annotations: map[string]string{"a": "b"},
+			expected:    "",
+		},
+		"should be unconfined when all containers are unconfined": {
+			annotations: map[string]string{
+				apparmorAnnotationKeyPrefix + "c1": profileNameUnconfined,
+			},
+			expected: "",
+		},
+		"should use runtime default when any container requests apparmor": {
+			annotations: map[string]string{
+				apparmorAnnotationKeyPrefix + "c1": profileNameUnconfined,
+				apparmorAnnotationKeyPrefix + "c2": profileNamePrefixLocalhost + "test-profile",
+			},
+			expected: profileNameRuntimeDefault,
+		},
+		"should use the profile of the sandbox container": {
+			annotations: map[string]string{
+				apparmorAnnotationKeyPrefix + "c1":                         profileNameRuntimeDefault,
+				apparmorAnnotationKeyPrefix + sandboxApparmorContainerName: profileNamePrefixLocalhost + "test-profile",
+			},
+			expected: profileNamePrefixLocalhost + "test-profile",
+		},
+		"should be unconfined when the sandbox container is unconfined": {
+			annotations: map[string]string{
+				apparmorAnnotationKeyPrefix + "c1":                         profileNameRuntimeDefault,
+				apparmorAnnotationKeyPrefix + sandboxApparmorContainerName: profileNameUnconfined,
+			},
+			expected: profileNameUnconfined,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		assert.Equal(t, test.expected, getSandboxApparmorProfile(test.annotations))
+	}
+}
+
+func TestSetOCIApparmor(t *testing.T) {
+	testProfiles := defaultApparmorProfile + " (enforce)\ntest-profile (complain)\n"
+	for desc, test := range map[string]struct {
+		profile   string
+		disabled  bool
+		expectErr bool
+		expected  string
+	}{
+		"should not set profile when profile is empty": {
+			profile:  "",
+			expected: "",
+		},
+		"should not set profile when profile is unconfined": {
+			profile:  profileNameUnconfined,
+			expected: "",
+		},
+		"should set default profile for runtime/default": {
+			profile:  profileNameRuntimeDefault,
+			expected: defaultApparmorProfile,
+		},
+		"should set localhost profile": {
+			profile:  profileNamePrefixLocalhost + "test-profile",
+			expected: "test-profile",
+		},
+		"should return error when localhost profile is not loaded": {
+			profile:   profileNamePrefixLocalhost + "unknown-profile",
+			expectErr: true,
+		},
+		"should return error when apparmor is disabled": {
+			profile:   profileNameRuntimeDefault,
+			disabled:  true,
+			expectErr: true,
+		},
+		"should return error for unknown profile": {
+			profile:   "unknown",
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		fakeOS := c.os.(*ostesting.FakeOS)
+		fakeOS.ReadFileFn = func(filename string) ([]byte, error) {
+			switch filename {
+			case apparmorEnabledFile:
+				if test.disabled {
+					return []byte("N\n"), nil
+				}
+				return []byte("Y\n"), nil
+			case apparmorProfilesFile:
+				return []byte(testProfiles), nil
+			}
+			return nil, fmt.Errorf("unexpected file %q", filename)
+		}
+		g := generate.New()
+		err := c.setOCIApparmor(&g, test.profile)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, g.Spec().Process.ApparmorProfile)
+	}
+}
+
+func TestInitSelinuxLabels(t *testing.T) {
+	testID := "test-id"
+	testProcessLabel := "system_u:system_r:svirt_lxc_net_t:s0"
+	testMountLabel := "system_u:object_r:svirt_sandbox_file_t:s0"
+	c := newTestCRIContainerdService()
+	c.defaultProcessLabel = testProcessLabel
+	c.defaultMountLabel = testMountLabel
+
+	t.Logf("should return empty labels when selinux is disabled")
+	processLabel, mountLabel, err := c.initSandboxSelinuxLabels(testID, &runtime.SELinuxOption{Level: "s0:c1,c2"})
+	assert.NoError(t, err)
+	assert.Empty(t, processLabel)
+	assert.Empty(t, mountLabel)
+	processLabel, mountLabel, err = c.initContainerSelinuxLabels(&runtime.SELinuxOption{Level: "s0:c1,c2"},
+		&metadata.SandboxMetadata{ProcessLabel: testProcessLabel})
+	assert.NoError(t, err)
+	assert.Empty(t, processLabel)
+	assert.Empty(t, mountLabel)
+
+	c.selinuxEnabled = true
+	t.Logf("should apply selinux options to sandbox labels")
+	processLabel, mountLabel, err = c.initSandboxSelinuxLabels(testID, &runtime.SELinuxOption{
+		User:  "test_u",
+		Role:  "test_r",
+		Type:  "test_t",
+		Level: "s0:c1,c2",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "test_u:test_r:test_t:s0:c1,c2", processLabel)
+	assert.Equal(t, "test_u:object_r:svirt_sandbox_file_t:s0:c1,c2", mountLabel)
+
+	t.Logf("should allocate a unique level for sandbox when level is not specified")
+	processLabel, mountLabel, err = c.initSandboxSelinuxLabels(testID, nil)
+	assert.NoError(t, err)
+	processContext, err := selinux.NewContext(processLabel)
+	assert.NoError(t, err)
+	mountContext, err := selinux.NewContext(mountLabel)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^s0:c\d+,c\d+$`, processContext.Level)
+	assert.Equal(t, processContext.Level, mountContext.Level)
+	assert.Error(t, c.selinuxLevelIndex.Reserve(processContext.Level, "another-id"),
+		"allocated level should be reserved")
+
+	t.Logf("container should share the selinux level of the sandbox")
+	sandbox := &metadata.SandboxMetadata{ID: testID, ProcessLabel: processLabel, MountLabel: mountLabel}
+	cProcessLabel, cMountLabel, err := c.initContainerSelinuxLabels(&runtime.SELinuxOption{Type: "test_t"}, sandbox)
+	assert.NoError(t, err)
+	assert.Equal(t, "system_u:system_r:test_t:"+processContext.Level, cProcessLabel)
+	assert.Equal(t, mountLabel, cMountLabel)
+
+	t.Logf("container level should override the sandbox level")
+	cProcessLabel, cMountLabel, err = c.initContainerSelinuxLabels(&runtime.SELinuxOption{Level: "s0:c3,c4"}, sandbox)
+	assert.NoError(t, err)
+	assert.Equal(t, "system_u:system_r:svirt_lxc_net_t:s0:c3,c4", cProcessLabel)
+	assert.Equal(t, "system_u:object_r:svirt_sandbox_file_t:s0:c3,c4", cMountLabel)
+}
+
+func TestGetUserFromImage(t *testing.T) {
+	newI64 := func(i int64) *runtime.Int64Value { return &runtime.Int64Value{Value: i} }
+	for c, test := range map[string]struct {
+		user string
+		uid  *runtime.Int64Value
+		name string
+	}{
+		"no gid": {
+			user: "0",
+			uid:  newI64(0),
+		},
+		"uid/gid": {
+			user: "0:1",
+			uid:  newI64(0),
+		},
+		"empty user": {
+			user: "",
+		},
+		"multiple spearators": {
+			user: "1:2:3",
+			uid:  newI64(1),
+		},
+		"root username": {
+			user: "root:root",
+			name: "root",
+		},
+		"username": {
+			user: "test:test",
+			name: "test",
+		},
+	} {
+		t.Logf("TestCase - %q", c)
+		actualUID, actualName := getUserFromImage(test.user)
+		assert.Equal(t, test.uid, actualUID)
+		assert.Equal(t, test.name, actualName)
+	}
+}
+
+func TestSetOCICapabilities(t *testing.T) {
+	allCaps := getAllCapabilities()
+	for desc, test := range map[string]struct {
+		capabilities *runtime.Capability
+		expectErr    bool
+		expected     []string
+	}{
+		"should use default capabilities if not specified": {
+			expected: defaultCapabilities,
+		},
+		"should add and drop capabilities": {
+			capabilities: &runtime.Capability{
+				AddCapabilities:  []string{"NET_ADMIN", "cap_sys_admin", "CHOWN"},
+				DropCapabilities: []string{"CAP_KILL", "mknod"},
+			},
+			expected: []string{
+				"CAP_CHOWN",
+				"CAP_DAC_OVERRIDE",
+				"CAP_FSETID",
+				"CAP_FOWNER",
+				"CAP_NET_RAW",
+				"CAP_SETGID",
+				"CAP_SETUID",
+				"CAP_SETFCAP",
+				"CAP_SETPCAP",
+				"CAP_NET_BIND_SERVICE",
+				"CAP_SYS_CHROOT",
+				"CAP_AUDIT_WRITE",
+				"CAP_NET_ADMIN",
+				"CAP_SYS_ADMIN",
+			},
+		},
+		"should add all capabilities": {
+			capabilities: &runtime.Capability{
+				AddCapabilities: []string{"ALL"},
+			},
+			expected: allCaps,
+		},
+		"should add all capabilities except dropped ones": {
+			capabilities: &runtime.Capability{
+				AddCapabilities:  []string{"all"},
+				DropCapabilities: []string{"SYS_ADMIN"},
+			},
+			expected: func() []string {
+				var caps []string
+				for _, c := range allCaps {
+					if c != "CAP_SYS_ADMIN" {
+						caps = append(caps, c)
+					}
+				}
+				return caps
+			}(),
+		},
+		"should drop all capabilities and keep added ones": {
+			capabilities: &runtime.Capability{
+				AddCapabilities:  []string{"NET_BIND_SERVICE"},
+				DropCapabilities: []string{"ALL"},
+			},
+			expected: []string{"CAP_NET_BIND_SERVICE"},
+		},
+		"should drop all capabilities": {
+			capabilities: &runtime.Capability{
+				AddCapabilities:  []string{"ALL"},
+				DropCapabilities: []string{"ALL"},
+			},
+			expected: []string{},
+		},
+		"should return error for unknown capability": {
+			capabilities: &runtime.Capability{
+				AddCapabilities: []string{"UNKNOWN"},
+			},
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		g := generate.New()
+		err := setOCICapabilities(&g, test.capabilities)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		caps := g.Spec().Process.Capabilities
+		assert.Equal(t, test.expected, caps.Bounding)
+		assert.Equal(t, test.expected, caps.Effective)
+		assert.Equal(t, test.expected, caps.Inheritable)
+		assert.Equal(t, test.expected, caps.Permitted)
+		assert.Equal(t, test.expected, caps.Ambient)
+	}
+}
+
+func TestSetOCIPrivileged(t *testing.T) {
+	criDevice := runtimespec.LinuxDevice{Path: "/dev/test", Type: "c", Major: 1, Minor: 1}
+	hostDevices := []runtimespec.LinuxDevice{
+		{Path: "/dev/test", Type: "c", Major: 2, Minor: 2},
+		{Path: "/dev/sda", Type: "b", Major: 8, Minor: 0},
+	}
+	c := newTestCRIContainerdService()
+	fakeOS := c.os.(*ostesting.FakeOS)
+	fakeOS.HostDevicesFn = func() ([]runtimespec.LinuxDevice, error) {
+		return hostDevices, nil
+	}
+	g := c.newSpecGenerator()
+	g.AddDevice(criDevice)
+	g.SetProcessApparmorProfile("test-profile")
+	g.Spec().Linux.Seccomp = &runtimespec.LinuxSeccomp{DefaultAction: runtimespec.ActErrno}
+	spec := g.Spec()
+	assert.NotEmpty(t, spec.Linux.MaskedPaths, "default spec should have masked paths")
+	assert.NotEmpty(t, spec.Linux.ReadonlyPaths, "default spec should have readonly paths")
+
+	assert.NoError(t, c.setOCIPrivileged(&g))
+
+	t.Logf("all capabilities should be granted")
+	allCaps := getAllCapabilities()
+	assert.Equal(t, allCaps, spec.Process.Capabilities.Bounding)
+	assert.Equal(t, allCaps, spec.Process.Capabilities.Effective)
+	assert.Equal(t, allCaps, spec.Process.Capabilities.Inheritable)
+	assert.Equal(t, allCaps, spec.Process.Capabilities.Permitted)
+	assert.Equal(t, allCaps, spec.Process.Capabilities.Ambient)
+
+	t.Logf("host devices should be added without overriding existing devices")
+	assert.Equal(t, []runtimespec.LinuxDevice{criDevice, hostDevices[1]}, spec.Linux.Devices)
+	assert.Equal(t, []runtimespec.LinuxDeviceCgroup{{Allow: true, Access: "rwm"}}, spec.Linux.Resources.Devices)
+
+	t.Logf("masked and readonly paths should be removed")
+	assert.Empty(t, spec.Linux.MaskedPaths)
+	assert.Empty(t, spec.Linux.ReadonlyPaths)
+
+	t.Logf("seccomp and apparmor should be unconfined")
+	assert.Nil(t, spec.Linux.Seccomp)
+	assert.Empty(t, spec.Process.ApparmorProfile)
+
+	t.Logf("sysfs and cgroup should be mounted read-write")
+	var checked int
+	for _, m := range spec.Mounts {
+		if m.Type != "sysfs" && m.Type != "cgroup" {
+			continue
+		}
+		checked++
+		assert.Contains(t, m.Options, "rw", "mount %q", m.Destination)
+		assert.NotContains(t, m.Options, "ro", "mount %q", m.Destination)
+	}
+	assert.NotZero(t, checked, "default spec should have sysfs or cgroup mounts")
+
+	t.Logf("should return error if host devices can not be listed")
+	fakeOS.HostDevicesFn = func() ([]runtimespec.LinuxDevice, error) {
+		return nil, errors.New("test error")
+	}
+	g = c.newSpecGenerator()
+	assert.Error(t, c.setOCIPrivileged(&g))
+}
+
+func TestGetCgroupsPath(t *testing.T) {
+	testID := "test-id"
+	for desc, test := range map[string]struct {
+		cgroupsParent       string
+		defaultCgroupParent string
+		systemdCgroup       bool
+		expected            string
+		expectErr           bool
+	}{
+		"should support regular cgroup path": {
+			cgroupsParent: "/a/b",
+			expected:      "/a/b/test-id",
+		},
+		"should support systemd slice": {
+			cgroupsParent: "kubepods-burstable-pod123.slice",
+			systemdCgroup: true,
+			expected:      "kubepods-burstable-pod123.slice:cri-containerd:test-id",
+		},
+		"should support systemd root slice": {
+			cgroupsParent: "-.slice",
+			systemdCgroup: true,
+			expected:      "-.slice:cri-containerd:test-id",
+		},
+		"should use default cgroup parent if not specified": {
+			defaultCgroupParent: "/default",
+			expected:            "/default/test-id",
+		},
+		"should use default systemd slice if not specified": {
+			defaultCgroupParent: "cri-containerd.slice",
+			systemdCgroup:       true,
+			expected:            "cri-containerd.slice:cri-containerd:test-id",
+		},
+		"should return error if systemd slice doesn't end with .slice": {
+			cgroupsParent: "kubepods-burstable-pod123",
+			systemdCgroup: true,
+			expectErr:     true,
+		},
+		"should return error if systemd slice is a path": {
+			cgroupsParent: "/kubepods.slice/kubepods-burstable.slice",
+			systemdCgroup: true,
+			expectErr:     true,
+		},
+		"should return error if systemd slice has empty component": {
+			cgroupsParent: "kubepods--burstable.slice",
+			systemdCgroup: true,
+			expectErr:     true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		c.systemdCgroup = test.systemdCgroup
+		c.defaultCgroupParent = test.defaultCgroupParent
+		path, err := c.getCgroupsPath(test.cgroupsParent, testID)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, path)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for desc, test := range map[string]struct {
+		signal    string
+		expected  syscall.Signal
+		expectErr bool
+	}{
+		"should parse signal name": {
+			signal:   "SIGQUIT",
+			expected: syscall.SIGQUIT,
+		},
+		"should parse signal name without SIG prefix": {
+			signal:   "usr1",
+			expected: syscall.SIGUSR1,
+		},
+		"should parse signal number": {
+			signal:   "9",
+			expected: syscall.SIGKILL,
+		},
+		"should return error for unknown signal name": {
+			signal:    "SIGUNKNOWN",
+			expectErr: true,
+		},
+		"should return error for signal 0": {
+			signal:    "0",
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		signal, err := parseSignal(test.signal)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, signal)
+	}
+}
+
+func TestListManagedContainers(t *testing.T) {
+	c := newTestCRIContainerdService()
+	fake := c.containerService.(*servertesting.FakeExecutionClient)
+	fakeOS := c.os.(*ostesting.FakeOS)
+	fakeOS.StatFn = func(name string) (os.FileInfo, error) {
+		switch name {
+		case getSandboxRootDir(testRootDir, "sandbox"), getContainerRootDir(testRootDir, "container"):
+			return nil, nil
+		case getSandboxRootDir(testRootDir, "error"):
+			return nil, errors.New("random error")
+		}
+		return nil, os.ErrNotExist
+	}
+	require.NoError(t, c.sandboxStore.Create(metadata.SandboxMetadata{ID: "sandbox-without-dir"}))
+	require.NoError(t, c.containerStore.Create(metadata.ContainerMetadata{ID: "container-without-dir"}))
+	for id, expectKind := range map[string]string{
+		"sandbox":               containerKindSandbox,
+		"container":             containerKindContainer,
+		"sandbox-without-dir":   containerKindSandbox,
+		"container-without-dir": containerKindContainer,
+		"not-managed":           "",
+		"..":                    "",
+	} {
+		t.Logf("TestCase %q", id)
+		kind, err := c.getContainerKind(id)
+		assert.NoError(t, err)
+		assert.Equal(t, expectKind, kind)
+	}
+	_, err := c.getContainerKind("error")
+	assert.Error(t, err)
+
+	fake.SetFakeContainers([]container.Container{
+		{ID: "sandbox"},
+		{ID: "container"},
+		{ID: "not-managed"},
+	})
+	containers, err := c.listManagedContainers(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*container.Container{
+		"sandbox":   {ID: "sandbox"},
+		"container": {ID: "container"},
+	}, containers)
+}
+
+func TestOwnershipAnnotations(t *testing.T) {
+	for desc, test := range map[string]struct {
+		instanceID        string
+		expectAnnotations map[string]string
+		expectImageName   string
+	}{
+		"default instance": {
+			expectAnnotations: map[string]string{
+				managerAnnotationKey:       managerName,
+				sandboxIDAnnotationKey:     "sandbox-id",
+				containerKindAnnotationKey: containerKindContainer,
+			},
+			expectImageName: "docker.io/library/busybox:latest",
+		},
+		"named instance": {
+			instanceID: "test-instance",
+			expectAnnotations: map[string]string{
+				managerAnnotationKey:       managerName,
+				instanceAnnotationKey:      "test-instance",
+				sandboxIDAnnotationKey:     "sandbox-id",
+				containerKindAnnotationKey: containerKindContainer,
+			},
+			expectImageName: "test-instance/docker.io/library/busybox:latest",
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		c.instanceID = test.instanceID
+		g := generate.New()
+		addOwnershipAnnotations(&g, c.instanceID, "sandbox-id", containerKindContainer)
+		assert.Equal(t, test.expectAnnotations, g.Spec().Annotations)
+		assert.Equal(t, test.expectImageName, c.getImageStoreName("docker.io/library/busybox:latest"))
+	}
+}
@@ -35,15 +35,8 @@ func (c *criContainerdService) ListImages(ctx context.Context, r *runtime.ListIm
 	// Get other information from containerd image/content store
 
 	var images []*runtime.Image
-	for _, image := range imageMetadataA { // TODO(mikebrow): write a ImageMetadata to runtime.Image converter
-		ri := &runtime.Image{
-			Id:          image.ID,
-			RepoTags:    image.RepoTags,
-			RepoDigests: image.RepoDigests,
-			Size_:       image.Size,
-			// TODO(mikebrow): Uid and Username?
-		}
-		images = append(images, ri)
+	for _, image := range imageMetadataA {
+		images = append(images, toCRIImage(image))
 	}
 
 	return &runtime.ListImagesResponse{Images: images}, nil
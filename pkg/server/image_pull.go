@@ -26,6 +26,7 @@ import (
 	"github.com/containerd/containerd/remotes/docker"
 	"github.com/docker/distribution/reference"
 	"github.com/golang/glog"
+	"github.com/opencontainers/go-digest"
 	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 	"golang.org/x/net/context"
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
@@ -44,11 +45,6 @@ func (c *criContainerdService) PullImage(ctx context.Context, r *runtime.PullIma
 		}
 	}()
 
-	var (
-		size int64
-		desc imagespec.Descriptor
-	)
-
 	image, err := normalizeImageRef(r.GetImage().GetImage())
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse image reference %q: %v", r.GetImage().GetImage(), err)
@@ -57,10 +53,11 @@ func (c *criContainerdService) PullImage(ctx context.Context, r *runtime.PullIma
 		glog.V(4).Info("PullImage using normalized image ref: %q", image)
 	}
 
-	if desc, size, err = c.pullImage(ctx, image); err != nil {
+	result, err := c.pullImage(ctx, image)
+	if err != nil {
 		return nil, fmt.Errorf("failed to pull image %q: %v", image, err)
 	}
-	digest := desc.Digest.String() // TODO(mikebrow): add truncIndex for image id
+	digest := result.desc.Digest.String() // TODO(mikebrow): add truncIndex for image id
 
 	// TODO(mikebrow): pass a metadata struct to pullimage and fill in the tags/digests
 	// store the image metadata
@@ -69,7 +66,10 @@ func (c *criContainerdService) PullImage(ctx context.Context, r *runtime.PullIma
 		ID:          digest,
 		RepoTags:    []string{image},
 		RepoDigests: []string{digest},
-		Size:        uint64(size), // TODO(mikebrow):  compressed or uncompressed size? using compressed
+		Size:        uint64(result.size), // TODO(mikebrow):  compressed or uncompressed size? using compressed
+		ChainID:     result.chainID.String(),
+		Config:      result.config,
+		StopSignal:  result.stopSignal,
 	}
 	if err = c.imageMetadataStore.Create(*meta); err != nil {
 		return &runtime.PullImageResponse{ImageRef: digest},
@@ -91,93 +91,46 @@ func normalizeImageRef(ref string) (string, error) {
 	return named.String(), nil
 }
 
-// imageReferenceResolver attempts to resolve the image reference into a name
-// and manifest via the containerd library call..
-//
-// The argument `ref` should be a scheme-less URI representing the remote.
-// Structurally, it has a host and path. The "host" can be used to directly
-// reference a specific host or be matched against a specific handler.
-//
-// The returned name should be used to identify the referenced entity.
-// Dependending on the remote namespace, this may be immutable or mutable.
-// While the name may differ from ref, it should itself be a valid ref.
-//
-// If the resolution fails, an error will be returned.
-// TODO(mikebrow) add config.json based image.Config as an additional return value from this resolver fn()
-func (c *criContainerdService) imageReferenceResolver(ctx context.Context, ref string) (resolvedImageName string, manifest imagespec.Manifest, compressedSize uint64, err error) {
-	var (
-		size    int64
-		desc    imagespec.Descriptor
-		fetcher remotes.Fetcher
-	)
-
-	// Resolve the image name; place that in the image store; then dispatch
-	// a handler to fetch the object for the manifest
-	resolver := docker.NewResolver()
-	resolvedImageName, desc, fetcher, err = resolver.Resolve(ctx, ref)
-	if err != nil {
-		return resolvedImageName, manifest, compressedSize, fmt.Errorf("failed to resolve ref %q: err: %v", ref, err)
-	}
-
-	err = c.imageStoreService.Put(ctx, resolvedImageName, desc)
-	if err != nil {
-		return resolvedImageName, manifest, compressedSize, fmt.Errorf("failed to put %q: desc: %v err: %v", resolvedImageName, desc, err)
-	}
-
-	err = containerdimages.Dispatch(
-		ctx,
-		remotes.FetchHandler(c.contentIngester, fetcher),
-		desc)
-	if err != nil {
-		return resolvedImageName, manifest, compressedSize, fmt.Errorf("failed to fetch %q: desc: %v err: %v", resolvedImageName, desc, err)
-	}
-
-	image, err := c.imageStoreService.Get(ctx, resolvedImageName)
-	if err != nil {
-		return resolvedImageName, manifest, compressedSize,
-			fmt.Errorf("get failed for image:%q err: %v", resolvedImageName, err)
-	}
-	p, err := content.ReadBlob(ctx, c.contentProvider, image.Target.Digest)
-	if err != nil {
-		return resolvedImageName, manifest, compressedSize,
-			fmt.Errorf("readblob failed for digest:%q err: %v", image.Target.Digest, err)
-	}
-	err = json.Unmarshal(p, &manifest)
-	if err != nil {
-		return resolvedImageName, manifest, compressedSize,
-			fmt.Errorf("unmarshal blob to manifest failed for digest:%q err: %v", image.Target.Digest, err)
-	}
-	size, err = image.Size(ctx, c.contentProvider)
-	if err != nil {
-		return resolvedImageName, manifest, compressedSize,
-			fmt.Errorf("size failed for image:%q %v", image.Target.Digest, err)
-	}
-	compressedSize = uint64(size)
-	return resolvedImageName, manifest, compressedSize, nil
+// imageStopSignal is used to decode the stop signal in the image config.
+// It is decoded separately because the vendored image-spec doesn't have the
+// StopSignal field in ImageConfig.
+type imageStopSignal struct {
+	Config struct {
+		StopSignal string `json:"StopSignal,omitempty"`
+	} `json:"config,omitempty"`
 }
 
-func (c *criContainerdService) pullImage(ctx context.Context, ref string) (imagespec.Descriptor, int64, error) {
-	var (
-		err               error
-		size              int64
-		desc              imagespec.Descriptor
-		resolvedImageName string
-		fetcher           remotes.Fetcher
-	)
+// pullResult is the result of pulling an image.
+type pullResult struct {
+	// desc is the descriptor of the image manifest.
+	desc imagespec.Descriptor
+	// chainID is the chain id of the unpacked image layers.
+	chainID digest.Digest
+	// size is the size of the image content.
+	size int64
+	// config is the oci image config.
+	config *imagespec.ImageConfig
+	// stopSignal is the stop signal in the image config, see
+	// imageStopSignal.
+	stopSignal string
+}
 
+func (c *criContainerdService) pullImage(ctx context.Context, ref string) (*pullResult, error) {
 	// Resolve the image name; place that in the image store; then dispatch
 	// a handler for a sequence of handlers which: 1) fetch the object using a
 	// FetchHandler; and 3) recurse through any sub-layers via a ChildrenHandler
 	resolver := docker.NewResolver()
 
-	resolvedImageName, desc, fetcher, err = resolver.Resolve(ctx, ref)
+	resolvedImageName, desc, fetcher, err := resolver.Resolve(ctx, ref)
 	if err != nil {
-		return desc, size, fmt.Errorf("failed to resolve ref %q: err: %v", ref, err)
+		return nil, fmt.Errorf("failed to resolve ref %q: err: %v", ref, err)
 	}
 
-	err = c.imageStoreService.Put(ctx, resolvedImageName, desc)
+	// Use instance specific name in the containerd image store.
+	storeName := c.getImageStoreName(resolvedImageName)
+	err = c.imageStoreService.Put(ctx, storeName, desc)
 	if err != nil {
-		return desc, size, fmt.Errorf("failed to put %q: desc: %v err: %v", resolvedImageName, desc, err)
+		return nil, fmt.Errorf("failed to put %q: desc: %v err: %v", storeName, desc, err)
 	}
 
 	err = containerdimages.Dispatch(
@@ -187,34 +140,48 @@ func (c *criContainerdService) pullImage(ctx context.Context, ref string) (image
 			containerdimages.ChildrenHandler(c.contentProvider)),
 		desc)
 	if err != nil {
-		return desc, size, fmt.Errorf("failed to fetch %q: desc: %v err: %v", resolvedImageName, desc, err)
+		return nil, fmt.Errorf("failed to fetch %q: desc: %v err: %v", resolvedImageName, desc, err)
 	}
 
-	image, err := c.imageStoreService.Get(ctx, resolvedImageName)
+	image, err := c.imageStoreService.Get(ctx, storeName)
 	if err != nil {
-		return desc, size,
-			fmt.Errorf("get failed for image:%q err: %v", resolvedImageName, err)
+		return nil, fmt.Errorf("get failed for image:%q err: %v", storeName, err)
 	}
 	p, err := content.ReadBlob(ctx, c.contentProvider, image.Target.Digest)
 	if err != nil {
-		return desc, size,
-			fmt.Errorf("readblob failed for digest:%q err: %v", image.Target.Digest, err)
+		return nil, fmt.Errorf("readblob failed for digest:%q err: %v", image.Target.Digest, err)
 	}
 	var manifest imagespec.Manifest
 	err = json.Unmarshal(p, &manifest)
 	if err != nil {
-		return desc, size,
-			fmt.Errorf("unmarshal blob to manifest failed for digest:%q %v", image.Target.Digest, err)
+		return nil, fmt.Errorf("unmarshal blob to manifest failed for digest:%q %v", image.Target.Digest, err)
+	}
+	p, err = content.ReadBlob(ctx, c.contentProvider, manifest.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("readblob failed for image config digest:%q err: %v", manifest.Config.Digest, err)
+	}
+	var imageSpec imagespec.Image
+	err = json.Unmarshal(p, &imageSpec)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal blob to image config failed for digest:%q %v", manifest.Config.Digest, err)
+	}
+	var signal imageStopSignal
+	if err = json.Unmarshal(p, &signal); err != nil {
+		return nil, fmt.Errorf("unmarshal blob to image stop signal failed for digest:%q %v", manifest.Config.Digest, err)
 	}
-	_, err = c.rootfsUnpacker.Unpack(ctx, manifest.Layers) // ignoring returned chainID for now
+	chainID, err := c.rootfsUnpacker.Unpack(ctx, manifest.Layers)
 	if err != nil {
-		return desc, size,
-			fmt.Errorf("unpack failed for manifest layers:%v %v", manifest.Layers, err)
+		return nil, fmt.Errorf("unpack failed for manifest layers:%v %v", manifest.Layers, err)
 	}
-	size, err = image.Size(ctx, c.contentProvider)
+	size, err := image.Size(ctx, c.contentProvider)
 	if err != nil {
-		return desc, size,
-			fmt.Errorf("size failed for image:%q %v", image.Target.Digest, err)
+		return nil, fmt.Errorf("size failed for image:%q %v", image.Target.Digest, err)
 	}
-	return desc, size, nil
+	return &pullResult{
+		desc:       desc,
+		chainID:    chainID,
+		size:       size,
+		config:     &imageSpec.Config,
+		stopSignal: signal.Config.StopSignal,
+	}, nil
 }
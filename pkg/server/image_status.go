@@ -32,13 +32,7 @@ func (c *criContainerdService) ImageStatus(ctx context.Context, r *runtime.Image
 	// note: get returns nil with no err
 	meta, _ := c.imageMetadataStore.Get(ref)
 	if meta != nil {
-		return &runtime.ImageStatusResponse{Image: &runtime.Image{ // TODO(mikebrow): write a ImageMetadata to runtim.Image converter
-			Id:          meta.ID,
-			RepoTags:    meta.RepoTags,
-			RepoDigests: meta.RepoDigests,
-			Size_:       meta.Size,
-			// TODO(mikebrow): Uid and Username?
-		}}, nil
+		return &runtime.ImageStatusResponse{Image: toCRIImage(meta)}, nil
 	}
 
 	// Search for image by ref in repo tags if found the ID matching ref
@@ -48,13 +42,7 @@ func (c *criContainerdService) ImageStatus(ctx context.Context, r *runtime.Image
 		for _, meta := range imageMetadataA {
 			for _, tag := range meta.RepoTags {
 				if ref == tag {
-					return &runtime.ImageStatusResponse{Image: &runtime.Image{ // TODO(mikebrow): write a ImageMetadata to runtim.Image converter
-						Id:          meta.ID,
-						RepoTags:    meta.RepoTags,
-						RepoDigests: meta.RepoDigests,
-						Size_:       meta.Size,
-						// TODO(mikebrow): Uid and Username?
-					}}, nil
+					return &runtime.ImageStatusResponse{Image: toCRIImage(meta)}, nil
 				}
 			}
 		}
@@ -0,0 +1,264 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/pkg/truncindex"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"github.com/containerd/containerd/api/services/execution"
+	"github.com/containerd/containerd/api/types/container"
+)
+
+// orphanReconcileInterval is the interval between two orphan reconciliations.
+const orphanReconcileInterval = 5 * time.Minute
+
+// orphanCounterVarName is the name under which the orphan counter is
+// published through expvar, e.g. at /debug/vars of the debug endpoint.
+const orphanCounterVarName = "cri-containerd.orphans"
+
+// orphanCounts is the numbers of orphans removed by the orphan reconciler.
+type orphanCounts struct {
+	// Containers is the number of orphan containerd containers removed.
+	Containers int `json:"containers"`
+	// SandboxDirs is the number of stray sandbox root directories removed.
+	SandboxDirs int `json:"sandboxDirs"`
+	// ContainerDirs is the number of stray container root directories removed.
+	ContainerDirs int `json:"containerDirs"`
+}
+
+// orphanCounter counts the orphans cleaned up by the orphan reconciler. It
+// implements expvar.Var, so that it can be read outside of cri-containerd.
+type orphanCounter struct {
+	sync.Mutex
+	counts orphanCounts
+}
+
+var _ expvar.Var = &orphanCounter{}
+
+// add adds the numbers of removed orphans into the counter.
+func (o *orphanCounter) add(counts orphanCounts) {
+	o.Lock()
+	defer o.Unlock()
+	o.counts.Containers += counts.Containers
+	o.counts.SandboxDirs += counts.SandboxDirs
+	o.counts.ContainerDirs += counts.ContainerDirs
+}
+
+// get returns the numbers of removed orphans.
+func (o *orphanCounter) get() orphanCounts {
+	o.Lock()
+	defer o.Unlock()
+	return o.counts
+}
+
+// String returns the numbers of removed orphans in json.
+func (o *orphanCounter) String() string {
+	data, err := json.Marshal(o.get())
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// publishOrphanCounter publishes the orphan counter through expvar. Only the
+// first service in the process is published, because expvar names must be
+// unique.
+func (c *criContainerdService) publishOrphanCounter() {
+	if expvar.Get(orphanCounterVarName) == nil {
+		expvar.Publish(orphanCounterVarName, &c.orphanCounter)
+	}
+}
+
+// startOrphanReconciler reconciles orphans once, and then periodically in
+// the background.
+func (c *criContainerdService) startOrphanReconciler() {
+	reconcile := func() {
+		if err := c.reconcileOrphans(context.Background()); err != nil {
+			glog.Errorf("Failed to reconcile orphans: %v", err)
+		}
+	}
+	reconcile()
+	go func() {
+		ticker := time.NewTicker(orphanReconcileInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			reconcile()
+		}
+	}()
+}
+
+// reconcileOrphans removes containerd containers, sandbox root directories
+// and container root directories created by cri-containerd which don't have
+// corresponding metadata any more, e.g. left behind by a crash. Sandboxes and
+// containers which are still being created are registered in the id indexes
+// before anything is created for them, so they are never treated as orphans.
+func (c *criContainerdService) reconcileOrphans(ctx context.Context) error {
+	// List containerd containers before checking the metadata, so that a
+	// container which is created afterwards will not be seen.
+	containerdContainers, err := c.listManagedContainers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list managed containers: %v", err)
+	}
+	var counts orphanCounts
+	counts.Containers = c.reconcileOrphanContainers(ctx, containerdContainers)
+	counts.SandboxDirs, err = c.reconcileStrayDirs(sandboxesDir, containerdContainers, c.isKnownSandbox)
+	if err != nil {
+		return err
+	}
+	counts.ContainerDirs, err = c.reconcileStrayDirs(containersDir, containerdContainers, c.isKnownContainer)
+	if err != nil {
+		return err
+	}
+	c.orphanCounter.add(counts)
+	if counts != (orphanCounts{}) {
+		total := c.orphanCounter.get()
+		glog.Infof("Removed %d orphan containers, %d stray sandbox directories and %d stray container "+
+			"directories (%d containers, %d sandbox directories and %d container directories in total)",
+			counts.Containers, counts.SandboxDirs, counts.ContainerDirs,
+			total.Containers, total.SandboxDirs, total.ContainerDirs)
+	}
+	return nil
+}
+
+// reconcileOrphanContainers removes all orphan containerd containers, and
+// returns the number of removed containers. A running orphan container is
+// killed first, and removed in the next reconciliation. Removed containers
+// are deleted from the passed in containerd containers.
+func (c *criContainerdService) reconcileOrphanContainers(ctx context.Context, containerdContainers map[string]*container.Container) int {
+	removed := 0
+	for id, cntr := range containerdContainers {
+		known, err := c.isKnownID(id)
+		if err != nil {
+			glog.Errorf("Failed to check whether container %q is orphan: %v", id, err)
+			continue
+		}
+		if known {
+			continue
+		}
+		if cntr.Status == container.Status_RUNNING {
+			glog.V(2).Infof("Kill orphan container %q", id)
+			_, err := c.containerService.Kill(ctx, &execution.KillRequest{ID: id, Signal: uint32(syscall.SIGKILL)})
+			if err != nil && !isContainerdContainerNotExistError(err) {
+				glog.Errorf("Failed to kill orphan container %q: %v", id, err)
+			}
+			continue
+		}
+		glog.V(2).Infof("Remove orphan container %q", id)
+		_, err = c.containerService.Delete(ctx, &execution.DeleteRequest{ID: id})
+		if err != nil && !isContainerdContainerNotExistError(err) {
+			glog.Errorf("Failed to delete orphan container %q: %v", id, err)
+			continue
+		}
+		c.stateCache.delete(id)
+		delete(containerdContainers, id)
+		removed++
+	}
+	return removed
+}
+
+// reconcileStrayDirs removes all root directories under the sandboxes or
+// containers directory of the root directory, which are not known by
+// cri-containerd. It returns the number of removed directories. The directory
+// of an orphan container which still exists in containerd is kept, because it
+// identifies the container as managed by cri-containerd.
+func (c *criContainerdService) reconcileStrayDirs(dir string, containerdContainers map[string]*container.Container,
+	isKnown func(string) (bool, error)) (int, error) {
+	root := filepath.Join(c.rootDir, dir)
+	dirs, err := c.os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read directory %q: %v", root, err)
+	}
+	removed := 0
+	for _, d := range dirs {
+		id := d.Name()
+		if _, ok := containerdContainers[id]; ok {
+			continue
+		}
+		known, err := isKnown(id)
+		if err != nil {
+			glog.Errorf("Failed to check whether directory %q is stray: %v", id, err)
+			continue
+		}
+		if known {
+			continue
+		}
+		strayDir := filepath.Join(root, id)
+		glog.V(2).Infof("Remove stray root directory %q", strayDir)
+		if err := c.os.RemoveAll(strayDir); err != nil {
+			glog.Errorf("Failed to remove stray root directory %q: %v", strayDir, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// isKnownID checks whether the id belongs to a sandbox or container known by
+// cri-containerd.
+func (c *criContainerdService) isKnownID(id string) (bool, error) {
+	known, err := c.isKnownSandbox(id)
+	if err != nil || known {
+		return known, err
+	}
+	return c.isKnownContainer(id)
+}
+
+// isKnownContainer checks whether the id belongs to a container known by
+// cri-containerd, including containers being created.
+func (c *criContainerdService) isKnownContainer(id string) (bool, error) {
+	if inIDIndex(c.containerIDIndex, id) {
+		return true, nil
+	}
+	meta, err := c.containerStore.Get(id)
+	if err != nil {
+		return false, fmt.Errorf("failed to get container metadata: %v", err)
+	}
+	return meta != nil, nil
+}
+
+// isKnownSandbox checks whether the id belongs to a sandbox known by
+// cri-containerd, including sandboxes being created.
+func (c *criContainerdService) isKnownSandbox(id string) (bool, error) {
+	if inIDIndex(c.sandboxIDIndex, id) {
+		return true, nil
+	}
+	meta, err := c.sandboxStore.Get(id)
+	if err != nil {
+		return false, fmt.Errorf("failed to get sandbox metadata: %v", err)
+	}
+	return meta != nil, nil
+}
+
+// inIDIndex checks whether the full id is registered in the id index.
+func inIDIndex(index *truncindex.TruncIndex, id string) bool {
+	got, err := index.Get(id)
+	return err == nil && got == id
+}
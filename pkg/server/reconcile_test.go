@@ -0,0 +1,145 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"expvar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/containerd/containerd/api/services/execution"
+	"github.com/containerd/containerd/api/types/container"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+	ostesting "github.com/kubernetes-incubator/cri-containerd/pkg/os/testing"
+	servertesting "github.com/kubernetes-incubator/cri-containerd/pkg/server/testing"
+)
+
+func TestReconcileOrphans(t *testing.T) {
+	newID := func(c string) string { return strings.Repeat(c, 64) }
+	knownSandbox := newID("1")
+	creatingSandbox := newID("2")
+	knownContainer := newID("3")
+	creatingContainer := newID("4")
+	orphanContainer := newID("5")
+	orphanRunningSandbox := newID("6")
+	orphanSandboxDir := newID("7")
+	notManaged := newID("8")
+	orphanContainerDir := newID("9")
+
+	c := newTestCRIContainerdService()
+	fake := c.containerService.(*servertesting.FakeExecutionClient)
+	fakeOS := c.os.(*ostesting.FakeOS)
+	rootDir, err := ioutil.TempDir("", "reconcile-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootDir)
+	c.rootDir = rootDir
+	for _, id := range []string{knownSandbox, creatingSandbox, orphanRunningSandbox, orphanSandboxDir} {
+		require.NoError(t, os.MkdirAll(getSandboxRootDir(rootDir, id), 0755))
+	}
+	for _, id := range []string{knownContainer, creatingContainer, orphanContainer, orphanContainerDir} {
+		require.NoError(t, os.MkdirAll(getContainerRootDir(rootDir, id), 0755))
+	}
+	fakeOS.StatFn = os.Stat
+	fakeOS.ReadDirFn = ioutil.ReadDir
+	fakeOS.RemoveAllFn = os.RemoveAll
+
+	require.NoError(t, c.sandboxStore.Create(metadata.SandboxMetadata{ID: knownSandbox}))
+	require.NoError(t, c.sandboxIDIndex.Add(knownSandbox))
+	require.NoError(t, c.sandboxIDIndex.Add(creatingSandbox))
+	require.NoError(t, c.containerStore.Create(metadata.ContainerMetadata{ID: knownContainer}))
+	require.NoError(t, c.containerIDIndex.Add(creatingContainer))
+	fake.SetFakeContainers([]container.Container{
+		{ID: knownSandbox, Status: container.Status_RUNNING},
+		{ID: creatingSandbox, Status: container.Status_CREATED},
+		{ID: knownContainer, Status: container.Status_STOPPED},
+		{ID: creatingContainer, Status: container.Status_CREATED},
+		{ID: orphanContainer, Status: container.Status_STOPPED},
+		{ID: orphanRunningSandbox, Status: container.Status_RUNNING},
+		{ID: notManaged, Status: container.Status_STOPPED},
+	})
+	sandboxDirExists := func(id string) bool {
+		_, err := os.Stat(getSandboxRootDir(rootDir, id))
+		return err == nil
+	}
+	containerDirExists := func(id string) bool {
+		_, err := os.Stat(getContainerRootDir(rootDir, id))
+		return err == nil
+	}
+
+	t.Logf("the first reconciliation should remove stopped orphans and kill running orphans")
+	require.NoError(t, c.reconcileOrphans(context.Background()))
+	// The order of containers returned by containerd is not deterministic.
+	calls := fake.GetCalledDetails()
+	assert.Len(t, calls, 3)
+	assert.Contains(t, calls, servertesting.CalledDetail{Name: "kill",
+		Argument: &execution.KillRequest{ID: orphanRunningSandbox, Signal: 9}})
+	assert.Contains(t, calls, servertesting.CalledDetail{Name: "delete",
+		Argument: &execution.DeleteRequest{ID: orphanContainer}})
+	assert.False(t, sandboxDirExists(orphanSandboxDir))
+	assert.True(t, sandboxDirExists(orphanRunningSandbox),
+		"directory of the orphan sandbox container should be kept until it is deleted")
+	assert.False(t, containerDirExists(orphanContainer))
+	assert.False(t, containerDirExists(orphanContainerDir))
+	assert.Equal(t, orphanCounts{Containers: 1, SandboxDirs: 1, ContainerDirs: 2}, c.orphanCounter.get())
+
+	t.Logf("the next reconciliation should remove the killed orphan and its directory")
+	fake.ClearCalls()
+	require.NoError(t, c.reconcileOrphans(context.Background()))
+	assert.Equal(t, []servertesting.CalledDetail{
+		{Name: "list", Argument: &execution.ListRequest{}},
+		{Name: "delete", Argument: &execution.DeleteRequest{ID: orphanRunningSandbox}},
+	}, fake.GetCalledDetails())
+	assert.False(t, sandboxDirExists(orphanRunningSandbox))
+	assert.Equal(t, orphanCounts{Containers: 2, SandboxDirs: 2, ContainerDirs: 2}, c.orphanCounter.get())
+	assert.JSONEq(t, `{"containers":2,"sandboxDirs":2,"containerDirs":2}`, c.orphanCounter.String())
+	for _, id := range []string{knownSandbox, creatingSandbox, knownContainer, creatingContainer, notManaged} {
+		_, ok := fake.ContainerList[id]
+		assert.True(t, ok, "container %q should not be removed", id)
+	}
+	assert.True(t, sandboxDirExists(knownSandbox))
+	assert.True(t, sandboxDirExists(creatingSandbox))
+	assert.True(t, containerDirExists(knownContainer))
+	assert.True(t, containerDirExists(creatingContainer))
+}
+
+func TestReconcileStrayDirsNotExist(t *testing.T) {
+	c := newTestCRIContainerdService()
+	fakeOS := c.os.(*ostesting.FakeOS)
+	c.rootDir = filepath.Join(os.TempDir(), "reconcile-test-not-exist")
+	fakeOS.ReadDirFn = ioutil.ReadDir
+	removed, err := c.reconcileStrayDirs(sandboxesDir, nil, c.isKnownSandbox)
+	assert.NoError(t, err)
+	assert.Zero(t, removed)
+}
+
+func TestPublishOrphanCounter(t *testing.T) {
+	c := newTestCRIContainerdService()
+	c.publishOrphanCounter()
+	v := expvar.Get(orphanCounterVarName)
+	require.NotNil(t, v)
+	assert.NotPanics(t, newTestCRIContainerdService().publishOrphanCounter,
+		"publishing again should not panic")
+	assert.Equal(t, v, expvar.Get(orphanCounterVarName))
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"github.com/containerd/containerd/api/services/execution"
+	"github.com/containerd/containerd/api/types/container"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+	"github.com/kubernetes-incubator/cri-containerd/pkg/selinux"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// recover recovers system state from the metadata store and containerd
+// after restart. It registers the names and ids of all sandboxes and
+// containers, and reconciles container state with containerd. It should
+// be called before serving any request.
+func (c *criContainerdService) recover(ctx context.Context) error {
+	// Containers not managed by cri-containerd are ignored.
+	containerdContainers, err := c.listManagedContainers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list managed containers: %v", err)
+	}
+
+	sandboxes, err := c.sandboxStore.List()
+	if err != nil {
+		return fmt.Errorf("failed to list sandboxes from store: %v", err)
+	}
+	for _, sandbox := range sandboxes {
+		if err := c.recoverSandbox(sandbox); err != nil {
+			return fmt.Errorf("failed to recover sandbox %q: %v", sandbox.ID, err)
+		}
+	}
+
+	containers, err := c.containerStore.List()
+	if err != nil {
+		return fmt.Errorf("failed to list containers from store: %v", err)
+	}
+	for _, cntr := range containers {
+		if err := c.recoverContainer(ctx, cntr, containerdContainers[cntr.ID]); err != nil {
+			return fmt.Errorf("failed to recover container %q: %v", cntr.ID, err)
+		}
+	}
+
+	// Image metadata doesn't need recovery, list it to make sure all image
+	// metadata is readable.
+	if _, err := c.imageMetadataStore.List(); err != nil {
+		return fmt.Errorf("failed to list images from store: %v", err)
+	}
+	glog.V(2).Infof("Recovered %d sandboxes and %d containers", len(sandboxes), len(containers))
+	return nil
+}
+
+// recoverSandbox registers the name, id and selinux level of a sandbox.
+// Sandbox state doesn't need recovery, because it is always got from
+// containerd.
+func (c *criContainerdService) recoverSandbox(sandbox *metadata.SandboxMetadata) error {
+	if err := c.sandboxNameIndex.Reserve(sandbox.Name, sandbox.ID); err != nil {
+		return fmt.Errorf("failed to reserve sandbox name %q: %v", sandbox.Name, err)
+	}
+	if err := c.sandboxIDIndex.Add(sandbox.ID); err != nil {
+		return fmt.Errorf("failed to add sandbox id: %v", err)
+	}
+	if sandbox.ProcessLabel != "" {
+		label, err := selinux.NewContext(sandbox.ProcessLabel)
+		if err != nil {
+			return fmt.Errorf("failed to parse process label %q: %v", sandbox.ProcessLabel, err)
+		}
+		if label.Level != "" {
+			// The level may be specified by the user and shared by
+			// multiple sandboxes, do not return error for that.
+			if err := c.selinuxLevelIndex.Reserve(label.Level, sandbox.ID); err != nil {
+				glog.Warningf("Failed to reserve selinux level %q for sandbox %q: %v",
+					label.Level, sandbox.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// recoverContainer registers the name and id of a container, and updates the
+// container state based on the containerd container. A created or running
+// container which is not running in containerd any more is set to exited with
+// an unknown reason, and deleted from containerd if it still exists.
+func (c *criContainerdService) recoverContainer(ctx context.Context, meta *metadata.ContainerMetadata, cntr *container.Container) error {
+	if err := c.containerNameIndex.Reserve(meta.Name, meta.ID); err != nil {
+		return fmt.Errorf("failed to reserve container name %q: %v", meta.Name, err)
+	}
+	if err := c.containerIDIndex.Add(meta.ID); err != nil {
+		return fmt.Errorf("failed to add container id: %v", err)
+	}
+	exited := false
+	switch meta.State() {
+	case runtime.ContainerState_CONTAINER_RUNNING:
+		exited = cntr == nil || cntr.Status != container.Status_RUNNING
+	case runtime.ContainerState_CONTAINER_CREATED:
+		exited = cntr == nil
+	}
+	if exited && cntr != nil {
+		// The container is stopped in containerd, delete it as the exit
+		// event handler does.
+		_, err := c.containerService.Delete(ctx, &execution.DeleteRequest{ID: meta.ID})
+		if err != nil && !isContainerdContainerNotExistError(err) {
+			return fmt.Errorf("failed to delete container from containerd: %v", err)
+		}
+		c.stateCache.delete(meta.ID)
+	}
+	return c.containerStore.Update(meta.ID, func(meta metadata.ContainerMetadata) (metadata.ContainerMetadata, error) {
+		// Removing state is not valid after restart, the removal should
+		// be retried by the kubelet.
+		meta.Removing = false
+		if exited {
+			meta.Pid = 0
+			meta.FinishedAt = time.Now().UnixNano()
+			meta.ExitCode = unknownExitCode
+			meta.Reason = unknownExitReason
+		}
+		return meta, nil
+	})
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/containerd/containerd/api/services/execution"
+	"github.com/containerd/containerd/api/types/container"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+	servertesting "github.com/kubernetes-incubator/cri-containerd/pkg/server/testing"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+func TestRecover(t *testing.T) {
+	now := time.Now().UnixNano()
+	sandboxes := []metadata.SandboxMetadata{
+		{
+			ID:           "sandbox-1",
+			Name:         "sandbox-name-1",
+			ProcessLabel: "system_u:system_r:svirt_lxc_net_t:s0:c1,c2",
+		},
+		{ID: "sandbox-2", Name: "sandbox-name-2"},
+	}
+	containers := map[string]struct {
+		meta         metadata.ContainerMetadata
+		containerd   *container.Container
+		expectState  runtime.ContainerState
+		expectReason string
+		expectDelete bool
+	}{
+		"running container should stay running": {
+			meta:        metadata.ContainerMetadata{ID: "running", Name: "running", Pid: 1, CreatedAt: now, StartedAt: now},
+			containerd:  &container.Container{ID: "running", Pid: 1, Status: container.Status_RUNNING},
+			expectState: runtime.ContainerState_CONTAINER_RUNNING,
+		},
+		"vanished running container should become exited": {
+			meta:         metadata.ContainerMetadata{ID: "vanished", Name: "vanished", Pid: 2, CreatedAt: now, StartedAt: now},
+			expectState:  runtime.ContainerState_CONTAINER_EXITED,
+			expectReason: unknownExitReason,
+		},
+		"stopped running container should become exited and be deleted": {
+			meta:         metadata.ContainerMetadata{ID: "stopped", Name: "stopped", Pid: 3, CreatedAt: now, StartedAt: now},
+			containerd:   &container.Container{ID: "stopped", Pid: 3, Status: container.Status_STOPPED},
+			expectState:  runtime.ContainerState_CONTAINER_EXITED,
+			expectReason: unknownExitReason,
+			expectDelete: true,
+		},
+		"created container should stay created": {
+			meta:        metadata.ContainerMetadata{ID: "created", Name: "created", Pid: 4, CreatedAt: now},
+			containerd:  &container.Container{ID: "created", Pid: 4, Status: container.Status_CREATED},
+			expectState: runtime.ContainerState_CONTAINER_CREATED,
+		},
+		"vanished created container should become exited": {
+			meta:         metadata.ContainerMetadata{ID: "gone-created", Name: "gone-created", Pid: 5, CreatedAt: now},
+			expectState:  runtime.ContainerState_CONTAINER_EXITED,
+			expectReason: unknownExitReason,
+		},
+		"exited container should stay exited": {
+			meta: metadata.ContainerMetadata{ID: "exited", Name: "exited", CreatedAt: now, StartedAt: now,
+				FinishedAt: now, Reason: completeExitReason, Removing: true},
+			expectState:  runtime.ContainerState_CONTAINER_EXITED,
+			expectReason: completeExitReason,
+		},
+	}
+
+	c := newTestCRIContainerdService()
+	fake := c.containerService.(*servertesting.FakeExecutionClient)
+	for _, s := range sandboxes {
+		require.NoError(t, c.sandboxStore.Create(s))
+	}
+	var containerdContainers []container.Container
+	for _, test := range containers {
+		require.NoError(t, c.containerStore.Create(test.meta))
+		if test.containerd != nil {
+			containerdContainers = append(containerdContainers, *test.containerd)
+		}
+	}
+	fake.SetFakeContainers(containerdContainers)
+
+	require.NoError(t, c.recover(context.Background()))
+
+	t.Logf("sandbox names, ids and selinux levels should be registered")
+	for _, s := range sandboxes {
+		assert.Error(t, c.sandboxNameIndex.Reserve(s.Name, "another-id"))
+		id, err := c.sandboxIDIndex.Get(s.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, s.ID, id)
+	}
+	assert.Error(t, c.selinuxLevelIndex.Reserve("s0:c1,c2", "another-id"))
+
+	for desc, test := range containers {
+		t.Logf("TestCase %q", desc)
+		id := test.meta.ID
+		assert.Error(t, c.containerNameIndex.Reserve(test.meta.Name, "another-id"),
+			"container name should be registered")
+		gotID, err := c.containerIDIndex.Get(id)
+		assert.NoError(t, err)
+		assert.Equal(t, id, gotID, "container id should be registered")
+		meta, err := c.containerStore.Get(id)
+		require.NoError(t, err)
+		require.NotNil(t, meta)
+		assert.Equal(t, test.expectState, meta.State())
+		assert.Equal(t, test.expectReason, meta.Reason)
+		assert.False(t, meta.Removing, "removing state should be reset")
+		if test.expectReason == unknownExitReason {
+			assert.EqualValues(t, unknownExitCode, meta.ExitCode)
+			assert.Zero(t, meta.Pid)
+		}
+		_, stillInContainerd := fake.ContainerList[id]
+		assert.Equal(t, test.containerd != nil && !test.expectDelete, stillInContainerd)
+	}
+}
+
+func TestRecoverError(t *testing.T) {
+	t.Logf("should return error if containerd list fails")
+	c := newTestCRIContainerdService()
+	fake := c.containerService.(*servertesting.FakeExecutionClient)
+	fake.InjectError("list", errors.New("random error"))
+	assert.Error(t, c.recover(context.Background()))
+
+	t.Logf("should return error if sandbox name is duplicated")
+	c = newTestCRIContainerdService()
+	require.NoError(t, c.sandboxStore.Create(metadata.SandboxMetadata{ID: "1", Name: "name"}))
+	require.NoError(t, c.sandboxStore.Create(metadata.SandboxMetadata{ID: "2", Name: "name"}))
+	assert.Error(t, c.recover(context.Background()))
+}
+
+func TestEventsDuringRecoveryNotLost(t *testing.T) {
+	now := time.Now().UnixNano()
+	testID := "test-id"
+	c := newTestCRIContainerdService()
+	fake := servertesting.NewFakeExecutionClient().WithEvents()
+	c.containerService = fake
+	require.NoError(t, c.containerStore.Create(metadata.ContainerMetadata{
+		ID: testID, Name: "test-name", Pid: 1, CreatedAt: now, StartedAt: now,
+	}))
+	fake.SetFakeContainers([]container.Container{{ID: testID, Pid: 1, Status: container.Status_RUNNING}})
+
+	events, err := c.subscribeEvents()
+	require.NoError(t, err)
+	require.NoError(t, c.recover(context.Background()))
+	meta, err := c.containerStore.Get(testID)
+	require.NoError(t, err)
+	assert.Equal(t, runtime.ContainerState_CONTAINER_RUNNING, meta.State())
+
+	t.Logf("container exited before the event monitor is started should be handled")
+	_, err = fake.Kill(context.Background(), &execution.KillRequest{ID: testID})
+	require.NoError(t, err)
+	c.startEventMonitor(events)
+	for i := 0; i < 100; i++ {
+		meta, err = c.containerStore.Get(testID)
+		require.NoError(t, err)
+		if meta.State() == runtime.ContainerState_CONTAINER_EXITED {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, runtime.ContainerState_CONTAINER_EXITED, meta.State())
+	assert.Equal(t, completeExitReason, meta.Reason)
+	_, stillInContainerd := fake.ContainerList[testID]
+	assert.False(t, stillInContainerd)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/api/types/mount"
+)
+
+const (
+	// overlayUpperdirOption is the overlay mount option of the writable
+	// layer directory.
+	overlayUpperdirOption = "upperdir="
+	// overlayWorkdirOption is the overlay mount option of the work directory.
+	overlayWorkdirOption = "workdir="
+)
+
+// getWritableLayerDirs returns the directories holding the writable layer of
+// a container rootfs prepared by containerd. The containerd rootfs api
+// doesn't support removing a prepared rootfs, so the writable layer is found
+// from the rootfs mounts: the upper and work directories of an overlay mount,
+// or the source of a read-write bind mount.
+func getWritableLayerDirs(mounts []*mount.Mount) ([]string, error) {
+	var dirs []string
+	for _, m := range mounts {
+		switch m.Type {
+		case "overlay":
+			for _, o := range m.Options {
+				for _, prefix := range []string{overlayUpperdirOption, overlayWorkdirOption} {
+					if strings.HasPrefix(o, prefix) {
+						dirs = append(dirs, strings.TrimPrefix(o, prefix))
+					}
+				}
+			}
+		case "bind":
+			readonly := false
+			for _, o := range m.Options {
+				if o == "ro" {
+					readonly = true
+				}
+			}
+			// A read-only bind mount is a view of the image, not a
+			// writable layer.
+			if !readonly {
+				dirs = append(dirs, m.Source)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rootfs mount type %q", m.Type)
+		}
+	}
+	for _, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("writable layer directory %q is not absolute", dir)
+		}
+	}
+	return dirs, nil
+}
+
+// removeWritableLayer removes the writable layer of a container rootfs with
+// the rootfs mounts. It is idempotent, so that a failed removal could be
+// retried.
+func (c *criContainerdService) removeWritableLayer(mounts []*mount.Mount) error {
+	dirs, err := getWritableLayerDirs(mounts)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if err := c.os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove %q: %v", dir, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerd/containerd/api/types/mount"
+)
+
+func TestGetWritableLayerDirs(t *testing.T) {
+	for desc, test := range map[string]struct {
+		mounts    []*mount.Mount
+		expected  []string
+		expectErr bool
+	}{
+		"overlay mount should return upper and work directories": {
+			mounts: []*mount.Mount{{
+				Type:    "overlay",
+				Source:  "overlay",
+				Options: []string{"workdir=/snapshots/1/work", "upperdir=/snapshots/1/fs", "lowerdir=/snapshots/0/fs"},
+			}},
+			expected: []string{"/snapshots/1/work", "/snapshots/1/fs"},
+		},
+		"read-only overlay mount should return nothing": {
+			mounts: []*mount.Mount{{
+				Type:    "overlay",
+				Source:  "overlay",
+				Options: []string{"lowerdir=/snapshots/1/fs:/snapshots/0/fs"},
+			}},
+		},
+		"read-write bind mount should return the source": {
+			mounts:   []*mount.Mount{{Type: "bind", Source: "/snapshots/1", Options: []string{"rbind", "rw"}}},
+			expected: []string{"/snapshots/1"},
+		},
+		"read-only bind mount should return nothing": {
+			mounts: []*mount.Mount{{Type: "bind", Source: "/snapshots/1", Options: []string{"rbind", "ro"}}},
+		},
+		"relative directory should return error": {
+			mounts:    []*mount.Mount{{Type: "bind", Source: "snapshots/1"}},
+			expectErr: true,
+		},
+		"unknown mount type should return error": {
+			mounts:    []*mount.Mount{{Type: "unknown", Source: "/snapshots/1"}},
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		dirs, err := getWritableLayerDirs(test.mounts)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, dirs)
+	}
+}
@@ -22,8 +22,6 @@ import (
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
 
-	"github.com/containerd/containerd/api/services/execution"
-
 	"github.com/containerd/containerd/api/types/container"
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
 
@@ -45,26 +43,16 @@ func (c *criContainerdService) ListPodSandbox(ctx context.Context, r *runtime.Li
 		return nil, fmt.Errorf("failed to list metadata from sandbox store: %v", err)
 	}
 
-	resp, err := c.containerService.List(ctx, &execution.ListRequest{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list sandbox containers: %v", err)
-	}
-	sandboxesInContainerd := resp.Containers
-
 	var sandboxes []*runtime.PodSandbox
 	for _, sandboxInStore := range sandboxesInStore {
-		var sandboxInContainerd *container.Container
-		for _, s := range sandboxesInContainerd {
-			if s.ID == sandboxInStore.ID {
-				sandboxInContainerd = s
-				break
-			}
-		}
+		// Get the sandbox container state from the state cache instead of
+		// containerd.
+		sandboxInContainerd, ok := c.stateCache.get(sandboxInStore.ID)
 
 		// Set sandbox state to NOTREADY by default.
 		state := runtime.PodSandboxState_SANDBOX_NOTREADY
 		// If the sandbox container is running, return the sandbox as READY.
-		if sandboxInContainerd != nil && sandboxInContainerd.Status == container.Status_RUNNING {
+		if ok && sandboxInContainerd.Status == container.Status_RUNNING {
 			state = runtime.PodSandboxState_SANDBOX_READY
 		}
 
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 
 	"github.com/containerd/containerd/api/types/container"
@@ -199,9 +200,12 @@ func TestListPodSandbox(t *testing.T) {
 
 	// Inject fake containerd containers
 	fake.SetFakeContainers(sandboxesInContainerd)
+	require.NoError(t, c.resyncStateCache(context.Background()))
+	fake.ClearCalls()
 
 	resp, err := c.ListPodSandbox(context.Background(), &runtime.ListPodSandboxRequest{})
 	assert.NoError(t, err)
+	assert.Empty(t, fake.GetCalledNames(), "containerd should not be queried")
 	sandboxes := resp.GetItems()
 	assert.Len(t, sandboxes, len(expect))
 	for _, s := range expect {
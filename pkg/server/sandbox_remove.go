@@ -50,8 +50,6 @@ func (c *criContainerdService) RemovePodSandbox(ctx context.Context, r *runtime.
 	// Use the full sandbox id.
 	id := sandbox.ID
 
-	// TODO(random-liu): [P2] Remove all containers in the sandbox.
-
 	// Return error if sandbox container is not fully stopped.
 	_, err = c.containerService.Info(ctx, &execution.InfoRequest{ID: id})
 	if err != nil && !isContainerdContainerNotExistError(err) {
@@ -61,6 +59,21 @@ func (c *criContainerdService) RemovePodSandbox(ctx context.Context, r *runtime.
 		return nil, fmt.Errorf("sandbox container %q is not fully stopped", id)
 	}
 
+	// Remove all containers inside the sandbox. Running containers are killed
+	// first. The sandbox is kept if any container fails to be removed, so
+	// that the removal can be retried.
+	if err := c.forEachSandboxContainer(id, func(cid string) error {
+		if _, err := c.StopContainer(ctx, &runtime.StopContainerRequest{ContainerId: cid}); err != nil {
+			return fmt.Errorf("failed to stop: %v", err)
+		}
+		if _, err := c.RemoveContainer(ctx, &runtime.RemoveContainerRequest{ContainerId: cid}); err != nil {
+			return fmt.Errorf("failed to remove: %v", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to remove containers in sandbox %q: %v", id, err)
+	}
+
 	// TODO(random-liu): [P0] Cleanup shm created in RunPodSandbox.
 	// TODO(random-liu): [P1] Remove permanent namespace once used.
 
@@ -87,5 +100,8 @@ func (c *criContainerdService) RemovePodSandbox(ctx context.Context, r *runtime.
 	// Release the sandbox name reserved for the sandbox.
 	c.sandboxNameIndex.ReleaseByKey(id)
 
+	// Release the selinux level allocated for the sandbox.
+	c.selinuxLevelIndex.ReleaseByKey(id)
+
 	return &runtime.RemovePodSandboxResponse{}, nil
 }
@@ -17,10 +17,14 @@ limitations under the License.
 package server
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 
 	"github.com/containerd/containerd/api/types/container"
@@ -120,3 +124,89 @@ func TestRemovePodSandbox(t *testing.T) {
 		assert.NotNil(t, res, "remove should be idempotent")
 	}
 }
+
+func TestRemovePodSandboxWithContainers(t *testing.T) {
+	testID := "test-id"
+	testSandbox := metadata.SandboxMetadata{
+		ID:     testID,
+		Name:   "test-name",
+		Config: &runtime.PodSandboxConfig{LogDirectory: "/test/log/dir"},
+	}
+	now := time.Now().UnixNano()
+	for desc, test := range map[string]struct {
+		injectFSErr   map[string]error
+		expectErr     bool
+		expectRemoved []string
+	}{
+		"should remove all containers in the sandbox": {
+			expectRemoved: []string{"created", "running", "exited"},
+		},
+		"should report the container failed to be removed": {
+			injectFSErr: map[string]error{
+				getContainerRootDir(testRootDir, "exited"): errors.New("random error"),
+			},
+			expectErr:     true,
+			expectRemoved: []string{"created", "running"},
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		fake := servertesting.NewFakeExecutionClient().WithEvents()
+		c.containerService = fake
+		events, err := c.subscribeEvents()
+		require.NoError(t, err)
+		c.startEventMonitor(events)
+		fakeOS := c.os.(*ostesting.FakeOS)
+		var (
+			mu      sync.Mutex
+			removed []string
+		)
+		fakeOS.RemoveAllFn = func(path string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			removed = append(removed, path)
+			return test.injectFSErr[path]
+		}
+		assert.NoError(t, c.sandboxStore.Create(testSandbox))
+		assert.NoError(t, c.sandboxIDIndex.Add(testID))
+		for _, meta := range []metadata.ContainerMetadata{
+			{ID: "created", SandboxID: testID, Pid: 1, CreatedAt: now,
+				Config: &runtime.ContainerConfig{LogPath: "created.log"}},
+			{ID: "running", SandboxID: testID, Pid: 2, CreatedAt: now, StartedAt: now},
+			{ID: "exited", SandboxID: testID, CreatedAt: now, StartedAt: now, FinishedAt: now},
+			{ID: "other", SandboxID: "other-sandbox", CreatedAt: now, StartedAt: now, FinishedAt: now},
+		} {
+			assert.NoError(t, c.containerStore.Create(meta))
+		}
+		fake.SetFakeContainers([]container.Container{
+			{ID: "created", Pid: 1, Status: container.Status_CREATED},
+			{ID: "running", Pid: 2, Status: container.Status_RUNNING},
+		})
+
+		res, removeErr := c.RemovePodSandbox(context.Background(), &runtime.RemovePodSandboxRequest{
+			PodSandboxId: testID,
+		})
+		for _, id := range test.expectRemoved {
+			meta, err := c.containerStore.Get(id)
+			assert.NoError(t, err)
+			assert.Nil(t, meta, "container %q should be removed", id)
+			assert.Contains(t, removed, getContainerRootDir(testRootDir, id))
+		}
+		assert.Contains(t, removed, "/test/log/dir/created.log", "container log should be removed")
+		meta, err := c.containerStore.Get("other")
+		assert.NoError(t, err)
+		assert.NotNil(t, meta, "containers in other sandboxes should not be removed")
+		sandbox, err := c.sandboxStore.Get(testID)
+		assert.NoError(t, err)
+		if test.expectErr {
+			require.Error(t, removeErr)
+			assert.Contains(t, removeErr.Error(), `container "exited"`)
+			assert.Nil(t, res)
+			assert.NotNil(t, sandbox, "sandbox should not be removed")
+			continue
+		}
+		assert.NoError(t, removeErr)
+		assert.NotNil(t, res)
+		assert.Nil(t, sandbox, "sandbox should be removed")
+	}
+}
@@ -27,7 +27,6 @@ import (
 	prototypes "github.com/gogo/protobuf/types"
 	"github.com/golang/glog"
 	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
-	"github.com/opencontainers/runtime-tools/generate"
 	"golang.org/x/net/context"
 
 	"github.com/containerd/containerd/api/services/execution"
@@ -126,8 +125,27 @@ func (c *criContainerdService) RunPodSandbox(ctx context.Context, r *runtime.Run
 		}(f)
 	}
 
+	// Initialize selinux labels of the sandbox. All containers in the sandbox
+	// share the selinux level of the sandbox.
+	processLabel, mountLabel, err := c.initSandboxSelinuxLabels(id,
+		config.GetLinux().GetSecurityContext().GetSelinuxOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to init selinux labels: %v", err)
+	}
+	defer func() {
+		// Release the selinux level if the function returns with an error.
+		if retErr != nil {
+			c.selinuxLevelIndex.ReleaseByKey(id)
+		}
+	}()
+	meta.ProcessLabel = processLabel
+	meta.MountLabel = mountLabel
+
 	// Start sandbox container.
-	spec := c.generateSandboxContainerSpec(id, config)
+	spec, err := c.generateSandboxContainerSpec(id, config, processLabel, mountLabel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate sandbox container spec: %v", err)
+	}
 	rawSpec, err := json.Marshal(spec)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal oci spec %+v: %v", spec, err)
@@ -164,13 +182,16 @@ func (c *criContainerdService) RunPodSandbox(ctx context.Context, r *runtime.Run
 		return nil, fmt.Errorf("failed to create sandbox container %q: %v",
 			id, err)
 	}
+	c.stateCache.create(id, createResp.Pid)
 	defer func() {
 		if retErr != nil {
 			// Cleanup the sandbox container if an error is returned.
 			if _, err := c.containerService.Delete(ctx, &execution.DeleteRequest{ID: id}); err != nil {
 				glog.Errorf("Failed to delete sandbox container %q: %v",
 					id, err)
+				return
 			}
+			c.stateCache.delete(id)
 		}
 	}()
 
@@ -179,6 +200,7 @@ func (c *criContainerdService) RunPodSandbox(ctx context.Context, r *runtime.Run
 		return nil, fmt.Errorf("failed to start sandbox container %q: %v",
 			id, err)
 	}
+	c.stateCache.start(id)
 
 	// Add sandbox into sandbox store.
 	meta.CreatedAt = time.Now().UnixNano()
@@ -192,16 +214,13 @@ func (c *criContainerdService) RunPodSandbox(ctx context.Context, r *runtime.Run
 	return &runtime.RunPodSandboxResponse{PodSandboxId: id}, nil
 }
 
-func (c *criContainerdService) generateSandboxContainerSpec(id string, config *runtime.PodSandboxConfig) *runtimespec.Spec {
+func (c *criContainerdService) generateSandboxContainerSpec(id string, config *runtime.PodSandboxConfig,
+	processLabel, mountLabel string) (*runtimespec.Spec, error) {
 	// TODO(random-liu): [P0] Get command from image config.
 	pauseCommand := []string{"sh", "-c", "while true; do sleep 1000000000; done"}
 
 	// Creates a spec Generator with the default spec.
-	// TODO(random-liu): [P1] Compare the default settings with docker and containerd default.
-	g := generate.New()
-
-	// Set relative root path.
-	g.SetRootPath(relativeRootfsPath)
+	g := c.newSpecGenerator()
 
 	// Set process commands.
 	g.SetProcessArgs(pauseCommand)
@@ -216,17 +235,16 @@ func (c *criContainerdService) generateSandboxContainerSpec(id string, config *r
 
 	// TODO(random-liu): [P0] Add NamespaceGetter and PortMappingGetter to initialize network plugin.
 
-	// TODO(random-liu): [P0] Add annotation to identify the container is managed by cri-containerd.
+	addOwnershipAnnotations(&g, c.instanceID, id, containerKindSandbox)
 	// TODO(random-liu): [P2] Consider whether to add labels and annotations to the container.
 
-	// Set cgroups parent.
-	if config.GetLinux().GetCgroupParent() != "" {
-		cgroupsPath := getCgroupsPath(config.GetLinux().GetCgroupParent(), id)
-		g.SetLinuxCgroupsPath(cgroupsPath)
+	// Set cgroups parent, the default cgroups parent is used if it's not
+	// specified.
+	cgroupsPath, err := c.getCgroupsPath(config.GetLinux().GetCgroupParent(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cgroups path: %v", err)
 	}
-	// When cgroup parent is not set, containerd-shim will create container in a child cgroup
-	// of the cgroup itself is in.
-	// TODO(random-liu): [P2] Set default cgroup path if cgroup parent is not specified.
+	g.SetLinuxCgroupsPath(cgroupsPath)
 
 	// Set namespace options.
 	nsOptions := config.GetLinux().GetSecurityContext().GetNamespaceOptions()
@@ -243,25 +261,55 @@ func (c *criContainerdService) generateSandboxContainerSpec(id string, config *r
 		g.RemoveLinuxNamespace(string(runtimespec.PIDNamespace)) // nolint: errcheck
 	}
 
-	// TODO(random-liu): [P0] Deal with /dev/shm. Use host for HostIpc, and create and mount for
-	// non-HostIpc. What about mqueue?
 	if nsOptions.GetHostIpc() {
 		g.RemoveLinuxNamespace(string(runtimespec.IPCNamespace)) // nolint: errcheck
 	}
 
-	// TODO(random-liu): [P1] Apply SeLinux options.
+	// Set selinux labels.
+	setOCISelinux(&g, processLabel, mountLabel)
 
-	// TODO(random-liu): [P1] Set user.
+	// Set user.
+	// TODO(agent): [P1] Resolve user name after using the pause image.
+	if runAsUser := config.GetLinux().GetSecurityContext().GetRunAsUser(); runAsUser != nil {
+		if runAsUser.GetValue() < 0 {
+			return nil, fmt.Errorf("invalid RunAsUser %d, uid must not be negative", runAsUser.GetValue())
+		}
+		g.SetProcessUID(uint32(runAsUser.GetValue()))
+	}
 
-	// TODO(random-liu): [P1] Set supplemental group.
+	// Set supplemental groups.
+	for _, group := range config.GetLinux().GetSecurityContext().GetSupplementalGroups() {
+		g.AddProcessAdditionalGid(uint32(group))
+	}
 
-	// TODO(random-liu): [P1] Set privileged.
+	// Set default capabilities.
+	if err := setOCICapabilities(&g, nil); err != nil {
+		return nil, fmt.Errorf("failed to set capabilities: %v", err)
+	}
 
 	// TODO(random-liu): [P2] Set sysctl from annotations.
 
-	// TODO(random-liu): [P2] Set apparmor and seccomp from annotations.
+	if config.GetLinux().GetSecurityContext().GetPrivileged() {
+		// Privileged mode overrides apparmor and seccomp profiles.
+		if err := c.setOCIPrivileged(&g); err != nil {
+			return nil, fmt.Errorf("failed to set privileged: %v", err)
+		}
+	} else {
+		// Set apparmor profile from the pod annotations.
+		if err := c.setOCIApparmor(&g, getSandboxApparmorProfile(config.GetAnnotations())); err != nil {
+			return nil, fmt.Errorf("failed to set apparmor profile: %v", err)
+		}
+
+		// Set seccomp profile from the pod annotation.
+		if err := c.setOCISeccomp(&g, getSeccompProfile(config.GetAnnotations(), "")); err != nil {
+			return nil, fmt.Errorf("failed to set seccomp profile: %v", err)
+		}
+	}
 
-	// TODO(random-liu): [P1] Set default sandbox container resource limit.
+	// Set default sandbox container resource limit, which is the same with
+	// dockershim.
+	g.SetLinuxResourcesCPUShares(defaultSandboxCPUShares)
+	g.SetLinuxResourcesOOMScoreAdj(defaultSandboxOOMAdj)
 
-	return g.Spec()
+	return g.Spec(), nil
 }
@@ -18,8 +18,10 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 
@@ -54,9 +56,16 @@ func getRunPodSandboxTestData() (*runtime.PodSandboxConfig, func(*testing.T, str
 	}
 	specCheck := func(t *testing.T, id string, spec *runtimespec.Spec) {
 		assert.Equal(t, "test-hostname", spec.Hostname)
-		assert.Equal(t, getCgroupsPath("/test/cgroup/parent", id), spec.Linux.CgroupsPath)
+		assert.Equal(t, filepath.Join("/test/cgroup/parent", id), spec.Linux.CgroupsPath)
 		assert.Equal(t, relativeRootfsPath, spec.Root.Path)
 		assert.Equal(t, true, spec.Root.Readonly)
+		assert.EqualValues(t, defaultSandboxCPUShares, *spec.Linux.Resources.CPU.Shares)
+		assert.EqualValues(t, defaultSandboxOOMAdj, *spec.Linux.Resources.OOMScoreAdj)
+		assert.Equal(t, map[string]string{
+			managerAnnotationKey:       managerName,
+			sandboxIDAnnotationKey:     id,
+			containerKindAnnotationKey: containerKindSandbox,
+		}, spec.Annotations)
 	}
 	return config, specCheck
 }
@@ -64,8 +73,10 @@ func getRunPodSandboxTestData() (*runtime.PodSandboxConfig, func(*testing.T, str
 func TestGenerateSandboxContainerSpec(t *testing.T) {
 	testID := "test-id"
 	for desc, test := range map[string]struct {
-		configChange func(*runtime.PodSandboxConfig)
-		specCheck    func(*testing.T, *runtimespec.Spec)
+		configChange  func(*runtime.PodSandboxConfig)
+		systemdCgroup bool
+		expectErr     bool
+		specCheck     func(*testing.T, *runtimespec.Spec)
 	}{
 		"spec should reflect original config": {
 			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
@@ -82,6 +93,75 @@ func TestGenerateSandboxContainerSpec(t *testing.T) {
 				})
 			},
 		},
+		"seccomp profile from pod annotation": {
+			configChange: func(c *runtime.PodSandboxConfig) {
+				c.Annotations[seccompPodAnnotationKey] = profileNameRuntimeDefault
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				require.NotNil(t, spec.Linux.Seccomp)
+				assert.Equal(t, runtimespec.ActErrno, spec.Linux.Seccomp.DefaultAction)
+			},
+		},
+		"apparmor profile from pod annotations": {
+			configChange: func(c *runtime.PodSandboxConfig) {
+				c.Annotations[apparmorAnnotationKeyPrefix+"c1"] = profileNameRuntimeDefault
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				assert.Equal(t, defaultApparmorProfile, spec.Process.ApparmorProfile)
+			},
+		},
+		"should return error if sandbox apparmor profile is not loaded": {
+			configChange: func(c *runtime.PodSandboxConfig) {
+				c.Annotations[apparmorAnnotationKeyPrefix+sandboxApparmorContainerName] = profileNamePrefixLocalhost + "test-profile"
+			},
+			expectErr: true,
+		},
+		"should return error for negative run as user": {
+			configChange: func(c *runtime.PodSandboxConfig) {
+				c.Linux.SecurityContext = &runtime.LinuxSandboxSecurityContext{
+					RunAsUser: &runtime.Int64Value{Value: -5},
+				}
+			},
+			expectErr: true,
+		},
+		"supplemental groups": {
+			configChange: func(c *runtime.PodSandboxConfig) {
+				c.Linux.SecurityContext = &runtime.LinuxSandboxSecurityContext{
+					SupplementalGroups: []int64{1111, 2222, 1111},
+				}
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				assert.Equal(t, []uint32{1111, 2222}, spec.Process.User.AdditionalGids)
+			},
+		},
+		"privileged sandbox": {
+			configChange: func(c *runtime.PodSandboxConfig) {
+				c.Annotations[seccompPodAnnotationKey] = profileNameRuntimeDefault
+				c.Linux.SecurityContext = &runtime.LinuxSandboxSecurityContext{
+					Privileged: true,
+				}
+			},
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				assert.Equal(t, getAllCapabilities(), spec.Process.Capabilities.Bounding)
+				assert.Nil(t, spec.Linux.Seccomp)
+			},
+		},
+		"systemd cgroups path": {
+			configChange: func(c *runtime.PodSandboxConfig) {
+				c.Linux.CgroupParent = "kubepods-burstable-pod123.slice"
+			},
+			systemdCgroup: true,
+			specCheck: func(t *testing.T, spec *runtimespec.Spec) {
+				assert.Equal(t, "kubepods-burstable-pod123.slice:cri-containerd:test-id", spec.Linux.CgroupsPath)
+			},
+		},
+		"should return error for invalid systemd slice": {
+			configChange: func(c *runtime.PodSandboxConfig) {
+				c.Linux.CgroupParent = "/kubepods/pod123"
+			},
+			systemdCgroup: true,
+			expectErr:     true,
+		},
 		"host namespace": {
 			configChange: func(c *runtime.PodSandboxConfig) {
 				c.Linux.SecurityContext = &runtime.LinuxSandboxSecurityContext{
@@ -109,12 +189,30 @@ func TestGenerateSandboxContainerSpec(t *testing.T) {
 	} {
 		t.Logf("TestCase %q", desc)
 		c := newTestCRIContainerdService()
+		c.systemdCgroup = test.systemdCgroup
+		c.os.(*ostesting.FakeOS).ReadFileFn = func(filename string) ([]byte, error) {
+			switch filename {
+			case apparmorEnabledFile:
+				return []byte("Y\n"), nil
+			case apparmorProfilesFile:
+				return []byte(defaultApparmorProfile + " (enforce)\n"), nil
+			}
+			return nil, fmt.Errorf("unexpected file %q", filename)
+		}
 		config, specCheck := getRunPodSandboxTestData()
 		if test.configChange != nil {
 			test.configChange(config)
 		}
-		spec := c.generateSandboxContainerSpec(testID, config)
-		specCheck(t, testID, spec)
+		spec, err := c.generateSandboxContainerSpec(testID, config, "", "")
+		if test.expectErr {
+			assert.Error(t, err)
+			assert.Nil(t, spec)
+			continue
+		}
+		require.NoError(t, err)
+		if !test.systemdCgroup {
+			specCheck(t, testID, spec)
+		}
 		if test.specCheck != nil {
 			test.specCheck(t, spec)
 		}
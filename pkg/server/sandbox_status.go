@@ -22,7 +22,6 @@ import (
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
 
-	"github.com/containerd/containerd/api/services/execution"
 	"github.com/containerd/containerd/api/types/container"
 
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
@@ -49,15 +48,14 @@ func (c *criContainerdService) PodSandboxStatus(ctx context.Context, r *runtime.
 	// Use the full sandbox id.
 	id := sandbox.ID
 
-	info, err := c.containerService.Info(ctx, &execution.InfoRequest{ID: id})
-	if err != nil && !isContainerdContainerNotExistError(err) {
-		return nil, fmt.Errorf("failed to get sandbox container info for %q: %v", id, err)
-	}
+	// Get the sandbox container state from the state cache instead of
+	// containerd.
+	info, ok := c.stateCache.get(id)
 
 	// Set sandbox state to NOTREADY by default.
 	state := runtime.PodSandboxState_SANDBOX_NOTREADY
 	// If the sandbox container is running, treat it as READY.
-	if info != nil && info.Status == container.Status_RUNNING {
+	if ok && info.Status == container.Status_RUNNING {
 		state = runtime.PodSandboxState_SANDBOX_READY
 	}
 
@@ -17,7 +17,12 @@ limitations under the License.
 package server
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
@@ -27,6 +32,16 @@ import (
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
 )
 
+const (
+	// stopSandboxContainerTimeout is the grace period of each container
+	// when the sandbox is stopped. Containers still running after the grace
+	// period are killed.
+	stopSandboxContainerTimeout = 10 * time.Second
+	// killSandboxContainerTimeout is the time to wait for each container to
+	// be killed after the grace period when the sandbox is stopped.
+	killSandboxContainerTimeout = 10 * time.Second
+)
+
 // StopPodSandbox stops the sandbox. If there are any running containers in the
 // sandbox, they should be forcibly terminated.
 func (c *criContainerdService) StopPodSandbox(ctx context.Context, r *runtime.StopPodSandboxRequest) (retRes *runtime.StopPodSandboxResponse, retErr error) {
@@ -47,14 +62,85 @@ func (c *criContainerdService) StopPodSandbox(ctx context.Context, r *runtime.St
 	// Use the full sandbox id.
 	id := sandbox.ID
 
+	// Stop all containers inside the sandbox before stopping the sandbox
+	// container. Containers are stopped in parallel, and the time to stop
+	// each container is bounded by a context derived from the caller's, so
+	// the time to stop the sandbox is bounded as well.
+	if err := c.forEachSandboxContainer(id, func(cid string) error {
+		ctx, cancel := context.WithTimeout(ctx, stopSandboxContainerTimeout+killSandboxContainerTimeout)
+		defer cancel()
+		_, err := c.StopContainer(ctx, &runtime.StopContainerRequest{
+			ContainerId: cid,
+			Timeout:     int64(stopSandboxContainerTimeout / time.Second),
+		})
+		return err
+	}); err != nil {
+		running, listErr := c.listRunningSandboxContainers(id)
+		if listErr != nil || len(running) == 0 {
+			return nil, fmt.Errorf("failed to stop containers in sandbox %q: %v", id, err)
+		}
+		return nil, fmt.Errorf("containers %q in sandbox %q are still running: %v", running, id, err)
+	}
+
 	// TODO(random-liu): [P1] Handle sandbox container graceful deletion.
 	// Delete the sandbox container from containerd.
 	_, err = c.containerService.Delete(ctx, &execution.DeleteRequest{ID: id})
 	if err != nil && !isContainerdContainerNotExistError(err) {
 		return nil, fmt.Errorf("failed to delete sandbox container %q: %v", id, err)
 	}
+	c.stateCache.delete(id)
 
 	// TODO(random-liu): [P0] Call network plugin to teardown network.
-	// TODO(random-liu): [P2] Stop all containers inside the sandbox.
 	return &runtime.StopPodSandboxResponse{}, nil
 }
+
+// forEachSandboxContainer runs f against all containers in the sandbox in
+// parallel. The returned error contains the errors of all failed containers.
+func (c *criContainerdService) forEachSandboxContainer(sandboxID string, f func(id string) error) error {
+	containers, err := c.containerStore.List()
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %v", err)
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []string
+	)
+	for _, cntr := range containers {
+		if cntr.SandboxID != sandboxID {
+			continue
+		}
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if err := f(id); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, fmt.Sprintf("container %q: %v", id, err))
+			}
+		}(cntr.ID)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Strings(errs)
+	return errors.New(strings.Join(errs, "; "))
+}
+
+// listRunningSandboxContainers returns the sorted ids of all running
+// containers in the sandbox.
+func (c *criContainerdService) listRunningSandboxContainers(sandboxID string) ([]string, error) {
+	containers, err := c.containerStore.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+	var running []string
+	for _, cntr := range containers {
+		if cntr.SandboxID == sandboxID && cntr.State() == runtime.ContainerState_CONTAINER_RUNNING {
+			running = append(running, cntr.ID)
+		}
+	}
+	sort.Strings(running)
+	return running, nil
+}
@@ -17,9 +17,12 @@ limitations under the License.
 package server
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -104,3 +107,88 @@ func TestStopPodSandbox(t *testing.T) {
 		assert.Equal(t, test.expectCalls, fake.GetCalledNames())
 	}
 }
+
+func TestStopPodSandboxWithContainers(t *testing.T) {
+	testID := "test-id"
+	testSandbox := metadata.SandboxMetadata{ID: testID, Name: "test-name"}
+	now := time.Now().UnixNano()
+	for desc, test := range map[string]struct {
+		injectKillErr  error
+		noEventMonitor bool
+		ctxTimeout     time.Duration
+		expectErr      bool
+	}{
+		"should stop all running containers in the sandbox": {},
+		"should report the container failed to stop": {
+			injectKillErr: errors.New("random error"),
+			expectErr:     true,
+		},
+		"should return when the caller's deadline exceeds": {
+			// Without event monitor, container stop is never observed.
+			noEventMonitor: true,
+			ctxTimeout:     500 * time.Millisecond,
+			expectErr:      true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIContainerdService()
+		fake := servertesting.NewFakeExecutionClient().WithEvents()
+		c.containerService = fake
+		if !test.noEventMonitor {
+			events, err := c.subscribeEvents()
+			require.NoError(t, err)
+			c.startEventMonitor(events)
+		}
+		assert.NoError(t, c.sandboxStore.Create(testSandbox))
+		assert.NoError(t, c.sandboxIDIndex.Add(testID))
+		for _, meta := range []metadata.ContainerMetadata{
+			{ID: "running", SandboxID: testID, Pid: 1, CreatedAt: now, StartedAt: now},
+			{ID: "exited", SandboxID: testID, CreatedAt: now, StartedAt: now, FinishedAt: now},
+			{ID: "other", SandboxID: "other-sandbox", Pid: 2, CreatedAt: now, StartedAt: now},
+		} {
+			assert.NoError(t, c.containerStore.Create(meta))
+		}
+		fake.SetFakeContainers([]container.Container{
+			{ID: testID, Pid: 3, Status: container.Status_RUNNING},
+			{ID: "running", Pid: 1, Status: container.Status_RUNNING},
+			{ID: "other", Pid: 2, Status: container.Status_RUNNING},
+		})
+		if test.injectKillErr != nil {
+			fake.InjectError("kill", test.injectKillErr)
+		}
+
+		ctx := context.Background()
+		if test.ctxTimeout != 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, test.ctxTimeout)
+			defer cancel()
+		}
+		start := time.Now()
+		res, err := c.StopPodSandbox(ctx, &runtime.StopPodSandboxRequest{
+			PodSandboxId: testID,
+		})
+		if test.ctxTimeout != 0 {
+			assert.True(t, time.Since(start) < test.ctxTimeout+time.Second,
+				"sandbox stop should be bounded by the caller's deadline")
+		}
+		_, sandboxExists := fake.ContainerList[testID]
+		if test.expectErr {
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), `containers ["running"] in sandbox "test-id" are still running`)
+			assert.Contains(t, err.Error(), `container "running"`)
+			assert.Nil(t, res)
+			assert.True(t, sandboxExists, "sandbox container should not be stopped")
+			continue
+		}
+		assert.NoError(t, err)
+		assert.NotNil(t, res)
+		assert.False(t, sandboxExists, "sandbox container should be stopped")
+		meta, err := c.containerStore.Get("running")
+		assert.NoError(t, err)
+		assert.Equal(t, runtime.ContainerState_CONTAINER_EXITED, meta.State())
+		meta, err = c.containerStore.Get("other")
+		assert.NoError(t, err)
+		assert.Equal(t, runtime.ContainerState_CONTAINER_RUNNING, meta.State(),
+			"containers in other sandboxes should not be stopped")
+	}
+}
@@ -17,7 +17,15 @@ limitations under the License.
 package server
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
 	"github.com/docker/docker/pkg/truncindex"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 
 	contentapi "github.com/containerd/containerd/api/services/content"
@@ -31,10 +39,12 @@ import (
 	imagesservice "github.com/containerd/containerd/services/images"
 	rootfsservice "github.com/containerd/containerd/services/rootfs"
 
+	"github.com/kubernetes-incubator/cri-containerd/cmd/cri-containerd/options"
 	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
 	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata/store"
 	osinterface "github.com/kubernetes-incubator/cri-containerd/pkg/os"
 	"github.com/kubernetes-incubator/cri-containerd/pkg/registrar"
+	"github.com/kubernetes-incubator/cri-containerd/pkg/selinux"
 
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
 )
@@ -51,8 +61,13 @@ import (
 	_ "github.com/opencontainers/runtime-spec/specs-go"
 )
 
+// boltOpenTimeout is the timeout to wait for the lock of the metadata
+// database, which is held by another running cri-containerd.
+const boltOpenTimeout = 10 * time.Second
+
 // CRIContainerdService is the interface implement CRI remote service server.
 type CRIContainerdService interface {
+	Start() error
 	runtime.RuntimeServiceServer
 	runtime.ImageServiceServer
 }
@@ -63,6 +78,19 @@ type criContainerdService struct {
 	os osinterface.OS
 	// rootDir is the directory for managing cri-containerd files.
 	rootDir string
+	// instanceID identifies the cri-containerd instance when multiple
+	// instances share the same containerd.
+	instanceID string
+	// seccompProfileRoot is the directory for local seccomp profiles.
+	seccompProfileRoot string
+	// noNewPrivileges indicates whether to set no_new_privs for container
+	// processes by default.
+	noNewPrivileges bool
+	// systemdCgroup indicates whether to use systemd cgroup driver.
+	systemdCgroup bool
+	// defaultCgroupParent is the cgroups parent used when cgroup parent is
+	// not specified by kubelet.
+	defaultCgroupParent string
 	// sandboxStore stores all sandbox metadata.
 	sandboxStore metadata.SandboxStore
 	// imageMetadataStore stores all image metadata.
@@ -74,6 +102,22 @@ type criContainerdService struct {
 	// id "abcdefg" is added, we could use "abcd" to identify the same thing
 	// as long as there is no ambiguity.
 	sandboxIDIndex *truncindex.TruncIndex
+	// containerStore stores all container metadata.
+	containerStore metadata.ContainerStore
+	// containerNameIndex stores all container names and make sure each
+	// name is unique.
+	containerNameIndex *registrar.Registrar
+	// containerIDIndex is trie tree for truncated id indexing.
+	containerIDIndex *truncindex.TruncIndex
+	// selinuxEnabled indicates whether selinux is enabled on the host.
+	selinuxEnabled bool
+	// defaultProcessLabel is the default selinux process label of containers.
+	defaultProcessLabel string
+	// defaultMountLabel is the default selinux mount label of containers.
+	defaultMountLabel string
+	// selinuxLevelIndex stores all selinux levels allocated for sandboxes and
+	// make sure each allocated level is unique.
+	selinuxLevelIndex *registrar.Registrar
 	// containerService is containerd container service client.
 	containerService execution.ContainerServiceClient
 	// contentIngester is the containerd service to ingest content into
@@ -85,27 +129,132 @@ type criContainerdService struct {
 	// rootfsUnpacker is the containerd service to unpack image content
 	// into snapshots.
 	rootfsUnpacker rootfs.Unpacker
+	// rootfsService is the containerd service to prepare and get
+	// snapshot mounts for container rootfs.
+	rootfsService rootfsapi.RootFSClient
 	// imageStoreService is the containerd service to store and track
 	// image metadata.
 	imageStoreService images.Store
+	// orphanCounter counts the orphans removed by the orphan reconciler.
+	orphanCounter orphanCounter
+	// stateCache caches the state of containerd containers.
+	stateCache *containerStateCache
 }
 
 // NewCRIContainerdService returns a new instance of CRIContainerdService
-func NewCRIContainerdService(conn *grpc.ClientConn, rootDir string) CRIContainerdService {
+func NewCRIContainerdService(conn *grpc.ClientConn, config *options.CRIContainerdOptions) (CRIContainerdService, error) {
 	// TODO: Initialize different containerd clients.
-	// TODO(random-liu): [P2] Recover from runtime state and metadata store.
+	processLabel, mountLabel := selinux.DefaultLabels()
+	newMetadataStore, err := getMetadataStoreFactory(config)
+	if err != nil {
+		return nil, err
+	}
+	sandboxMetadataStore, err := newMetadataStore(sandboxesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox metadata store: %v", err)
+	}
+	containerMetadataStore, err := newMetadataStore(containersDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container metadata store: %v", err)
+	}
+	imageMetadataStore, err := newMetadataStore(imagesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image metadata store: %v", err)
+	}
+	sandboxStore, err := metadata.NewSandboxStore(sandboxMetadataStore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sandbox metadata: %v", err)
+	}
+	containerStore, err := metadata.NewContainerStore(containerMetadataStore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load container metadata: %v", err)
+	}
+	imageMetaStore, err := metadata.NewImageMetadataStore(imageMetadataStore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load image metadata: %v", err)
+	}
 	return &criContainerdService{
-		os:                 osinterface.RealOS{},
-		rootDir:            rootDir,
-		sandboxStore:       metadata.NewSandboxStore(store.NewMetadataStore()),
-		imageMetadataStore: metadata.NewImageMetadataStore(store.NewMetadataStore()),
-		// TODO(random-liu): Register sandbox id/name for recovered sandbox.
-		sandboxNameIndex:  registrar.NewRegistrar(),
-		sandboxIDIndex:    truncindex.NewTruncIndex(nil),
-		containerService:  execution.NewContainerServiceClient(conn),
-		imageStoreService: imagesservice.NewStoreFromClient(imagesapi.NewImagesClient(conn)),
-		contentIngester:   contentservice.NewIngesterFromClient(contentapi.NewContentClient(conn)),
-		contentProvider:   contentservice.NewProviderFromClient(contentapi.NewContentClient(conn)),
-		rootfsUnpacker:    rootfsservice.NewUnpackerFromClient(rootfsapi.NewRootFSClient(conn)),
+		os:                  osinterface.RealOS{},
+		rootDir:             config.GetRootDir(),
+		instanceID:          config.InstanceID,
+		seccompProfileRoot:  config.SeccompProfileRoot,
+		noNewPrivileges:     config.NoNewPrivileges,
+		systemdCgroup:       config.CgroupDriver == options.CgroupDriverSystemd,
+		defaultCgroupParent: config.GetDefaultCgroupParent(),
+		sandboxStore:        sandboxStore,
+		imageMetadataStore:  imageMetaStore,
+		sandboxNameIndex:    registrar.NewRegistrar(),
+		sandboxIDIndex:      truncindex.NewTruncIndex(nil),
+		containerStore:      containerStore,
+		containerNameIndex:  registrar.NewRegistrar(),
+		containerIDIndex:    truncindex.NewTruncIndex(nil),
+		selinuxEnabled:      selinux.Enabled(),
+		defaultProcessLabel: processLabel,
+		defaultMountLabel:   mountLabel,
+		selinuxLevelIndex:   registrar.NewRegistrar(),
+		containerService:    execution.NewContainerServiceClient(conn),
+		imageStoreService:   imagesservice.NewStoreFromClient(imagesapi.NewImagesClient(conn)),
+		contentIngester:     contentservice.NewIngesterFromClient(contentapi.NewContentClient(conn)),
+		contentProvider:     contentservice.NewProviderFromClient(contentapi.NewContentClient(conn)),
+		rootfsUnpacker:      rootfsservice.NewUnpackerFromClient(rootfsapi.NewRootFSClient(conn)),
+		rootfsService:       rootfsapi.NewRootFSClient(conn),
+		stateCache:          newContainerStateCache(),
+	}, nil
+}
+
+// getMetadataStoreFactory returns a function which creates a metadata store
+// for a kind of metadata with the configured backend. The file backend uses
+// a directory for each kind, and the bolt backend uses a bucket for each kind
+// in a single database.
+func getMetadataStoreFactory(config *options.CRIContainerdOptions) (func(kind string) (store.MetadataStore, error), error) {
+	dir := filepath.Join(config.GetRootDir(), metadataDir)
+	switch config.MetadataStoreBackend {
+	case options.MetadataStoreBackendFile:
+		return func(kind string) (store.MetadataStore, error) {
+			return store.NewFileMetadataStore(filepath.Join(dir, kind))
+		}, nil
+	case options.MetadataStoreBackendBolt:
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create metadata directory %q: %v", dir, err)
+		}
+		// The database is closed when the process exits.
+		db, err := bolt.Open(filepath.Join(dir, metadataDBFile), 0600, &bolt.Options{Timeout: boltOpenTimeout})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open metadata database: %v", err)
+		}
+		return func(kind string) (store.MetadataStore, error) {
+			return store.NewBoltMetadataStore(db, kind)
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported metadata store backend %q", config.MetadataStoreBackend)
+}
+
+// Start starts the cri-containerd service. It recovers state from the
+// metadata store and containerd first, so it must be called before serving
+// any request.
+func (c *criContainerdService) Start() error {
+	// Do not refuse to start if apparmor is not usable on the host, only
+	// containers requesting the runtime default profile fail to be created.
+	if err := c.loadDefaultApparmorProfile(); err != nil {
+		glog.Errorf("Failed to load default apparmor profile %q, %q is not available: %v",
+			defaultApparmorProfile, profileNameRuntimeDefault, err)
+	}
+	// Subscribe to the event stream before recovery, so that the events
+	// happened during recovery are handled after it.
+	events, err := c.subscribeEvents()
+	if err != nil {
+		return fmt.Errorf("failed to subscribe containerd events: %v", err)
+	}
+	if err := c.recover(context.Background()); err != nil {
+		return fmt.Errorf("failed to recover state: %v", err)
+	}
+	c.startEventMonitor(events)
+	// Resync the state cache after the event monitor is started, so that
+	// no state change is missed.
+	if err := c.startStateCacheResync(); err != nil {
+		return fmt.Errorf("failed to sync container state cache: %v", err)
 	}
+	c.publishOrphanCounter()
+	c.startOrphanReconciler()
+	return nil
 }
@@ -18,7 +18,9 @@ package server
 
 import (
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/docker/docker/pkg/truncindex"
@@ -26,6 +28,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 
+	"github.com/kubernetes-incubator/cri-containerd/cmd/cri-containerd/options"
 	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
 	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata/store"
 	ostesting "github.com/kubernetes-incubator/cri-containerd/pkg/os/testing"
@@ -43,17 +46,32 @@ func (nopReadWriteCloser) Read(p []byte) (n int, err error)  { return len(p), ni
 func (nopReadWriteCloser) Write(p []byte) (n int, err error) { return len(p), nil }
 func (nopReadWriteCloser) Close() error                      { return nil }
 
-const testRootDir = "/test/rootfs"
+const (
+	testRootDir            = "/test/rootfs"
+	testSeccompProfileRoot = "/test/seccomp"
+)
 
 // newTestCRIContainerdService creates a fake criContainerdService for test.
 func newTestCRIContainerdService() *criContainerdService {
+	// Loading from an empty in-memory store never fails.
+	sandboxStore, _ := metadata.NewSandboxStore(store.NewMetadataStore())
+	imageMetadataStore, _ := metadata.NewImageMetadataStore(store.NewMetadataStore())
+	containerStore, _ := metadata.NewContainerStore(store.NewMetadataStore())
 	return &criContainerdService{
-		os:               ostesting.NewFakeOS(),
-		rootDir:          testRootDir,
-		containerService: servertesting.NewFakeExecutionClient(),
-		sandboxStore:     metadata.NewSandboxStore(store.NewMetadataStore()),
-		sandboxNameIndex: registrar.NewRegistrar(),
-		sandboxIDIndex:   truncindex.NewTruncIndex(nil),
+		os:                 ostesting.NewFakeOS(),
+		rootDir:            testRootDir,
+		seccompProfileRoot: testSeccompProfileRoot,
+		containerService:   servertesting.NewFakeExecutionClient(),
+		rootfsService:      servertesting.NewFakeRootfsClient(),
+		sandboxStore:       sandboxStore,
+		imageMetadataStore: imageMetadataStore,
+		containerStore:     containerStore,
+		sandboxNameIndex:   registrar.NewRegistrar(),
+		sandboxIDIndex:     truncindex.NewTruncIndex(nil),
+		containerNameIndex: registrar.NewRegistrar(),
+		containerIDIndex:   truncindex.NewTruncIndex(nil),
+		selinuxLevelIndex:  registrar.NewRegistrar(),
+		stateCache:         newContainerStateCache(),
 	}
 }
 
@@ -160,3 +178,43 @@ func TestSandboxOperations(t *testing.T) {
 	assert.NoError(t, err)
 	require.NotNil(t, runRes)
 }
+
+func TestGetMetadataStoreFactory(t *testing.T) {
+	for _, backend := range []string{options.MetadataStoreBackendFile, options.MetadataStoreBackendBolt} {
+		t.Logf("TestCase %q", backend)
+		dir, err := ioutil.TempDir("", "test-metadata-store")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		newMetadataStore, err := getMetadataStoreFactory(&options.CRIContainerdOptions{
+			RootDir:              dir,
+			MetadataStoreBackend: backend,
+		})
+		require.NoError(t, err)
+		sandboxMetadataStore, err := newMetadataStore(sandboxesDir)
+		require.NoError(t, err)
+		containerMetadataStore, err := newMetadataStore(containersDir)
+		require.NoError(t, err)
+		assert.NoError(t, sandboxMetadataStore.Create("test-id", []byte("sandbox")))
+		assert.NoError(t, containerMetadataStore.Create("test-id", []byte("container")),
+			"different kinds of metadata should be stored separately")
+	}
+
+	t.Logf("should store metadata under the instance root directory")
+	dir, err := ioutil.TempDir("", "test-metadata-store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	newMetadataStore, err := getMetadataStoreFactory(&options.CRIContainerdOptions{
+		RootDir:              dir,
+		MetadataStoreBackend: options.MetadataStoreBackendBolt,
+		InstanceID:           "test-instance",
+	})
+	require.NoError(t, err)
+	_, err = newMetadataStore(sandboxesDir)
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "instances", "test-instance", metadataDir, metadataDBFile))
+	assert.NoError(t, err)
+
+	t.Logf("should return error for unsupported backend")
+	_, err = getMetadataStoreFactory(&options.CRIContainerdOptions{MetadataStoreBackend: "unknown"})
+	assert.Error(t, err)
+}
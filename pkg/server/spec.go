@@ -0,0 +1,178 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	goruntime "runtime"
+
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+)
+
+// defaultPathEnv is the default PATH environment variable of a container.
+const defaultPathEnv = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// defaultMounts are the default mounts of a container, which are the same
+// with docker.
+var defaultMounts = []runtimespec.Mount{
+	{
+		Destination: "/proc",
+		Type:        "proc",
+		Source:      "proc",
+		Options:     []string{"nosuid", "noexec", "nodev"},
+	},
+	{
+		Destination: "/dev",
+		Type:        "tmpfs",
+		Source:      "tmpfs",
+		Options:     []string{"nosuid", "strictatime", "mode=755", "size=65536k"},
+	},
+	{
+		Destination: "/dev/pts",
+		Type:        "devpts",
+		Source:      "devpts",
+		Options:     []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620", "gid=5"},
+	},
+	{
+		Destination: "/sys",
+		Type:        "sysfs",
+		Source:      "sysfs",
+		Options:     []string{"nosuid", "noexec", "nodev", "ro"},
+	},
+	{
+		Destination: "/sys/fs/cgroup",
+		Type:        "cgroup",
+		Source:      "cgroup",
+		Options:     []string{"nosuid", "noexec", "nodev", "relatime", "ro"},
+	},
+	{
+		Destination: "/dev/mqueue",
+		Type:        "mqueue",
+		Source:      "mqueue",
+		Options:     []string{"nosuid", "noexec", "nodev"},
+	},
+	// TODO(random-liu): [P0] Deal with /dev/shm. Use host for HostIpc, and
+	// create and mount for non-HostIpc.
+	{
+		Destination: "/dev/shm",
+		Type:        "tmpfs",
+		Source:      "shm",
+		Options:     []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"},
+	},
+}
+
+// defaultMaskedPaths are the paths masked in a container, which are the same
+// with docker.
+var defaultMaskedPaths = []string{
+	"/proc/kcore",
+	"/proc/keys",
+	"/proc/latency_stats",
+	"/proc/timer_list",
+	"/proc/timer_stats",
+	"/proc/sched_debug",
+	"/proc/scsi",
+	"/sys/firmware",
+}
+
+// defaultReadonlyPaths are the paths mounted read-only in a container, which
+// are the same with docker.
+var defaultReadonlyPaths = []string{
+	"/proc/asound",
+	"/proc/bus",
+	"/proc/fs",
+	"/proc/irq",
+	"/proc/sys",
+	"/proc/sysrq-trigger",
+}
+
+// defaultRlimits are the default resource limits of a container process, the
+// open file limit is the same with the docker daemon systemd unit.
+var defaultRlimits = []runtimespec.LinuxRlimit{
+	{
+		Type: "RLIMIT_NOFILE",
+		Hard: 1048576,
+		Soft: 1048576,
+	},
+}
+
+// defaultRuntimeSpec returns the default oci spec template used by both
+// sandbox container and application container.
+func defaultRuntimeSpec() *runtimespec.Spec {
+	caps := append([]string{}, defaultCapabilities...)
+	return &runtimespec.Spec{
+		Version: runtimespec.Version,
+		Platform: runtimespec.Platform{
+			OS:   goruntime.GOOS,
+			Arch: goruntime.GOARCH,
+		},
+		Root: runtimespec.Root{
+			Path: relativeRootfsPath,
+		},
+		Process: runtimespec.Process{
+			Cwd: "/",
+			Env: []string{defaultPathEnv},
+			Capabilities: &runtimespec.LinuxCapabilities{
+				Bounding:    caps,
+				Effective:   append([]string{}, caps...),
+				Inheritable: append([]string{}, caps...),
+				Permitted:   append([]string{}, caps...),
+				Ambient:     append([]string{}, caps...),
+			},
+			Rlimits: append([]runtimespec.LinuxRlimit{}, defaultRlimits...),
+		},
+		Mounts: copyMounts(defaultMounts),
+		Linux: &runtimespec.Linux{
+			Resources: &runtimespec.LinuxResources{
+				// Deny access to all devices by default, runc allows the
+				// default devices.
+				Devices: []runtimespec.LinuxDeviceCgroup{
+					{
+						Allow:  false,
+						Access: "rwm",
+					},
+				},
+			},
+			Namespaces: []runtimespec.LinuxNamespace{
+				{Type: runtimespec.PIDNamespace},
+				{Type: runtimespec.NetworkNamespace},
+				{Type: runtimespec.IPCNamespace},
+				{Type: runtimespec.UTSNamespace},
+				{Type: runtimespec.MountNamespace},
+			},
+			MaskedPaths:   append([]string{}, defaultMaskedPaths...),
+			ReadonlyPaths: append([]string{}, defaultReadonlyPaths...),
+		},
+	}
+}
+
+// copyMounts deep copies oci mounts, so that the default mounts are not
+// changed by the spec generator.
+func copyMounts(mounts []runtimespec.Mount) []runtimespec.Mount {
+	var copied []runtimespec.Mount
+	for _, m := range mounts {
+		m.Options = append([]string{}, m.Options...)
+		copied = append(copied, m)
+	}
+	return copied
+}
+
+// newSpecGenerator creates a spec generator with the default spec template.
+func (c *criContainerdService) newSpecGenerator() generate.Generator {
+	spec := defaultRuntimeSpec()
+	spec.Process.NoNewPrivileges = c.noNewPrivileges
+	return generate.NewFromSpec(spec)
+}
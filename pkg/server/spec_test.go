@@ -0,0 +1,89 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/user"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "Update golden files in testdata.")
+
+// checkGoldenSpec compares the oci spec with the golden file in testdata.
+// The platform is host specific, so it's not compared.
+func checkGoldenSpec(t *testing.T, golden string, spec *runtimespec.Spec) {
+	spec.Platform = runtimespec.Platform{}
+	data, err := json.MarshalIndent(spec, "", "\t")
+	require.NoError(t, err)
+	path := filepath.Join("testdata", golden)
+	if *updateGolden {
+		require.NoError(t, ioutil.WriteFile(path, append(data, '\n'), 0644))
+	}
+	expected, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(data)+"\n", "spec should match golden file %q", path)
+}
+
+func TestDefaultRuntimeSpec(t *testing.T) {
+	c := newTestCRIContainerdService()
+	g := c.newSpecGenerator()
+	checkGoldenSpec(t, "default_spec.golden", g.Spec())
+
+	t.Logf("default spec should not be changed by spec generator")
+	g.AddTmpfsMount("/test", []string{"ro"})
+	g.Spec().Mounts[0].Options[0] = "changed"
+	g.Spec().Linux.MaskedPaths[0] = "changed"
+	assert.Equal(t, defaultMounts, defaultRuntimeSpec().Mounts)
+	assert.Equal(t, defaultMaskedPaths, defaultRuntimeSpec().Linux.MaskedPaths)
+
+	t.Logf("no new privileges should be set if enabled")
+	c.noNewPrivileges = true
+	g = c.newSpecGenerator()
+	assert.True(t, g.Spec().Process.NoNewPrivileges)
+}
+
+func TestSandboxSpecGolden(t *testing.T) {
+	c := newTestCRIContainerdService()
+	config, _ := getRunPodSandboxTestData()
+	spec, err := c.generateSandboxContainerSpec("test-sandbox-id", config, "", "")
+	require.NoError(t, err)
+	checkGoldenSpec(t, "sandbox_spec.golden", spec)
+}
+
+func TestContainerSpecGolden(t *testing.T) {
+	c := newTestCRIContainerdService()
+	config, sandboxConfig, _ := getCreateContainerTestData()
+	config.Mounts = []*runtime.Mount{
+		{ContainerPath: "/test-rw", HostPath: "/host-rw"},
+		{ContainerPath: "/test-ro", HostPath: "/host-ro", Readonly: true},
+	}
+	execUser := &user.ExecUser{UID: 1000, GID: 1001, Sgids: []uint32{2000}}
+	spec, err := c.generateContainerSpec("test-container-id", "test-sandbox-id", 1234, config, sandboxConfig, nil, nil, execUser, "", "")
+	require.NoError(t, err)
+	checkGoldenSpec(t, "container_spec.golden", spec)
+}
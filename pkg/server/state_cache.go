@@ -0,0 +1,214 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"github.com/containerd/containerd/api/types/container"
+)
+
+// stateCacheResyncInterval is the interval between two full resyncs of the
+// container state cache with containerd.
+const stateCacheResyncInterval = time.Minute
+
+// containerStateCache caches the state of containerd containers, so that
+// sandbox list and status requests don't need to query containerd. It is
+// updated by container events, by cri-containerd operations which change
+// container state without an event (e.g. delete), and by periodic full
+// resync which corrects any missed update.
+// Each update is assigned an increasing sequence number, so that a resync
+// never overrides an update newer than the containerd container list it
+// merges.
+type containerStateCache struct {
+	sync.RWMutex
+	// seq is the sequence number of the latest update.
+	seq uint64
+	// containers are the cached containers.
+	containers map[string]cachedContainer
+	// deleted are the sequence numbers of deleted containers which may
+	// still be in a containerd container list taken before the deletion.
+	deleted map[string]uint64
+}
+
+// cachedContainer is the cached state of a containerd container.
+type cachedContainer struct {
+	container.Container
+	// seq is the sequence number of the update which sets the state.
+	seq uint64
+}
+
+// newContainerStateCache creates an empty container state cache.
+func newContainerStateCache() *containerStateCache {
+	return &containerStateCache{
+		containers: make(map[string]cachedContainer),
+		deleted:    make(map[string]uint64),
+	}
+}
+
+// get returns the cached state of a container, and whether it is found.
+func (s *containerStateCache) get(id string) (container.Container, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	c, ok := s.containers[id]
+	return c.Container, ok
+}
+
+// set sets the state of a container with a new sequence number. The caller
+// should hold the write lock.
+func (s *containerStateCache) set(c container.Container) {
+	s.seq++
+	s.containers[c.ID] = cachedContainer{Container: c, seq: s.seq}
+	delete(s.deleted, c.ID)
+}
+
+// sequence returns the sequence number of the latest update. It should be
+// got before listing containers from containerd for merge.
+func (s *containerStateCache) sequence() uint64 {
+	s.RLock()
+	defer s.RUnlock()
+	return s.seq
+}
+
+// merge merges the containers listed from containerd into the cache. The
+// list is taken after the passed in sequence number is got, and any update
+// after that is newer than the list and kept:
+// * A container updated or deleted after that is not changed.
+// * A container not in the list is removed if it is not updated after that.
+// * Other containers in the list override the cached states.
+func (s *containerStateCache) merge(seq uint64, containers map[string]*container.Container) {
+	s.Lock()
+	defer s.Unlock()
+	for id, c := range s.containers {
+		if _, ok := containers[id]; !ok && c.seq <= seq {
+			delete(s.containers, id)
+		}
+	}
+	for id, c := range containers {
+		if cached, ok := s.containers[id]; ok && cached.seq > seq {
+			continue
+		}
+		if deletedSeq, ok := s.deleted[id]; ok && deletedSeq > seq {
+			continue
+		}
+		s.containers[id] = cachedContainer{Container: *c, seq: seq}
+	}
+	// Deletions before the list are reflected in the list, they don't need
+	// to be remembered any more.
+	for id, deletedSeq := range s.deleted {
+		if deletedSeq <= seq {
+			delete(s.deleted, id)
+		}
+	}
+}
+
+// create records that a container is created. It doesn't override the state
+// of an existing container, because an exit event may be handled before the
+// creation is recorded.
+func (s *containerStateCache) create(id string, pid uint32) {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.containers[id]; ok {
+		return
+	}
+	s.set(container.Container{ID: id, Pid: pid, Status: container.Status_CREATED})
+}
+
+// start records that the init process of a container is started. Only a
+// created container could be started, so that an exit handled earlier is not
+// overridden.
+func (s *containerStateCache) start(id string) {
+	s.Lock()
+	defer s.Unlock()
+	c, ok := s.containers[id]
+	if !ok || c.Status != container.Status_CREATED {
+		return
+	}
+	c.Status = container.Status_RUNNING
+	s.set(c.Container)
+}
+
+// exit records that the process with the pid exited. It only changes the
+// state of a known container, and only if the process is the init process
+// of the container.
+func (s *containerStateCache) exit(id string, pid uint32) {
+	s.Lock()
+	defer s.Unlock()
+	c, ok := s.containers[id]
+	if !ok || c.Pid != pid {
+		return
+	}
+	c.Status = container.Status_STOPPED
+	s.set(c.Container)
+}
+
+// delete records that a container is deleted.
+func (s *containerStateCache) delete(id string) {
+	s.Lock()
+	defer s.Unlock()
+	s.seq++
+	delete(s.containers, id)
+	s.deleted[id] = s.seq
+}
+
+// updateStateCache updates the container state cache with a containerd
+// event.
+func (c *criContainerdService) updateStateCache(e *container.Event) {
+	switch e.Type {
+	case container.Event_CREATE:
+		c.stateCache.create(e.ID, e.Pid)
+	case container.Event_START:
+		c.stateCache.start(e.ID)
+	case container.Event_EXIT:
+		c.stateCache.exit(e.ID, e.Pid)
+	}
+}
+
+// resyncStateCache merges the containers managed by cri-containerd in
+// containerd into the container state cache. Updates happened during the
+// resync are not overridden.
+func (c *criContainerdService) resyncStateCache(ctx context.Context) error {
+	seq := c.stateCache.sequence()
+	containers, err := c.listManagedContainers(ctx)
+	if err != nil {
+		return err
+	}
+	c.stateCache.merge(seq, containers)
+	return nil
+}
+
+// startStateCacheResync resyncs the container state cache once, and then
+// periodically in the background.
+func (c *criContainerdService) startStateCacheResync() error {
+	if err := c.resyncStateCache(context.Background()); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(stateCacheResyncInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := c.resyncStateCache(context.Background()); err != nil {
+				glog.Errorf("Failed to resync container state cache: %v", err)
+			}
+		}
+	}()
+	return nil
+}
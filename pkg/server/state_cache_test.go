@@ -0,0 +1,363 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/api/services/execution"
+	"github.com/containerd/containerd/api/types/container"
+
+	"github.com/kubernetes-incubator/cri-containerd/pkg/metadata"
+	ostesting "github.com/kubernetes-incubator/cri-containerd/pkg/os/testing"
+	servertesting "github.com/kubernetes-incubator/cri-containerd/pkg/server/testing"
+
+	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+func TestContainerStateCache(t *testing.T) {
+	testID := "test-id"
+	for desc, test := range map[string]struct {
+		update        func(*containerStateCache)
+		expect        container.Container
+		expectExist   bool
+		expectRemoved string
+	}{
+		"create should add created container": {
+			update: func(s *containerStateCache) {
+				s.create(testID, 1)
+			},
+			expect:      container.Container{ID: testID, Pid: 1, Status: container.Status_CREATED},
+			expectExist: true,
+		},
+		"start should change created container to running": {
+			update: func(s *containerStateCache) {
+				s.create(testID, 1)
+				s.start(testID)
+			},
+			expect:      container.Container{ID: testID, Pid: 1, Status: container.Status_RUNNING},
+			expectExist: true,
+		},
+		"exit of init process should change container to stopped": {
+			update: func(s *containerStateCache) {
+				s.create(testID, 1)
+				s.start(testID)
+				s.exit(testID, 1)
+			},
+			expect:      container.Container{ID: testID, Pid: 1, Status: container.Status_STOPPED},
+			expectExist: true,
+		},
+		"exit of other process should not change container state": {
+			update: func(s *containerStateCache) {
+				s.create(testID, 1)
+				s.start(testID)
+				s.exit(testID, 2)
+			},
+			expect:      container.Container{ID: testID, Pid: 1, Status: container.Status_RUNNING},
+			expectExist: true,
+		},
+		"exit handled before create and start should not be overridden": {
+			update: func(s *containerStateCache) {
+				s.create(testID, 1)
+				s.exit(testID, 1)
+				s.create(testID, 1)
+				s.start(testID)
+			},
+			expect:      container.Container{ID: testID, Pid: 1, Status: container.Status_STOPPED},
+			expectExist: true,
+		},
+		"exit should not add unknown container": {
+			update: func(s *containerStateCache) {
+				s.exit(testID, 1)
+			},
+		},
+		"start should not add unknown container": {
+			update: func(s *containerStateCache) {
+				s.start(testID)
+			},
+		},
+		"delete should remove container": {
+			update: func(s *containerStateCache) {
+				s.create(testID, 1)
+				s.delete(testID)
+			},
+		},
+		"merge should override containers not updated after the list": {
+			update: func(s *containerStateCache) {
+				s.create("other-id", 2)
+				s.merge(s.sequence(), map[string]*container.Container{
+					testID: {ID: testID, Pid: 1, Status: container.Status_RUNNING},
+				})
+			},
+			expect:        container.Container{ID: testID, Pid: 1, Status: container.Status_RUNNING},
+			expectExist:   true,
+			expectRemoved: "other-id",
+		},
+		"merge should not remove container created after the list": {
+			update: func(s *containerStateCache) {
+				seq := s.sequence()
+				s.create(testID, 1)
+				s.start(testID)
+				s.merge(seq, map[string]*container.Container{})
+			},
+			expect:      container.Container{ID: testID, Pid: 1, Status: container.Status_RUNNING},
+			expectExist: true,
+		},
+		"merge should not override exit after the list": {
+			update: func(s *containerStateCache) {
+				s.create(testID, 1)
+				s.start(testID)
+				seq := s.sequence()
+				s.exit(testID, 1)
+				s.merge(seq, map[string]*container.Container{
+					testID: {ID: testID, Pid: 1, Status: container.Status_RUNNING},
+				})
+			},
+			expect:      container.Container{ID: testID, Pid: 1, Status: container.Status_STOPPED},
+			expectExist: true,
+		},
+		"merge should not add container deleted after the list": {
+			update: func(s *containerStateCache) {
+				s.create(testID, 1)
+				seq := s.sequence()
+				s.delete(testID)
+				s.merge(seq, map[string]*container.Container{
+					testID: {ID: testID, Pid: 1, Status: container.Status_STOPPED},
+				})
+			},
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		s := newContainerStateCache()
+		test.update(s)
+		c, ok := s.get(testID)
+		assert.Equal(t, test.expectExist, ok)
+		assert.Equal(t, test.expect, c)
+		if test.expectRemoved != "" {
+			_, ok := s.get(test.expectRemoved)
+			assert.False(t, ok)
+		}
+	}
+}
+
+func TestStateCacheUpdatedByEvents(t *testing.T) {
+	testID := "test-id"
+	c := newTestCRIContainerdService()
+	fake := servertesting.NewFakeExecutionClient().WithEvents()
+	c.containerService = fake
+	events, err := c.subscribeEvents()
+	require.NoError(t, err)
+	c.startEventMonitor(events)
+	createResp, err := fake.Create(context.Background(), &execution.CreateRequest{ID: testID})
+	require.NoError(t, err)
+	_, err = fake.Start(context.Background(), &execution.StartRequest{ID: testID})
+	require.NoError(t, err)
+	assert.NoError(t, c.waitStateCache(testID, container.Status_RUNNING))
+	_, err = fake.Kill(context.Background(), &execution.KillRequest{ID: testID})
+	require.NoError(t, err)
+	assert.NoError(t, c.waitStateCache(testID, container.Status_STOPPED))
+	cntr, ok := c.stateCache.get(testID)
+	assert.True(t, ok)
+	assert.Equal(t, createResp.Pid, cntr.Pid)
+}
+
+// waitStateCache waits until the container is in the expected state in the
+// state cache.
+func (c *criContainerdService) waitStateCache(id string, status container.Status) error {
+	for i := 0; i < 100; i++ {
+		if cntr, ok := c.stateCache.get(id); ok && cntr.Status == status {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("container %q is not %v in the state cache", id, status)
+}
+
+// benchmarkSandboxNum is the number of sandboxes used in benchmarks.
+const benchmarkSandboxNum = 3000
+
+// benchmarkContainerServer is a containerd container service serving a fixed
+// list of containers. It is served over grpc in benchmarks, so that the cost
+// of querying containerd includes the grpc round trip.
+type benchmarkContainerServer struct {
+	execution.ContainerServiceServer
+	containers map[string]*container.Container
+}
+
+// Info returns the container.
+func (s *benchmarkContainerServer) Info(ctx context.Context, r *execution.InfoRequest) (*container.Container, error) {
+	c, ok := s.containers[r.ID]
+	if !ok {
+		return nil, grpc.Errorf(codes.Unknown, containerd.ErrContainerNotExist.Error())
+	}
+	return c, nil
+}
+
+// List returns all containers.
+func (s *benchmarkContainerServer) List(ctx context.Context, r *execution.ListRequest) (*execution.ListResponse, error) {
+	resp := &execution.ListResponse{}
+	for _, c := range s.containers {
+		resp.Containers = append(resp.Containers, c)
+	}
+	return resp, nil
+}
+
+// newBenchmarkService returns a service with benchmarkSandboxNum running
+// sandboxes. Sandbox root directories are created on disk, so that checking
+// the container ownership costs the same as in production. Containers are
+// served by a containerd container service over grpc.
+func newBenchmarkService(b *testing.B) (*criContainerdService, func()) {
+	c := newTestCRIContainerdService()
+	rootDir, err := ioutil.TempDir("", "state-cache-benchmark")
+	require.NoError(b, err)
+	c.rootDir = rootDir
+	c.os.(*ostesting.FakeOS).StatFn = os.Stat
+	containers := make(map[string]*container.Container)
+	for i := 0; i < benchmarkSandboxNum; i++ {
+		id := fmt.Sprintf("sandbox-%d", i)
+		require.NoError(b, c.sandboxStore.Create(metadata.SandboxMetadata{
+			ID:     id,
+			Name:   id,
+			Config: &runtime.PodSandboxConfig{Metadata: &runtime.PodSandboxMetadata{Name: id}},
+		}))
+		require.NoError(b, c.sandboxIDIndex.Add(id))
+		require.NoError(b, os.MkdirAll(getSandboxRootDir(rootDir, id), 0755))
+		containers[id] = &container.Container{ID: id, Pid: uint32(i + 1), Status: container.Status_RUNNING}
+	}
+
+	socket := filepath.Join(rootDir, "containerd.sock")
+	l, err := net.Listen(unixProtocol, socket)
+	require.NoError(b, err)
+	s := grpc.NewServer()
+	execution.RegisterContainerServiceServer(s, &benchmarkContainerServer{containers: containers})
+	go s.Serve(l) // nolint: errcheck
+	conn, err := ConnectToContainerd(socket, time.Minute)
+	require.NoError(b, err)
+	c.containerService = execution.NewContainerServiceClient(conn)
+
+	require.NoError(b, c.resyncStateCache(context.Background()))
+	return c, func() {
+		conn.Close() // nolint: errcheck
+		s.GracefulStop()
+		os.RemoveAll(rootDir) // nolint: errcheck
+	}
+}
+
+// listPodSandboxWithoutCache is how ListPodSandbox got sandbox states before
+// the state cache: it listed all containerd containers on every call, and
+// looked each sandbox up in the list.
+func (c *criContainerdService) listPodSandboxWithoutCache(ctx context.Context) ([]*runtime.PodSandbox, error) {
+	sandboxesInStore, err := c.sandboxStore.List()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.containerService.List(ctx, &execution.ListRequest{})
+	if err != nil {
+		return nil, err
+	}
+	sandboxesInContainerd := resp.Containers
+	var sandboxes []*runtime.PodSandbox
+	for _, sandboxInStore := range sandboxesInStore {
+		var sandboxInContainerd *container.Container
+		for _, s := range sandboxesInContainerd {
+			if s.ID == sandboxInStore.ID {
+				sandboxInContainerd = s
+				break
+			}
+		}
+		state := runtime.PodSandboxState_SANDBOX_NOTREADY
+		if sandboxInContainerd != nil && sandboxInContainerd.Status == container.Status_RUNNING {
+			state = runtime.PodSandboxState_SANDBOX_READY
+		}
+		sandboxes = append(sandboxes, toCRISandbox(sandboxInStore, state))
+	}
+	return sandboxes, nil
+}
+
+// podSandboxStatusWithoutCache is how PodSandboxStatus got the sandbox state
+// before the state cache: it got the sandbox container from containerd on
+// every call.
+func (c *criContainerdService) podSandboxStatusWithoutCache(ctx context.Context, id string) (*runtime.PodSandboxStatus, error) {
+	sandbox, err := c.getSandbox(id)
+	if err != nil {
+		return nil, err
+	}
+	info, err := c.containerService.Info(ctx, &execution.InfoRequest{ID: sandbox.ID})
+	if err != nil && !isContainerdContainerNotExistError(err) {
+		return nil, err
+	}
+	state := runtime.PodSandboxState_SANDBOX_NOTREADY
+	if info != nil && info.Status == container.Status_RUNNING {
+		state = runtime.PodSandboxState_SANDBOX_READY
+	}
+	return toCRISandboxStatus(sandbox, state), nil
+}
+
+func BenchmarkListPodSandbox(b *testing.B) {
+	c, cleanup := newBenchmarkService(b)
+	defer cleanup()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := c.ListPodSandbox(context.Background(), &runtime.ListPodSandboxRequest{})
+		require.NoError(b, err)
+	}
+}
+
+func BenchmarkListPodSandboxWithoutCache(b *testing.B) {
+	c, cleanup := newBenchmarkService(b)
+	defer cleanup()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := c.listPodSandboxWithoutCache(context.Background())
+		require.NoError(b, err)
+	}
+}
+
+func BenchmarkPodSandboxStatus(b *testing.B) {
+	c, cleanup := newBenchmarkService(b)
+	defer cleanup()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := fmt.Sprintf("sandbox-%d", i%benchmarkSandboxNum)
+		_, err := c.PodSandboxStatus(context.Background(), &runtime.PodSandboxStatusRequest{PodSandboxId: id})
+		require.NoError(b, err)
+	}
+}
+
+func BenchmarkPodSandboxStatusWithoutCache(b *testing.B) {
+	c, cleanup := newBenchmarkService(b)
+	defer cleanup()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := fmt.Sprintf("sandbox-%d", i%benchmarkSandboxNum)
+		_, err := c.podSandboxStatusWithoutCache(context.Background(), id)
+		require.NoError(b, err)
+	}
+}
@@ -143,6 +143,13 @@ func (f *FakeExecutionClient) appendCalled(name string, argument interface{}) {
 	f.called = append(f.called, call)
 }
 
+// ClearCalls clear all call details.
+func (f *FakeExecutionClient) ClearCalls() {
+	f.Lock()
+	defer f.Unlock()
+	f.called = []CalledDetail{}
+}
+
 // GetCalledNames get names of call
 func (f *FakeExecutionClient) GetCalledNames() []string {
 	f.Lock()
@@ -245,9 +252,10 @@ func (f *FakeExecutionClient) Delete(ctx context.Context, deleteOpts *execution.
 	}
 	delete(f.ContainerList, deleteOpts.ID)
 	f.sendEvent(&container.Event{
-		ID:   c.ID,
-		Type: container.Event_EXIT,
-		Pid:  c.Pid,
+		ID:       c.ID,
+		Type:     container.Event_EXIT,
+		Pid:      c.Pid,
+		ExitedAt: time.Now(),
 	})
 	return nil, nil
 }
@@ -301,9 +309,10 @@ func (f *FakeExecutionClient) Kill(ctx context.Context, killOpts *execution.Kill
 	c.Status = container.Status_STOPPED
 	f.ContainerList[killOpts.ID] = c
 	f.sendEvent(&container.Event{
-		ID:   c.ID,
-		Type: container.Event_EXIT,
-		Pid:  c.Pid,
+		ID:       c.ID,
+		Type:     container.Event_EXIT,
+		Pid:      c.Pid,
+		ExitedAt: time.Now(),
 	})
 	return &google_protobuf.Empty{}, nil
 }
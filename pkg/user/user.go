@@ -0,0 +1,202 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// User is an entry of /etc/passwd.
+type User struct {
+	Name string
+	UID  uint32
+	GID  uint32
+	Home string
+}
+
+// Group is an entry of /etc/group.
+type Group struct {
+	Name    string
+	GID     uint32
+	Members []string
+}
+
+// ExecUser is the resolved user a process runs as.
+type ExecUser struct {
+	// UID is the user id.
+	UID uint32
+	// GID is the primary group id.
+	GID uint32
+	// Name is the user name, it is empty if the user is not found in
+	// /etc/passwd.
+	Name string
+	// Home is the home directory of the user.
+	Home string
+	// Sgids are the supplementary groups the user is a member of in
+	// /etc/group.
+	Sgids []uint32
+}
+
+// ParsePasswd parses the content of /etc/passwd. Malformed lines are skipped.
+func ParsePasswd(data []byte) []User {
+	var users []User
+	for _, fields := range parseLines(data, 7) {
+		uid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		gid, err := strconv.ParseUint(fields[3], 10, 32)
+		if err != nil {
+			continue
+		}
+		users = append(users, User{
+			Name: fields[0],
+			UID:  uint32(uid),
+			GID:  uint32(gid),
+			Home: fields[5],
+		})
+	}
+	return users
+}
+
+// ParseGroup parses the content of /etc/group. Malformed lines are skipped.
+func ParseGroup(data []byte) []Group {
+	var groups []Group
+	for _, fields := range parseLines(data, 4) {
+		gid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		var members []string
+		if fields[3] != "" {
+			members = strings.Split(fields[3], ",")
+		}
+		groups = append(groups, Group{
+			Name:    fields[0],
+			GID:     uint32(gid),
+			Members: members,
+		})
+	}
+	return groups
+}
+
+// parseLines splits colon separated lines into fields, comments and lines
+// with unexpected number of fields are skipped.
+func parseLines(data []byte, n int) [][]string {
+	var result [][]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) != n {
+			continue
+		}
+		result = append(result, fields)
+	}
+	return result
+}
+
+// GetExecUser resolves a user spec in the format of "user[:group]", where
+// user and group could be either a name or a numeric id, with the entries of
+// /etc/passwd and /etc/group. A name must exist in the corresponding file, a
+// numeric id doesn't have to. When group is not specified, the primary group
+// of the user is used, or 0 if the user is not found. Groups in /etc/group
+// listing the user as a member are returned as supplementary groups.
+func GetExecUser(spec string, users []User, groups []Group) (*ExecUser, error) {
+	userSpec, groupSpec := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		userSpec, groupSpec = spec[:i], spec[i+1:]
+	}
+	if userSpec == "" {
+		return nil, fmt.Errorf("user is not specified in %q", spec)
+	}
+
+	execUser := &ExecUser{}
+	if uid, err := strconv.ParseUint(userSpec, 10, 32); err == nil {
+		execUser.UID = uint32(uid)
+		for _, u := range users {
+			if u.UID == execUser.UID {
+				execUser.GID = u.GID
+				execUser.Name = u.Name
+				execUser.Home = u.Home
+				break
+			}
+		}
+	} else {
+		found := false
+		for _, u := range users {
+			if u.Name == userSpec {
+				execUser.UID = u.UID
+				execUser.GID = u.GID
+				execUser.Name = u.Name
+				execUser.Home = u.Home
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no matching entries in passwd file for user %q", userSpec)
+		}
+	}
+
+	execUser.Sgids = getSupplementaryGroups(execUser.Name, groups)
+
+	if groupSpec == "" {
+		return execUser, nil
+	}
+	if gid, err := strconv.ParseUint(groupSpec, 10, 32); err == nil {
+		execUser.GID = uint32(gid)
+		return execUser, nil
+	}
+	for _, g := range groups {
+		if g.Name == groupSpec {
+			execUser.GID = g.GID
+			return execUser, nil
+		}
+	}
+	return nil, fmt.Errorf("no matching entries in group file for group %q", groupSpec)
+}
+
+// getSupplementaryGroups returns deduplicated ids of the groups listing the
+// user as a member.
+func getSupplementaryGroups(name string, groups []Group) []uint32 {
+	if name == "" {
+		return nil
+	}
+	var gids []uint32
+	seen := make(map[uint32]bool)
+	for _, g := range groups {
+		if seen[g.GID] {
+			continue
+		}
+		for _, m := range g.Members {
+			if m == name {
+				gids = append(gids, g.GID)
+				seen[g.GID] = true
+				break
+			}
+		}
+	}
+	return gids
+}
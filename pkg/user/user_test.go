@@ -0,0 +1,103 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPasswd = `# comment
+root:x:0:0:root:/root:/bin/bash
+daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin
+test:x:1000:1001:test user:/home/test:/bin/sh
+malformed:x:abc:1:malformed:/:/bin/sh
+`
+
+const testGroup = `root:x:0:
+daemon:x:1:
+test:x:1001:
+extra:x:2000:test,daemon
+wheel:x:10:test
+wheel-alias:x:10:test
+`
+
+func TestParsePasswd(t *testing.T) {
+	assert.Equal(t, []User{
+		{Name: "root", UID: 0, GID: 0, Home: "/root"},
+		{Name: "daemon", UID: 1, GID: 1, Home: "/usr/sbin"},
+		{Name: "test", UID: 1000, GID: 1001, Home: "/home/test"},
+	}, ParsePasswd([]byte(testPasswd)))
+}
+
+func TestParseGroup(t *testing.T) {
+	assert.Equal(t, []Group{
+		{Name: "root", GID: 0},
+		{Name: "daemon", GID: 1},
+		{Name: "test", GID: 1001},
+		{Name: "extra", GID: 2000, Members: []string{"test", "daemon"}},
+		{Name: "wheel", GID: 10, Members: []string{"test"}},
+		{Name: "wheel-alias", GID: 10, Members: []string{"test"}},
+	}, ParseGroup([]byte(testGroup)))
+}
+
+func TestGetExecUser(t *testing.T) {
+	users := ParsePasswd([]byte(testPasswd))
+	groups := ParseGroup([]byte(testGroup))
+	for spec, test := range map[string]struct {
+		expected  *ExecUser
+		expectErr bool
+	}{
+		"test": {
+			expected: &ExecUser{UID: 1000, GID: 1001, Name: "test", Home: "/home/test", Sgids: []uint32{2000, 10}},
+		},
+		"1000": {
+			expected: &ExecUser{UID: 1000, GID: 1001, Name: "test", Home: "/home/test", Sgids: []uint32{2000, 10}},
+		},
+		"daemon": {
+			expected: &ExecUser{UID: 1, GID: 1, Name: "daemon", Home: "/usr/sbin", Sgids: []uint32{2000}},
+		},
+		"1234": {
+			expected: &ExecUser{UID: 1234, GID: 0},
+		},
+		"test:extra": {
+			expected: &ExecUser{UID: 1000, GID: 2000, Name: "test", Home: "/home/test", Sgids: []uint32{2000, 10}},
+		},
+		"1234:5678": {
+			expected: &ExecUser{UID: 1234, GID: 5678},
+		},
+		"unknown": {
+			expectErr: true,
+		},
+		"test:unknown": {
+			expectErr: true,
+		},
+		":1000": {
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", spec)
+		execUser, err := GetExecUser(spec, users, groups)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, execUser)
+	}
+}